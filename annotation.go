@@ -2,13 +2,15 @@ package entx
 
 import (
 	"encoding/json"
+	"time"
 
 	"entgo.io/ent/entc/gen"
 	"entgo.io/ent/entc/load"
 	"entgo.io/ent/schema"
 )
 
-// DecodableAnnotation is an annotation that can decode itself from a raw value
+// DecodableAnnotation is an annotation that decodes itself from a raw value, its Decode method is used instead of
+// DecodeAnnotation when it needs a custom decoding
 type DecodableAnnotation interface {
 	schema.Annotation
 	Decode(annotation any) error
@@ -20,6 +22,9 @@ var CascadeAnnotationName = "OPENLANE_CASCADE"
 // CascadeThroughAnnotationName is a name for our cascading through edge delete annotation
 var CascadeThroughAnnotationName = "OPENLANE_CASCADE_THROUGH"
 
+// RetentionAnnotationName is a name for our soft deleted records retention annotation
+var RetentionAnnotationName = "OPENLANE_RETENTION"
+
 // SchemaGenAnnotationName is a name for our graphql schema generation annotation
 var SchemaGenAnnotationName = "OPENLANE_SCHEMAGEN"
 
@@ -83,6 +88,12 @@ var ApprovalStatusAnnotationName = "OPENLANE_APPROVAL_STATUS"
 // ApprovalApproverAnnotationName is the annotation name for a schema's approval-approver field
 var ApprovalApproverAnnotationName = "OPENLANE_APPROVAL_APPROVER"
 
+// TagsAnnotationName is the annotation name for the tags field of a schema
+var TagsAnnotationName = "OPENLANE_TAGS"
+
+// EncryptedFieldAnnotationName is the annotation name for fields encrypted at rest
+var EncryptedFieldAnnotationName = "OPENLANE_ENCRYPTED_FIELD"
+
 // CascadeAnnotation is an annotation used to indicate that an edge should be cascaded
 type CascadeAnnotation struct {
 	Field string
@@ -99,6 +110,13 @@ type ThroughCleanup struct {
 	Through string
 }
 
+// RetentionAnnotation is an annotation used to set how long soft deleted records of the schema are kept
+// before they are purged
+type RetentionAnnotation struct {
+	// Window is how long a record is kept after it was soft deleted
+	Window time.Duration
+}
+
 // SchemaGenAnnotation is an annotation used to indicate that schema generation should be skipped for this type
 // When Skip is true, the search schema generation is always skipped
 // SkipSearch allow for schemas to be be opt out of search schema generation
@@ -242,6 +260,19 @@ type ApprovalStatusAnnotation struct{}
 // ApprovalApproverAnnotation marks the group-id field resolving a schema's approvers
 type ApprovalApproverAnnotation struct{}
 
+// TagsAnnotation marks the schema as tagged, it is set by the tag mixin and the helpers generated with
+// WithTagHelpers list, rename, merge and filter the tags of the field
+type TagsAnnotation struct {
+	// Field is the []string field holding the tags
+	Field string
+	// Vocabulary lists the allowed tags, any tag is allowed when empty
+	Vocabulary []string `json:",omitempty"`
+}
+
+// EncryptedFieldAnnotation marks a string or JSON field as encrypted at rest; the hooks and interceptors generated
+// with WithEncryption encrypt the field on write and decrypt it on read
+type EncryptedFieldAnnotation struct{}
+
 // FGACrudAnnotation marks the crud operations that are allowed for the schema to generate crud tuples
 // If this annotation is not added, it uses the default based on annotations and policies on the schema
 type FGACrudAnnotation struct {
@@ -275,6 +306,11 @@ func (a CascadeThroughAnnotation) Name() string {
 	return CascadeThroughAnnotationName
 }
 
+// Name returns the name of the RetentionAnnotation
+func (a RetentionAnnotation) Name() string {
+	return RetentionAnnotationName
+}
+
 // Name returns the name of the SchemaGenAnnotation
 func (a SchemaGenAnnotation) Name() string {
 	return SchemaGenAnnotationName
@@ -350,6 +386,16 @@ func (a ApprovalApproverAnnotation) Name() string {
 	return ApprovalApproverAnnotationName
 }
 
+// Name returns the name of the TagsAnnotation
+func (a TagsAnnotation) Name() string {
+	return TagsAnnotationName
+}
+
+// Name returns the name of the EncryptedFieldAnnotation
+func (a EncryptedFieldAnnotation) Name() string {
+	return EncryptedFieldAnnotationName
+}
+
 // Name returns the name of the FGACrudAnnotation
 func (a FGACrudAnnotation) Name() string {
 	return FGACrudAnnotationName
@@ -389,6 +435,13 @@ func CascadeThroughAnnotationField(schemas []ThroughCleanup) *CascadeThroughAnno
 	}
 }
 
+// RetentionWindow sets how long soft deleted records of the schema are kept before they are purged
+func RetentionWindow(window time.Duration) *RetentionAnnotation {
+	return &RetentionAnnotation{
+		Window: window,
+	}
+}
+
 // SchemaGenSkip sets whether the schema generation should be skipped for this type
 func SchemaGenSkip(skip bool) *SchemaGenAnnotation {
 	return &SchemaGenAnnotation{
@@ -465,6 +518,11 @@ func ApprovalApprover() ApprovalApproverAnnotation {
 	return ApprovalApproverAnnotation{}
 }
 
+// Encrypted marks the field as encrypted at rest
+func Encrypted() EncryptedFieldAnnotation {
+	return EncryptedFieldAnnotation{}
+}
+
 // QueryGenSkip sets whether the query generation should be skipped for this type
 func QueryGenSkip(skip bool) *QueryGenAnnotation {
 	return &QueryGenAnnotation{
@@ -701,81 +759,6 @@ func (b *CSVRefBuilder) MarshalJSON() ([]byte, error) {
 	return json.Marshal(b.annotation)
 }
 
-// Decode unmarshalls the CascadeAnnotation
-func (a *CascadeAnnotation) Decode(annotation any) error {
-	return DecodeAnnotation(annotation, a)
-}
-
-// Decode unmarshalls the CascadeThroughAnnotation
-func (a *CascadeThroughAnnotation) Decode(annotation any) error {
-	return DecodeAnnotation(annotation, a)
-}
-
-// Decode unmarshalls the SchemaGenAnnotation
-func (a *SchemaGenAnnotation) Decode(annotation any) error {
-	return DecodeAnnotation(annotation, a)
-}
-
-// Decode unmarshals the FileCategoryAnnotation.
-func (a *FileCategoryAnnotation) Decode(annotation any) error {
-	return DecodeAnnotation(annotation, a)
-}
-
-// Decode unmarshals the ConsoleRouteAnnotation
-func (a *ConsoleRouteAnnotation) Decode(annotation any) error {
-	return DecodeAnnotation(annotation, a)
-}
-
-// Decode unmarshals the FGACrudAnnotation.
-func (a *FGACrudAnnotation) Decode(annotation any) error {
-	return DecodeAnnotation(annotation, a)
-}
-
-// Decode unmarshals the FGAParentCrudAnnotation.
-func (a *FGAParentCrudAnnotation) Decode(annotation any) error {
-	return DecodeAnnotation(annotation, a)
-}
-
-// Decode unmarshalls the QueryGenAnnotation
-func (a *QueryGenAnnotation) Decode(annotation any) error {
-	return DecodeAnnotation(annotation, a)
-}
-
-// Decode unmarshalls the SearchFieldAnnotation
-func (a *SearchFieldAnnotation) Decode(annotation any) error {
-	return DecodeAnnotation(annotation, a)
-}
-
-// Decode unmarshalls the WorkflowEligibleAnnotation
-func (a *WorkflowEligibleAnnotation) Decode(annotation any) error {
-	return DecodeAnnotation(annotation, a)
-}
-
-// Decode unmarshalls the TaskRuleAnnotation
-func (a *TaskRuleAnnotation) Decode(annotation any) error {
-	return DecodeAnnotation(annotation, a)
-}
-
-// Decode unmarshalls the WebhookPayloadFieldAnnotation
-func (a *WebhookPayloadFieldAnnotation) Decode(annotation any) error {
-	return DecodeAnnotation(annotation, a)
-}
-
-// Decode unmarshalls the CSVReferenceAnnotation
-func (a *CSVReferenceAnnotation) Decode(annotation any) error {
-	return DecodeAnnotation(annotation, a)
-}
-
-// Decode unmarshalls the IntegrationMappingFieldAnnotation
-func (a *IntegrationMappingFieldAnnotation) Decode(annotation any) error {
-	return DecodeAnnotation(annotation, a)
-}
-
-// Decode unmarshalls the IntegrationMappingSchemaAnnotation
-func (a *IntegrationMappingSchemaAnnotation) Decode(annotation any) error {
-	return DecodeAnnotation(annotation, a)
-}
-
 // DecodeAnnotation is a common wrapper to decode an annotation with
 // json marshal and unmarshal into the target
 func DecodeAnnotation(annotation any, target any) error {
@@ -797,14 +780,27 @@ func HasAnnotation[T schema.Annotation, K any](t K) bool {
 	return hasAnnotation[T](annotations)
 }
 
-// GetAnnotation returns the decoded annotation of type T if present on the node.
-// T must be a pointer type, e.g. GetAnnotation[*MyAnnotation](node).
-func GetAnnotation[T DecodableAnnotation, K any](t K) (T, bool) {
+// GetAnnotation returns the decoded annotation of type T if present on the node, which can be a gen.Type,
+// gen.Field, gen.Edge, load.Schema, load.Field, load.Edge or their annotations. T is the annotation type or a
+// pointer to it, e.g. GetAnnotation[*SearchFieldAnnotation](field) or GetAnnotation[DisplayNameAnnotation](field),
+// and is decoded with the decoder registered with RegisterAnnotation
+func GetAnnotation[T schema.Annotation, K any](t K) (T, bool) {
+	ant, ok, err := LookupAnnotation[T](t)
+	if err != nil {
+		return ant, false
+	}
+
+	return ant, ok
+}
+
+// LookupAnnotation returns the decoded annotation of type T like GetAnnotation, and the error when the annotation is
+// set but cannot be decoded
+func LookupAnnotation[T schema.Annotation, K any](t K) (T, bool, error) {
 	var nilT T
 
 	annotations := getAnnotationForType(t)
 	if annotations == nil {
-		return nilT, false
+		return nilT, false, nil
 	}
 
 	return getAnnotation[T](annotations)
@@ -812,33 +808,28 @@ func GetAnnotation[T DecodableAnnotation, K any](t K) (T, bool) {
 
 // hasAnnotation returns true if the provided annotations has the provided annotation type
 func hasAnnotation[T schema.Annotation](ants gen.Annotations) bool {
-	var ant T
-
-	_, ok := ants[ant.Name()]
+	_, ok := ants[annotationName[T]()]
 
 	return ok
 }
 
 // getAnnotation returns the annotation value if set in the annotations
-func getAnnotation[T DecodableAnnotation](ants gen.Annotations) (T, bool) {
+func getAnnotation[T schema.Annotation](ants gen.Annotations) (T, bool, error) {
 	var nilT T
 
-	// Allocate so value-receiver methods (like Name) can be called safely on a non-nil pointer
-	var out T
-	if err := json.Unmarshal([]byte("{}"), &out); err != nil {
-		return nilT, false
-	}
+	name := annotationName[T]()
 
-	val, ok := ants[out.Name()]
+	val, ok := ants[name]
 	if !ok {
-		return nilT, false
+		return nilT, false, nil
 	}
 
-	if err := out.Decode(val); err != nil {
-		return nilT, false
+	out, err := decodeAnnotationAs[T](name, val)
+	if err != nil {
+		return nilT, false, err
 	}
 
-	return out, true
+	return out, true, nil
 }
 
 func getAnnotationForType[K any](t K) map[string]any {
@@ -855,6 +846,10 @@ func getAnnotationForType[K any](t K) map[string]any {
 		return v.Annotations
 	case *gen.Edge:
 		return v.Annotations
+	case gen.Annotations:
+		return v
+	case map[string]any:
+		return v
 	}
 
 	return nil
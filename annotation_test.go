@@ -3,6 +3,7 @@ package entx
 import (
 	"encoding/json"
 	"testing"
+	"time"
 
 	"entgo.io/ent/entc/gen"
 	"github.com/brianvoe/gofakeit/v7"
@@ -34,6 +35,17 @@ func TestCascadeThroughAnnotation(t *testing.T) {
 	assert.Equal(t, ca.Schemas[0].Through, s)
 }
 
+func TestRetentionAnnotation(t *testing.T) {
+	ra := RetentionWindow(30 * 24 * time.Hour)
+
+	assert.Equal(t, ra.Name(), RetentionAnnotationName)
+
+	decoded := &RetentionAnnotation{}
+	err := DecodeAnnotation(map[string]any{"Window": int64(time.Hour)}, decoded)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Hour, decoded.Window)
+}
+
 func TestSchemaGenAnnotation(t *testing.T) {
 	s := gofakeit.Bool()
 	sa := SchemaGenSkip(s)
@@ -47,7 +59,7 @@ func TestExportableAnnotation(t *testing.T) {
 
 	assert.Equal(t, ea.Name(), "Exportable")
 
-	err := ea.Decode(map[string]any{})
+	err := DecodeAnnotation(map[string]any{}, ea)
 	assert.NoError(t, err)
 }
 
@@ -57,9 +69,9 @@ func TestWorkflowEligibleAnnotation(t *testing.T) {
 	assert.Equal(t, wea.Name(), WorkflowEligibleAnnotationName)
 	assert.True(t, wea.Eligible)
 
-	// Test Decode method
+	// Test DecodeAnnotation
 	decoded := &WorkflowEligibleAnnotation{}
-	err := decoded.Decode(map[string]any{"Eligible": true})
+	err := DecodeAnnotation(map[string]any{"Eligible": true}, decoded)
 	assert.NoError(t, err)
 	assert.True(t, decoded.Eligible)
 }
@@ -162,12 +174,12 @@ func TestCSVRefBuilderMarshalJSON(t *testing.T) {
 
 func TestCSVReferenceAnnotationDecode(t *testing.T) {
 	decoded := &CSVReferenceAnnotation{}
-	err := decoded.Decode(map[string]any{
+	err := DecodeAnnotation(map[string]any{
 		"MatchField":      "email",
 		"CSVColumn":       "UserEmail",
 		"TargetEntity":    "User",
 		"CreateIfMissing": true,
-	})
+	}, decoded)
 
 	assert.NoError(t, err)
 	assert.Equal(t, "email", decoded.MatchField)
@@ -0,0 +1,337 @@
+package entx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"entgo.io/ent/dialect"
+	"github.com/rs/zerolog/log"
+	"github.com/theopenlane/utils/ulids"
+)
+
+const (
+	// DefaultReplicatorBatchSize is the default number of transactions replayed per batch
+	DefaultReplicatorBatchSize = 100
+	// DefaultReplicatorPollInterval is the default interval the outbox is checked for new entries
+	DefaultReplicatorPollInterval = 1 * time.Second
+	// DefaultReplicatorInitialBackoff is the default wait after the first failed replay
+	DefaultReplicatorInitialBackoff = 500 * time.Millisecond
+	// DefaultReplicatorMaxBackoff is the default maximum wait between failed replays
+	DefaultReplicatorMaxBackoff = 1 * time.Minute
+	// DefaultReplicatorMaxAttempts is the default number of replay attempts before a transaction is dead lettered
+	DefaultReplicatorMaxAttempts = 20
+)
+
+// ReplicationLag reports how far the secondary database is behind the primary
+type ReplicationLag struct {
+	// Pending is the number of statements waiting to be replayed
+	Pending int
+	// Behind is the age of the oldest statement waiting to be replayed
+	Behind time.Duration
+	// DeadLettered is the number of statements that were dead lettered instead of replayed
+	DeadLettered int
+}
+
+// ReplicatorOption configures an AsyncReplicator
+type ReplicatorOption func(*AsyncReplicator)
+
+// WithReplicatorBatchSize sets the number of transactions replayed per batch
+func WithReplicatorBatchSize(size int) ReplicatorOption {
+	return func(r *AsyncReplicator) {
+		r.batchSize = size
+	}
+}
+
+// WithReplicatorPollInterval sets the interval the outbox is checked for new entries
+func WithReplicatorPollInterval(interval time.Duration) ReplicatorOption {
+	return func(r *AsyncReplicator) {
+		r.pollInterval = interval
+	}
+}
+
+// WithReplicatorBackoff sets the initial and maximum exponential backoff between failed replays
+func WithReplicatorBackoff(initial, maxBackoff time.Duration) ReplicatorOption {
+	return func(r *AsyncReplicator) {
+		r.initialBackoff = initial
+		r.maxBackoff = maxBackoff
+	}
+}
+
+// WithReplicatorMaxAttempts sets the number of replay attempts before a failing transaction is dead lettered,
+// DefaultReplicatorMaxAttempts by default; zero or less retries the transaction until it is replayed
+func WithReplicatorMaxAttempts(attempts int) ReplicatorOption {
+	return func(r *AsyncReplicator) {
+		r.maxAttempts = attempts
+	}
+}
+
+// AsyncReplicator records secondary writes in an Outbox and replays them against the secondary database
+// in the background. Transactions are replayed in the order they were appended to the outbox; the
+// MultiWriteDriver appends the statements of a transaction once the primary committed it, holding
+// the commits of the other transactions, so the transactions of a driver are appended in commit
+// order. The outbox is not part of the primary transaction: a crash between the primary commit and
+// the append loses the statements of the transaction and the secondary must be reseeded.
+// A failing transaction is retried with exponential backoff and blocks the ones after it so the
+// secondary does not apply writes out of order, until it failed the maximum number of attempts
+// and is dead lettered; the secondary is then diverged, which ReplicationHealthcheck reports
+type AsyncReplicator struct {
+	outbox Outbox
+	target dialect.Driver
+
+	batchSize      int
+	pollInterval   time.Duration
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	maxAttempts    int
+
+	// commitMu serializes the primary commits and outbox appends so the transactions are appended in commit order
+	commitMu sync.Mutex
+	// replayMu ensures a single replay runs at a time between the worker and Drain
+	replayMu sync.Mutex
+	wake     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+	started  atomic.Bool
+}
+
+// NewAsyncReplicator returns an AsyncReplicator that replays the outbox against the target driver
+func NewAsyncReplicator(outbox Outbox, target dialect.Driver, opts ...ReplicatorOption) *AsyncReplicator {
+	r := &AsyncReplicator{
+		outbox:         outbox,
+		target:         target,
+		batchSize:      DefaultReplicatorBatchSize,
+		pollInterval:   DefaultReplicatorPollInterval,
+		initialBackoff: DefaultReplicatorInitialBackoff,
+		maxBackoff:     DefaultReplicatorMaxBackoff,
+		maxAttempts:    DefaultReplicatorMaxAttempts,
+		wake:           make(chan struct{}, 1),
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Start replays the outbox in the background until Close is called or the context is canceled
+func (r *AsyncReplicator) Start(ctx context.Context) {
+	if r.started.Swap(true) {
+		return
+	}
+
+	go r.run(ctx)
+}
+
+// Enqueue records the statements of a single primary transaction for replay
+func (r *AsyncReplicator) Enqueue(ctx context.Context, statements ...OutboxEntry) error {
+	if len(statements) == 0 {
+		return nil
+	}
+
+	txID := ulids.New().String()
+	now := time.Now()
+
+	for i := range statements {
+		statements[i].TxID = txID
+		statements[i].CreatedAt = now
+	}
+
+	if err := r.outbox.Append(ctx, statements...); err != nil {
+		return err
+	}
+
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Lag returns how far the secondary database is behind the primary
+func (r *AsyncReplicator) Lag(ctx context.Context) (ReplicationLag, error) {
+	stats, err := r.outbox.Stats(ctx)
+	if err != nil {
+		return ReplicationLag{}, err
+	}
+
+	lag := ReplicationLag{Pending: stats.Pending, DeadLettered: stats.DeadLettered}
+	if !stats.Oldest.IsZero() {
+		lag.Behind = time.Since(stats.Oldest)
+	}
+
+	return lag, nil
+}
+
+// Drain replays the outbox until it is empty, e.g. on shutdown, returning the last replay error
+// if the context is done before the backlog is cleared
+func (r *AsyncReplicator) Drain(ctx context.Context) error {
+	var lastErr error
+
+	for {
+		n, err := r.replay(ctx)
+		if err != nil && !errors.Is(err, ctx.Err()) {
+			lastErr = err
+		}
+
+		switch {
+		case ctx.Err() != nil:
+			return errors.Join(ctx.Err(), lastErr)
+		case err == nil && n == 0:
+			return nil
+		case err != nil:
+			select {
+			case <-ctx.Done():
+			case <-time.After(r.initialBackoff):
+			}
+		}
+	}
+}
+
+// Close stops the background replay; entries still pending stay in the outbox for the next start
+func (r *AsyncReplicator) Close() error {
+	r.once.Do(func() {
+		close(r.stop)
+	})
+
+	if r.started.Load() {
+		<-r.done
+	}
+
+	return nil
+}
+
+// run is the background replay loop
+func (r *AsyncReplicator) run(ctx context.Context) {
+	defer close(r.done)
+
+	backoff := r.initialBackoff
+
+	for {
+		wait := r.pollInterval
+
+		n, err := r.replay(ctx)
+
+		switch {
+		case err != nil:
+			log.Warn().Err(err).Dur("backoff", backoff).Msg("failed replaying secondary writes")
+
+			wait = backoff
+			backoff = min(backoff*2, r.maxBackoff) //nolint:mnd
+		case n > 0:
+			backoff = r.initialBackoff
+
+			// keep going while there is a backlog
+			continue
+		default:
+			backoff = r.initialBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.stop:
+			return
+		case <-r.wake:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// replay replays one batch of transactions and returns the number replayed or dead lettered
+func (r *AsyncReplicator) replay(ctx context.Context) (int, error) {
+	r.replayMu.Lock()
+	defer r.replayMu.Unlock()
+
+	entries, err := r.outbox.Peek(ctx, r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+
+	for start := 0; start < len(entries); {
+		end := start
+		for end < len(entries) && entries[end].TxID == entries[start].TxID {
+			end++
+		}
+
+		txID := entries[start].TxID
+
+		if err := r.replayTx(ctx, entries[start:end]); err != nil {
+			if r.maxAttempts > 0 && entries[start].Attempts+1 >= r.maxAttempts {
+				if dlErr := r.outbox.DeadLetter(ctx, txID, err); dlErr != nil {
+					return replayed, errors.Join(err, dlErr)
+				}
+
+				log.Error().Err(err).Str("txid", txID).Int("attempts", entries[start].Attempts+1).
+					Msg("dead lettered secondary writes, the secondary database must be reseeded")
+
+				replayed++
+				start = end
+
+				continue
+			}
+
+			if markErr := r.outbox.MarkFailed(ctx, txID, err); markErr != nil {
+				err = errors.Join(err, markErr)
+			}
+
+			return replayed, fmt.Errorf("%w: transaction %s: %w", ErrSecondaryWriteFailed, txID, err)
+		}
+
+		if err := r.outbox.Ack(ctx, txID); err != nil {
+			return replayed, err
+		}
+
+		replayed++
+		start = end
+	}
+
+	return replayed, nil
+}
+
+// replayTx applies the statements of a single primary transaction to the target in a transaction
+func (r *AsyncReplicator) replayTx(ctx context.Context, entries []OutboxEntry) error {
+	tx, err := r.target.Tx(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if err := tx.Exec(ctx, e.Query, e.Args, nil); err != nil {
+			return errors.Join(err, tx.Rollback())
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ReplicationHealthcheck reports the replicator unhealthy when the secondary is more than maxLag behind or
+// writes were dead lettered
+func ReplicationHealthcheck(r *AsyncReplicator, maxLag time.Duration) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		lag, err := r.Lag(ctx)
+		if err != nil {
+			return fmt.Errorf("replication lag check failed: %w", err)
+		}
+
+		if lag.DeadLettered > 0 {
+			return fmt.Errorf("%w: %d statements", ErrReplicationDeadLettered, lag.DeadLettered)
+		}
+
+		if lag.Behind > maxLag {
+			return fmt.Errorf("%w: %d pending writes, %s behind", ErrReplicationLag, lag.Pending, lag.Behind)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,190 @@
+package entx_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+
+	"github.com/theopenlane/entx"
+)
+
+func newTestOutbox(t *testing.T) *entx.SQLiteOutbox {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "outbox.db"))
+	require.NoError(t, err)
+
+	t.Cleanup(func() { db.Close() })
+
+	outbox, err := entx.NewSQLiteOutbox(context.Background(), db)
+	require.NoError(t, err)
+
+	return outbox
+}
+
+func TestSQLiteOutbox(t *testing.T) {
+	ctx := context.Background()
+	outbox := newTestOutbox(t)
+
+	created := time.Now().Add(-time.Minute)
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+
+	require.NoError(t, outbox.Append(ctx,
+		entx.OutboxEntry{TxID: "tx1", Query: "INSERT 1", Args: []any{"a", 1, 1.5, true, []byte("b"), ts, nil}, CreatedAt: created},
+		entx.OutboxEntry{TxID: "tx1", Query: "INSERT 2", CreatedAt: created},
+	))
+	require.NoError(t, outbox.Append(ctx, entx.OutboxEntry{TxID: "tx2", Query: "INSERT 3", CreatedAt: time.Now()}))
+
+	stats, err := outbox.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, stats.Pending)
+	assert.WithinDuration(t, created, stats.Oldest, time.Millisecond)
+
+	entries, err := outbox.Peek(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "INSERT 1", entries[0].Query)
+	assert.Equal(t, "INSERT 2", entries[1].Query)
+	assert.Equal(t, []any{"a", int64(1), 1.5, true, []byte("b"), ts, nil}, entries[0].Args)
+	assert.Empty(t, entries[1].Args)
+
+	require.NoError(t, outbox.MarkFailed(ctx, "tx1", errors.New("boom")))
+	require.NoError(t, outbox.Ack(ctx, "tx2"))
+
+	entries, err = outbox.Peek(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, 1, entries[0].Attempts)
+
+	require.NoError(t, outbox.DeadLetter(ctx, "tx1", errors.New("boom")))
+
+	stats, err = outbox.Stats(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, stats.Pending)
+	assert.Equal(t, 2, stats.DeadLettered)
+	assert.True(t, stats.Oldest.IsZero())
+}
+
+func TestSQLiteOutboxUnsupportedArgument(t *testing.T) {
+	outbox := newTestOutbox(t)
+
+	err := outbox.Append(context.Background(), entx.OutboxEntry{TxID: "tx1", Query: "INSERT", Args: []any{struct{}{}}})
+	assert.ErrorIs(t, err, entx.ErrOutboxArgument)
+}
+
+func TestAsyncReplicatorDrain(t *testing.T) {
+	ctx := context.Background()
+	target := &recordingDriver{name: "secondary", err: errors.New("secondary down")}
+
+	r := entx.NewAsyncReplicator(newTestOutbox(t), target,
+		entx.WithReplicatorBackoff(time.Millisecond, time.Millisecond),
+		entx.WithReplicatorMaxAttempts(0),
+	)
+
+	require.NoError(t, r.Enqueue(ctx, entx.OutboxEntry{Query: "INSERT 1"}, entx.OutboxEntry{Query: "INSERT 2"}))
+	require.NoError(t, r.Enqueue(ctx, entx.OutboxEntry{Query: "INSERT 3"}))
+
+	lag, err := r.Lag(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, lag.Pending)
+
+	// the secondary is down, so the backlog is kept and the oldest transaction blocks the rest
+	drainCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+
+	err = r.Drain(drainCtx)
+	require.ErrorIs(t, err, entx.ErrSecondaryWriteFailed)
+	assert.Equal(t, 0, target.commits)
+	assert.Positive(t, target.rollbacks)
+
+	for _, q := range target.execs {
+		assert.Equal(t, "INSERT 1", q)
+	}
+
+	require.ErrorIs(t, entx.ReplicationHealthcheck(r, 0)(ctx), entx.ErrReplicationLag)
+
+	// the secondary recovers and the backlog is replayed in order
+	target.err = nil
+	target.execs = nil
+
+	require.NoError(t, r.Drain(ctx))
+	assert.Equal(t, []string{"INSERT 1", "INSERT 2", "INSERT 3"}, target.execs)
+	assert.Equal(t, 2, target.commits)
+
+	lag, err = r.Lag(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, lag.Pending)
+	assert.NoError(t, entx.ReplicationHealthcheck(r, time.Minute)(ctx))
+	assert.NoError(t, r.Close())
+}
+
+func TestAsyncReplicatorDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	target := &recordingDriver{name: "secondary", err: errors.New("bad statement")}
+
+	r := entx.NewAsyncReplicator(newTestOutbox(t), target,
+		entx.WithReplicatorBackoff(time.Millisecond, time.Millisecond),
+		entx.WithReplicatorMaxAttempts(3),
+	)
+
+	require.NoError(t, r.Enqueue(ctx, entx.OutboxEntry{Query: "INSERT 1"}))
+
+	// the transaction fails the maximum number of attempts and is dead lettered instead of blocking the replay
+	require.NoError(t, r.Drain(ctx))
+	assert.Equal(t, []string{"INSERT 1", "INSERT 1", "INSERT 1"}, target.execs)
+
+	lag, err := r.Lag(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, lag.Pending)
+	assert.Equal(t, 1, lag.DeadLettered)
+	assert.ErrorIs(t, entx.ReplicationHealthcheck(r, time.Minute)(ctx), entx.ErrReplicationDeadLettered)
+
+	// the transactions after it are replayed
+	target.err = nil
+	target.execs = nil
+
+	require.NoError(t, r.Enqueue(ctx, entx.OutboxEntry{Query: "INSERT 2"}))
+	require.NoError(t, r.Drain(ctx))
+	assert.Equal(t, []string{"INSERT 2"}, target.execs)
+}
+
+func TestMultiWriteDriverAsync(t *testing.T) {
+	ctx := context.Background()
+	primary := &recordingDriver{name: "primary"}
+	secondary := &recordingDriver{name: "secondary"}
+
+	drv := &entx.MultiWriteDriver{
+		Wp:    primary,
+		Ws:    secondary,
+		Async: entx.NewAsyncReplicator(newTestOutbox(t), secondary),
+	}
+
+	require.NoError(t, drv.Exec(ctx, "INSERT 1", []any{"a"}, nil))
+
+	assert.Equal(t, []string{"INSERT 1"}, primary.execs)
+	assert.Equal(t, 1, primary.commits)
+	assert.Empty(t, secondary.execs)
+
+	lag, err := drv.Async.Lag(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, lag.Pending)
+
+	// arguments that cannot be recorded are rejected before reaching the primary
+	err = drv.Exec(ctx, "INSERT 2", []any{struct{}{}}, nil)
+	require.ErrorIs(t, err, entx.ErrOutboxArgument)
+	assert.Equal(t, []string{"INSERT 1"}, primary.execs)
+
+	require.NoError(t, drv.Async.Drain(ctx))
+	assert.Equal(t, []string{"INSERT 1"}, secondary.execs)
+
+	require.NoError(t, drv.Close())
+	assert.True(t, primary.closed)
+	assert.True(t, secondary.closed)
+}
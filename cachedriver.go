@@ -0,0 +1,520 @@
+package entx
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"entgo.io/ent/dialect"
+	entsql "entgo.io/ent/dialect/sql"
+	"github.com/theopenlane/utils/contextx"
+)
+
+var skipCacheKey = contextx.NewKey[bool]()
+
+// SkipCache returns a new context that makes the CacheDriver read from the database instead of the cache
+func SkipCache(parent context.Context) context.Context {
+	return skipCacheKey.Set(parent, true)
+}
+
+// CheckSkipCache checks whether the cache should be skipped for the context
+func CheckSkipCache(ctx context.Context) bool {
+	skip, _ := skipCacheKey.Get(ctx)
+	return skip
+}
+
+// CacheKey returns the key a query and its arguments are cached under
+func CacheKey(query string, args []any) (string, error) {
+	encoded, err := encodeOutboxArgs(args)
+	if err != nil {
+		return "", fmt.Errorf("failed building cache key: %w", err)
+	}
+
+	sum := sha256.Sum256([]byte(query + "\x00" + encoded))
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// statementTables matches the table names a statement reads from or writes to
+var statementTables = regexp.MustCompile("(?i)\\b(?:from|join|into|update)\\s+((?:[\"`]?\\w+[\"`]?\\.)?[\"`]?\\w+[\"`]?)")
+
+// StatementTables returns the lower cased names of the tables referenced by the statement
+func StatementTables(query string) []string {
+	var tables []string
+
+	seen := map[string]bool{}
+
+	for _, m := range statementTables.FindAllStringSubmatch(query, -1) {
+		name := m[1]
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			name = name[i+1:]
+		}
+
+		name = strings.ToLower(strings.Trim(name, "\"`"))
+
+		if !seen[name] {
+			seen[name] = true
+			tables = append(tables, name)
+		}
+	}
+
+	return tables
+}
+
+// isCacheableQuery reports whether the statement only reads data; Query is also used for
+// statements such as INSERT ... RETURNING which must not be cached
+func isCacheableQuery(query string) bool {
+	fields := strings.Fields(query)
+
+	return len(fields) > 0 && strings.EqualFold(fields[0], "select")
+}
+
+// CacheStats reports the CacheDriver usage
+type CacheStats struct {
+	// Hits is the number of queries served from the cache
+	Hits int64
+	// Misses is the number of cacheable queries sent to the database
+	Misses int64
+	// Entries is the number of results currently cached
+	Entries int
+}
+
+// cacheEntry is a materialized query result
+type cacheEntry struct {
+	columns []string
+	rows    [][]any
+	tables  []string
+	expires time.Time
+}
+
+// CacheDriver memoizes Query results by statement and arguments for the TTL. Results are dropped
+// when a statement touching one of their tables is executed through the driver, or committed in
+// one of its transactions. Reads inside transactions are never cached
+type CacheDriver struct {
+	dialect.Driver
+
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	// generation is bumped on every invalidation so results read before it are not stored
+	generation uint64
+	lastSweep  time.Time
+
+	hits   atomic.Int64
+	misses atomic.Int64
+
+	// replay serves cached results as *sql.Rows so scanning behaves exactly as it does for the database
+	replay *sql.DB
+}
+
+var _ dialect.Driver = (*CacheDriver)(nil)
+
+// NewCacheDriver returns a CacheDriver caching the results of the driver for the TTL
+func NewCacheDriver(drv dialect.Driver, ttl time.Duration) *CacheDriver {
+	return &CacheDriver{
+		Driver:  drv,
+		ttl:     ttl,
+		entries: map[string]*cacheEntry{},
+		replay:  sql.OpenDB(cacheReplayConnector{}),
+	}
+}
+
+// Query returns the cached result for the statement and arguments when present, otherwise the
+// statement is sent to the underlying driver and its result cached
+func (d *CacheDriver) Query(ctx context.Context, query string, args, v any) error {
+	rows, ok := v.(*entsql.Rows)
+	argv, argsOK := args.([]any)
+
+	if !ok || !argsOK || CheckSkipCache(ctx) || !isCacheableQuery(query) {
+		if err := d.Driver.Query(ctx, query, args, v); err != nil {
+			return err
+		}
+
+		if !isCacheableQuery(query) {
+			d.Invalidate(StatementTables(query)...)
+		}
+
+		return nil
+	}
+
+	key, err := CacheKey(query, argv)
+	if err != nil {
+		return d.Driver.Query(ctx, query, args, v)
+	}
+
+	entry, gen, ok := d.lookup(key)
+	if ok {
+		d.hits.Add(1)
+
+		return d.serve(ctx, entry, rows)
+	}
+
+	d.misses.Add(1)
+
+	if entry, err = d.load(ctx, query, args); err != nil {
+		return err
+	}
+
+	d.store(key, gen, entry)
+
+	return d.serve(ctx, entry, rows)
+}
+
+// Exec runs the statement on the underlying driver and drops the cached results of the tables it touches
+func (d *CacheDriver) Exec(ctx context.Context, query string, args, v any) error {
+	if err := d.Driver.Exec(ctx, query, args, v); err != nil {
+		return err
+	}
+
+	d.Invalidate(StatementTables(query)...)
+
+	return nil
+}
+
+// Tx starts a transaction on the underlying driver; tables written in the transaction are invalidated on commit
+func (d *CacheDriver) Tx(ctx context.Context) (dialect.Tx, error) {
+	tx, err := d.Driver.Tx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cacheTx{Tx: tx, driver: d}, nil
+}
+
+// BeginTx calls the underlying driver BeginTx command if it is supported and falls back to Tx otherwise
+func (d *CacheDriver) BeginTx(ctx context.Context, opts *sql.TxOptions) (dialect.Tx, error) {
+	b, ok := d.Driver.(interface {
+		BeginTx(context.Context, *sql.TxOptions) (dialect.Tx, error)
+	})
+	if !ok {
+		return d.Tx(ctx)
+	}
+
+	tx, err := b.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cacheTx{Tx: tx, driver: d}, nil
+}
+
+// Close closes the cache replay connections and the underlying driver
+func (d *CacheDriver) Close() error {
+	return errors.Join(d.replay.Close(), d.Driver.Close())
+}
+
+// Invalidate drops the cached results that read from any of the tables; with no tables, or tables
+// that could not be determined, the whole cache is dropped
+func (d *CacheDriver) Invalidate(tables ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.generation++
+
+	if len(tables) == 0 {
+		clear(d.entries)
+
+		return
+	}
+
+	for key, entry := range d.entries {
+		for _, t := range entry.tables {
+			if containsFold(tables, t) {
+				delete(d.entries, key)
+
+				break
+			}
+		}
+	}
+}
+
+// InvalidateKey drops the cached result stored under the key, see CacheKey
+func (d *CacheDriver) InvalidateKey(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.entries, key)
+}
+
+// Stats returns the cache usage
+func (d *CacheDriver) Stats() CacheStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return CacheStats{
+		Hits:    d.hits.Load(),
+		Misses:  d.misses.Load(),
+		Entries: len(d.entries),
+	}
+}
+
+// lookup returns the unexpired entry for the key, and the generation a new entry must be stored with
+func (d *CacheDriver) lookup(key string) (*cacheEntry, uint64, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	entry, ok := d.entries[key]
+	if ok && time.Now().Before(entry.expires) {
+		return entry, d.generation, true
+	}
+
+	return nil, d.generation, false
+}
+
+// store caches the entry unless the cache was invalidated since the result was read
+func (d *CacheDriver) store(key string, gen uint64, entry *cacheEntry) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if gen != d.generation {
+		return
+	}
+
+	now := time.Now()
+
+	// drop expired results so the cache does not grow with one-off queries
+	if now.Sub(d.lastSweep) > d.ttl {
+		for k, e := range d.entries {
+			if now.After(e.expires) {
+				delete(d.entries, k)
+			}
+		}
+
+		d.lastSweep = now
+	}
+
+	entry.expires = now.Add(d.ttl)
+	d.entries[key] = entry
+}
+
+// load runs the query on the underlying driver and materializes the result
+func (d *CacheDriver) load(ctx context.Context, query string, args any) (*cacheEntry, error) {
+	var rows entsql.Rows
+	if err := d.Driver.Query(ctx, query, args, &rows); err != nil {
+		return nil, err
+	}
+
+	entry, err := readRows(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	entry.tables = StatementTables(query)
+
+	return entry, nil
+}
+
+// readRows reads the rows to the end into a cacheEntry and closes them
+func readRows(rows *entsql.Rows) (*cacheEntry, error) {
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &cacheEntry{columns: columns}
+
+	for rows.Next() {
+		values := make([]any, len(columns))
+
+		dest := make([]any, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		entry.rows = append(entry.rows, values)
+	}
+
+	return entry, rows.Err()
+}
+
+// serve sets the rows to the cached result
+func (d *CacheDriver) serve(ctx context.Context, entry *cacheEntry, rows *entsql.Rows) error {
+	return replayRows(ctx, d.replay, entry, rows)
+}
+
+// replayRows sets the rows to the result of the entry, served by a cache replay database
+func replayRows(ctx context.Context, replay *sql.DB, entry *cacheEntry, rows *entsql.Rows) error {
+	r, err := replay.QueryContext(ctx, "", entry)
+	if err != nil {
+		return err
+	}
+
+	*rows = entsql.Rows{ColumnScanner: r}
+
+	return nil
+}
+
+// cacheTx is a transaction that invalidates the tables it wrote to once committed
+type cacheTx struct {
+	dialect.Tx
+
+	driver *CacheDriver
+	tables []string
+	// unknown is set when a statement was executed whose tables could not be determined
+	unknown bool
+}
+
+// Query calls the underlying transaction Query, tracking tables written by statements such as INSERT ... RETURNING
+func (tx *cacheTx) Query(ctx context.Context, query string, args, v any) error {
+	if err := tx.Tx.Query(ctx, query, args, v); err != nil {
+		return err
+	}
+
+	if !isCacheableQuery(query) {
+		tx.track(query)
+	}
+
+	return nil
+}
+
+// Exec calls the underlying transaction Exec and tracks the tables written
+func (tx *cacheTx) Exec(ctx context.Context, query string, args, v any) error {
+	if err := tx.Tx.Exec(ctx, query, args, v); err != nil {
+		return err
+	}
+
+	tx.track(query)
+
+	return nil
+}
+
+// Commit commits the underlying transaction and drops the cached results of the tables written
+func (tx *cacheTx) Commit() error {
+	if err := tx.Tx.Commit(); err != nil {
+		return err
+	}
+
+	switch {
+	case tx.unknown:
+		tx.driver.Invalidate()
+	case len(tx.tables) > 0:
+		tx.driver.Invalidate(tx.tables...)
+	}
+
+	return nil
+}
+
+// track records the tables written by the statement
+func (tx *cacheTx) track(query string) {
+	tables := StatementTables(query)
+	if len(tables) == 0 {
+		tx.unknown = true
+
+		return
+	}
+
+	tx.tables = append(tx.tables, tables...)
+}
+
+// containsFold reports whether s is in list, ignoring case
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cacheReplayConnector is a database/sql connector that replays cacheEntry results; the entry is
+// passed as the only query argument
+type cacheReplayConnector struct{}
+
+func (c cacheReplayConnector) Connect(context.Context) (driver.Conn, error) {
+	return cacheReplayConn{}, nil
+}
+
+func (c cacheReplayConnector) Driver() driver.Driver {
+	return cacheReplayDriver{}
+}
+
+type cacheReplayDriver struct{}
+
+func (cacheReplayDriver) Open(string) (driver.Conn, error) {
+	return cacheReplayConn{}, nil
+}
+
+type cacheReplayConn struct{}
+
+var errCacheReplayUnsupported = errors.New("cache replay connection only supports queries")
+
+func (cacheReplayConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errCacheReplayUnsupported
+}
+
+func (cacheReplayConn) Close() error {
+	return nil
+}
+
+func (cacheReplayConn) Begin() (driver.Tx, error) {
+	return nil, errCacheReplayUnsupported
+}
+
+// CheckNamedValue accepts the cacheEntry argument as is
+func (cacheReplayConn) CheckNamedValue(*driver.NamedValue) error {
+	return nil
+}
+
+func (cacheReplayConn) QueryContext(_ context.Context, _ string, args []driver.NamedValue) (driver.Rows, error) {
+	if len(args) != 1 {
+		return nil, errCacheReplayUnsupported
+	}
+
+	entry, ok := args[0].Value.(*cacheEntry)
+	if !ok {
+		return nil, errCacheReplayUnsupported
+	}
+
+	return &cacheReplayRows{entry: entry}, nil
+}
+
+// cacheReplayRows iterates the rows of a cacheEntry
+type cacheReplayRows struct {
+	entry *cacheEntry
+	next  int
+}
+
+func (r *cacheReplayRows) Columns() []string {
+	return r.entry.columns
+}
+
+func (r *cacheReplayRows) Close() error {
+	return nil
+}
+
+func (r *cacheReplayRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.entry.rows) {
+		return io.EOF
+	}
+
+	for i, v := range r.entry.rows[r.next] {
+		// scanners may keep the bytes, so each result gets its own copy
+		if b, ok := v.([]byte); ok {
+			v = append([]byte(nil), b...)
+		}
+
+		dest[i] = v
+	}
+
+	r.next++
+
+	return nil
+}
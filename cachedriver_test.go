@@ -0,0 +1,207 @@
+package entx_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"entgo.io/ent/dialect"
+	entsql "entgo.io/ent/dialect/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theopenlane/entx"
+)
+
+// newCacheTestDB returns a sqlite database with a users table and the ent driver for it
+func newCacheTestDB(t *testing.T) (*sql.DB, *entsql.Driver) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, created_at DATETIME, meta BLOB)`)
+	require.NoError(t, err)
+
+	_, err = db.Exec(`INSERT INTO users (id, name, created_at, meta) VALUES (1, 'funk', ?, ?)`, time.Now(), []byte(`{}`))
+	require.NoError(t, err)
+
+	return db, entsql.OpenDB(dialect.SQLite, db)
+}
+
+func queryUserName(t *testing.T, ctx context.Context, drv dialect.ExecQuerier, id int) string {
+	t.Helper()
+
+	var rows entsql.Rows
+	require.NoError(t, drv.Query(ctx, "SELECT `name`, `created_at`, `meta` FROM `users` WHERE `id` = ?", []any{id}, &rows))
+
+	defer rows.Close()
+
+	var (
+		name      sql.NullString
+		createdAt sql.NullTime
+		meta      []byte
+	)
+
+	require.True(t, rows.Next())
+	require.NoError(t, rows.Scan(&name, &createdAt, &meta))
+	require.NoError(t, rows.Err())
+
+	assert.True(t, createdAt.Valid)
+	assert.Equal(t, []byte(`{}`), meta)
+
+	return name.String
+}
+
+func TestCacheDriverQuery(t *testing.T) {
+	ctx := context.Background()
+	db, drv := newCacheTestDB(t)
+
+	cache := entx.NewCacheDriver(drv, time.Minute)
+
+	assert.Equal(t, "funk", queryUserName(t, ctx, cache, 1))
+
+	// changes made outside the driver are not seen until the result expires or is invalidated
+	_, err := db.Exec(`UPDATE users SET name = 'sfunk' WHERE id = 1`)
+	require.NoError(t, err)
+
+	assert.Equal(t, "funk", queryUserName(t, ctx, cache, 1))
+	assert.Equal(t, "sfunk", queryUserName(t, entx.SkipCache(ctx), cache, 1))
+
+	stats := cache.Stats()
+	assert.Equal(t, int64(1), stats.Hits)
+	assert.Equal(t, int64(1), stats.Misses)
+	assert.Equal(t, 1, stats.Entries)
+
+	// writes through the driver drop the results of the tables they touch
+	require.NoError(t, cache.Exec(ctx, "UPDATE `users` SET `name` = ? WHERE `id` = ?", []any{"meow", 1}, nil))
+	assert.Equal(t, "meow", queryUserName(t, ctx, cache, 1))
+
+	key, err := entx.CacheKey("SELECT `name`, `created_at`, `meta` FROM `users` WHERE `id` = ?", []any{1})
+	require.NoError(t, err)
+
+	cache.InvalidateKey(key)
+	assert.Zero(t, cache.Stats().Entries)
+
+	require.NoError(t, cache.Close())
+}
+
+func TestCacheDriverTTL(t *testing.T) {
+	ctx := context.Background()
+	db, drv := newCacheTestDB(t)
+
+	cache := entx.NewCacheDriver(drv, 10*time.Millisecond)
+
+	assert.Equal(t, "funk", queryUserName(t, ctx, cache, 1))
+
+	_, err := db.Exec(`UPDATE users SET name = 'sfunk' WHERE id = 1`)
+	require.NoError(t, err)
+
+	time.Sleep(20 * time.Millisecond)
+
+	assert.Equal(t, "sfunk", queryUserName(t, ctx, cache, 1))
+}
+
+func TestCacheDriverTx(t *testing.T) {
+	ctx := context.Background()
+	_, drv := newCacheTestDB(t)
+
+	cache := entx.NewCacheDriver(drv, time.Minute)
+
+	assert.Equal(t, "funk", queryUserName(t, ctx, cache, 1))
+
+	tx, err := cache.Tx(ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, tx.Exec(ctx, "UPDATE `users` SET `name` = ? WHERE `id` = ?", []any{"meow", 1}, nil))
+	assert.Equal(t, "meow", queryUserName(t, ctx, tx, 1))
+
+	// the cached result is kept until the transaction commits
+	assert.Equal(t, 1, cache.Stats().Entries)
+
+	require.NoError(t, tx.Commit())
+	assert.Zero(t, cache.Stats().Entries)
+
+	assert.Equal(t, "meow", queryUserName(t, ctx, cache, 1))
+}
+
+func TestCacheDriverOptIn(t *testing.T) {
+	newDriver := func(ttl time.Duration) dialect.Driver {
+		ec, err := entx.NewDBConfig(entx.Config{
+			DriverName:      entx.DriverSQLite,
+			PrimaryDBSource: "file:" + filepath.Join(t.TempDir(), "cache.db"),
+			CacheTTL:        ttl,
+		})
+		require.NoError(t, err)
+
+		drv := ec.GetDriver()
+		t.Cleanup(func() { drv.Close() })
+
+		return drv
+	}
+
+	// the results are only cached when the ttl is set
+	_, cached := newDriver(0).(*entx.CacheDriver)
+	assert.False(t, cached)
+	assert.IsType(t, &entx.CacheDriver{}, newDriver(entx.DefaultCacheTTL))
+}
+
+func TestCacheKey(t *testing.T) {
+	k1, err := entx.CacheKey("SELECT * FROM users WHERE id = ?", []any{1})
+	require.NoError(t, err)
+
+	k2, err := entx.CacheKey("SELECT * FROM users WHERE id = ?", []any{"1"})
+	require.NoError(t, err)
+
+	k3, err := entx.CacheKey("SELECT * FROM users WHERE id = ?", []any{1})
+	require.NoError(t, err)
+
+	assert.NotEqual(t, k1, k2)
+	assert.Equal(t, k1, k3)
+
+	_, err = entx.CacheKey("SELECT 1", []any{struct{}{}})
+	assert.Error(t, err)
+}
+
+func TestStatementTables(t *testing.T) {
+	testCases := []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		{
+			name:     "select with join",
+			query:    `SELECT * FROM "users" JOIN "public"."groups" ON users.id = groups.owner_id`,
+			expected: []string{"users", "groups"},
+		},
+		{
+			name:     "insert",
+			query:    "INSERT INTO `users` (`name`) VALUES (?) RETURNING `id`",
+			expected: []string{"users"},
+		},
+		{
+			name:     "update",
+			query:    `UPDATE Users SET name = $1`,
+			expected: []string{"users"},
+		},
+		{
+			name:     "delete",
+			query:    `DELETE FROM users WHERE id = $1`,
+			expected: []string{"users"},
+		},
+		{
+			name:  "no tables",
+			query: `SELECT 1`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, entx.StatementTables(tc.query))
+		})
+	}
+}
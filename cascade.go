@@ -0,0 +1,210 @@
+package entx
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"entgo.io/ent"
+	"entgo.io/ent/entc/gen"
+)
+
+//go:embed templates/*
+var _templates embed.FS
+
+// softDeleteField is the field that marks a schema as soft deletable, see mixin.SoftDeleteMixin
+const softDeleteField = "deleted_at"
+
+// CascadeStep is a delete run by the generated cascade hooks before a record of the parent schema is deleted
+type CascadeStep struct {
+	// Parent is the schema of the deleted record
+	Parent string
+	// Child is the schema of the records deleted with it
+	Child string
+	// Edge is the parent edge annotated with the CascadeAnnotation, empty for through cleanups
+	Edge string
+	// Field is the child edge referencing the parent
+	Field string
+	// Through is set when the child is a join schema cleaned up by the CascadeThroughAnnotation
+	Through bool
+	// Soft is set when the child is soft deletable; only soft deletable children are deleted when the
+	// parent is soft deleted, so the others are kept in case the parent is restored
+	Soft bool
+}
+
+// CascadePlan returns the steps run, in order, when a record of the schema is deleted or soft deleted, including
+// the cascades of the deleted children; the plans are the per-schema steps generated with WithCascadeDelete
+func CascadePlan(plans map[string][]CascadeStep, schema string, soft bool) []CascadeStep {
+	var (
+		steps []CascadeStep
+		walk  func(schema string, path map[string]bool)
+	)
+
+	walk = func(schema string, path map[string]bool) {
+		path[schema] = true
+		defer delete(path, schema)
+
+		for _, step := range plans[schema] {
+			// a schema cascading back to one being deleted is already covered by that delete
+			if path[step.Child] || (soft && !step.Soft) {
+				continue
+			}
+
+			// the children are deleted by their own delete, which runs their cascade first
+			walk(step.Child, path)
+
+			steps = append(steps, step)
+		}
+	}
+
+	walk(schema, map[string]bool{})
+
+	return steps
+}
+
+// CheckCascadeDelete reports whether the cascade hook of the schema should run for the mutation: hard deletes of the
+// schema, or the update a soft delete is turned into when the schema is soft deletable. Deletes of soft deletable
+// schemas are followed once they are turned into updates, unless soft deletes are skipped
+func CheckCascadeDelete(ctx context.Context, op ent.Op, schema string, softDeletable bool) bool {
+	switch {
+	case op.Is(ent.OpDelete | ent.OpDeleteOne):
+		return !softDeletable || CheckSkipSoftDelete(ctx)
+	case op.Is(ent.OpUpdate | ent.OpUpdateOne):
+		return softDeletable && CheckIsSoftDeleteType(ctx, schema)
+	default:
+		return false
+	}
+}
+
+// cascadeTemplateStep is a cascade step with the details the template needs
+type cascadeTemplateStep struct {
+	CascadeStep
+
+	// ChildPackage is the generated package of the child schema
+	ChildPackage string
+	// Predicate is the child predicate matching the children of the parent, e.g. HasOwnerWith
+	Predicate string
+}
+
+// cascadeSteps returns the cascade steps of the schema from its annotations; it fails when an annotation
+// references a schema or edge that does not exist so generation stops on misconfigured annotations
+func cascadeSteps(n *gen.Type, nodes []*gen.Type) ([]cascadeTemplateStep, error) {
+	var steps []cascadeTemplateStep
+
+	for _, e := range n.Edges {
+		raw, ok := e.Annotations[CascadeAnnotationName]
+		if !ok {
+			continue
+		}
+
+		ant := &CascadeAnnotation{}
+		if err := DecodeAnnotation(raw, ant); err != nil {
+			return nil, fmt.Errorf("failed decoding cascade annotation of %s.%s: %w", n.Name, e.Name, err)
+		}
+
+		step, err := newCascadeTemplateStep(n, e.Type, ant.Field)
+		if err != nil {
+			return nil, err
+		}
+
+		step.Edge = e.Name
+		steps = append(steps, step)
+	}
+
+	raw, ok := n.Annotations[CascadeThroughAnnotationName]
+	if !ok {
+		return steps, nil
+	}
+
+	ant := &CascadeThroughAnnotation{}
+	if err := DecodeAnnotation(raw, ant); err != nil {
+		return nil, fmt.Errorf("failed decoding cascade through annotation of %s: %w", n.Name, err)
+	}
+
+	for _, s := range ant.Schemas {
+		child := findNode(nodes, s.Through)
+		if child == nil {
+			return nil, fmt.Errorf("%w: cascade through schema %s of %s not found", ErrInvalidCascade, s.Through, n.Name)
+		}
+
+		step, err := newCascadeTemplateStep(n, child, s.Field)
+		if err != nil {
+			return nil, err
+		}
+
+		step.Through = true
+		steps = append(steps, step)
+	}
+
+	return steps, nil
+}
+
+// newCascadeTemplateStep returns the step deleting the child records referencing the parent through the field edge
+func newCascadeTemplateStep(parent, child *gen.Type, field string) (cascadeTemplateStep, error) {
+	var edge *gen.Edge
+
+	for _, e := range child.Edges {
+		if strings.EqualFold(e.Name, field) || strings.EqualFold(e.StructField(), field) {
+			edge = e
+			break
+		}
+	}
+
+	if edge == nil || edge.Type.Name != parent.Name {
+		return cascadeTemplateStep{}, fmt.Errorf("%w: %s has no edge %s to %s", ErrInvalidCascade, child.Name, field, parent.Name)
+	}
+
+	return cascadeTemplateStep{
+		CascadeStep: CascadeStep{
+			Parent: parent.Name,
+			Child:  child.Name,
+			Field:  edge.Name,
+			Soft:   isSoftDeletable(child),
+		},
+		ChildPackage: child.Package(),
+		Predicate:    "Has" + edge.StructField() + "With",
+	}, nil
+}
+
+// isSoftDeletable reports whether the schema has the soft delete fields
+func isSoftDeletable(n *gen.Type) bool {
+	return softDeleteFieldOf(n) != nil
+}
+
+// findNode returns the schema with the name
+func findNode(nodes []*gen.Type, name string) *gen.Type {
+	for _, n := range nodes {
+		if n.Name == name {
+			return n
+		}
+	}
+
+	return nil
+}
+
+// CascadeDeleteTemplate generates the cascade delete hooks and plans from the cascade annotations
+var CascadeDeleteTemplate = parseEntxTemplate("cascade_delete", "templates/cascade_delete.tmpl")
+
+// parseEntxTemplate parses the entx template with the helper functions
+func parseEntxTemplate(name, path string) *gen.Template {
+	t := gen.NewTemplate(name)
+	t.Funcs(template.FuncMap{
+		"cascadeSteps":     cascadeSteps,
+		"softDeletable":    isSoftDeletable,
+		"restorable":       isRestorable,
+		"restoreSteps":     restoreSteps,
+		"restoreUniques":   restoreUniques,
+		"softDeleteField":  softDeleteFieldOf,
+		"softDeleteFields": softDeleteFields,
+		"retentionNodes":   retentionNodes,
+		"durationLiteral":  durationLiteral,
+		"exportNodes":      exportNodes,
+		"encryptedNodes":   encryptedNodes,
+		"tagNodes":         tagNodes,
+		"orgScopedNodes":   orgScopedNodes,
+	})
+
+	return gen.MustParse(t.ParseFS(_templates, path))
+}
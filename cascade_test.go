@@ -0,0 +1,244 @@
+package entx_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"entgo.io/ent"
+	"entgo.io/ent/entc"
+	"entgo.io/ent/entc/gen"
+	"entgo.io/ent/entc/load"
+	"entgo.io/ent/schema"
+	"entgo.io/ent/schema/edge"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theopenlane/entx"
+	"github.com/theopenlane/entx/mixin"
+)
+
+// Organization soft deletes its groups and hard deletes its invites, which are not soft deletable
+type Organization struct{ ent.Schema }
+
+func (Organization) Fields() []ent.Field {
+	return []ent.Field{field.String("name")}
+}
+
+func (Organization) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.To("groups", Group.Type).Annotations(entx.CascadeAnnotationField("Owner")),
+		edge.To("invites", Invite.Type).Annotations(entx.CascadeAnnotationField("owner")),
+	}
+}
+
+func (Organization) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("name", "deleted_at").Unique(),
+	}
+}
+
+func (Organization) Mixin() []ent.Mixin {
+	return []ent.Mixin{mixin.SoftDeleteMixin{}}
+}
+
+// Group cleans up its memberships
+type Group struct{ ent.Schema }
+
+func (Group) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.From("owner", Organization.Type).Ref("groups").Unique(),
+		edge.To("memberships", Membership.Type),
+	}
+}
+
+func (Group) Annotations() []schema.Annotation {
+	return []schema.Annotation{
+		entx.CascadeThroughAnnotationField([]entx.ThroughCleanup{{Field: "Group", Through: "Membership"}}),
+	}
+}
+
+func (Group) Mixin() []ent.Mixin {
+	return []ent.Mixin{mixin.SoftDeleteMixin{}}
+}
+
+type Invite struct{ ent.Schema }
+
+func (Invite) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.From("owner", Organization.Type).Ref("invites").Unique(),
+	}
+}
+
+type Membership struct{ ent.Schema }
+
+func (Membership) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.From("group", Group.Type).Ref("memberships").Unique(),
+	}
+}
+
+// generateCascade runs the ent code generation with the cascade delete template for the schemas
+func generateCascade(t *testing.T, schemas ...ent.Interface) (string, error) {
+	t.Helper()
+
+	return generateTemplate(t, "cascade_delete.go", entx.WithCascadeDelete(), schemas...)
+}
+
+// generateTemplate runs the ent code generation with the extension option for the schemas and returns the generated file
+func generateTemplate(t *testing.T, file string, opt entx.ExtensionOption, schemas ...ent.Interface) (string, error) {
+	t.Helper()
+
+	loaded := make([]*load.Schema, 0, len(schemas))
+
+	for _, s := range schemas {
+		raw, err := load.MarshalSchema(s)
+		require.NoError(t, err)
+
+		ls, err := load.UnmarshalSchema(raw)
+		require.NoError(t, err)
+
+		loaded = append(loaded, ls)
+	}
+
+	ext, err := entx.NewExtension(opt)
+	require.NoError(t, err)
+
+	target := t.TempDir()
+
+	storage, err := gen.NewStorage("sql")
+	require.NoError(t, err)
+
+	graph, err := gen.NewGraph(&gen.Config{
+		Schema:    "example.com/cascade/schema",
+		Package:   "example.com/cascade/ent",
+		Target:    target,
+		Storage:   storage,
+		IDType:    &field.TypeInfo{Type: field.TypeInt},
+		Templates: ext.Templates(),
+	}, loaded...)
+	require.NoError(t, err)
+
+	if err := graph.Gen(); err != nil {
+		return "", err
+	}
+
+	out, err := os.ReadFile(filepath.Join(target, file))
+	require.NoError(t, err)
+
+	return string(out), nil
+}
+
+// generateClient generates the client of the schemas in testdata/<dir>/schema into testdata/<dir>/ent with the
+// features and extension options, the client is removed when the test ends
+func generateClient(t *testing.T, dir string, features []gen.Feature, opts ...entx.ExtensionOption) {
+	t.Helper()
+
+	ext, err := entx.NewExtension(opts...)
+	require.NoError(t, err)
+
+	target := "./testdata/" + dir + "/ent"
+
+	t.Cleanup(func() { os.RemoveAll(target) })
+
+	err = entc.Generate("./testdata/"+dir+"/schema", &gen.Config{
+		Target:   target,
+		Package:  "github.com/theopenlane/entx/testdata/" + dir + "/ent",
+		Features: features,
+	}, entc.Extensions(ext))
+	require.NoError(t, err)
+}
+
+func TestCascadeDeleteTemplate(t *testing.T) {
+	out, err := generateCascade(t, Organization{}, Group{}, Invite{}, Membership{})
+	require.NoError(t, err)
+
+	assert.Contains(t, out, `"Organization": {
+		{Parent: "Organization", Child: "Group", Edge: "groups", Field: "owner", Through: false, Soft: true},
+		{Parent: "Organization", Child: "Invite", Edge: "invites", Field: "owner", Through: false, Soft: false},
+	},`)
+	assert.Contains(t, out, `{Parent: "Group", Child: "Membership", Edge: "", Field: "group", Through: true, Soft: false},`)
+
+	assert.Contains(t, out, "func HookOrganizationCascadeDelete() Hook {")
+	assert.Contains(t, out, "func HookGroupCascadeDelete() Hook {")
+	assert.NotContains(t, out, "HookInviteCascadeDelete")
+
+	// soft deletes only cascade to the soft deletable children
+	assert.Contains(t, out, "client.Group.Delete().Where(group.HasOwnerWith(organization.IDIn(ids...))).Exec(ctx)")
+	assert.Contains(t, out, `if !soft {
+				if _, err := client.Invite.Delete().Where(invite.HasOwnerWith(organization.IDIn(ids...))).Exec(ctx); err != nil {`)
+	assert.Contains(t, out, "client.Membership.Delete().Where(membership.HasGroupWith(group.IDIn(ids...))).Exec(ctx)")
+
+	assert.Contains(t, out, "c.Organization.Use(HookOrganizationCascadeDelete())")
+	assert.Contains(t, out, "c.Group.Use(HookGroupCascadeDelete())")
+}
+
+// TestCascadeDeleteTemplateBuild generates the client of the testdata/cascade schemas, with parents cascading to
+// soft deletable children only, to hard deleted children only and to both, and builds it
+func TestCascadeDeleteTemplateBuild(t *testing.T) {
+	if testing.Short() {
+		t.Skip("generates and builds a client")
+	}
+
+	generateClient(t, "cascade", nil, entx.WithCascadeDelete())
+
+	out, err := exec.CommandContext(t.Context(), "go", "vet", "./testdata/cascade/...").CombinedOutput()
+	require.NoError(t, err, string(out))
+}
+
+func TestCascadeDeleteTemplateInvalid(t *testing.T) {
+	_, err := generateCascade(t, Group{}, Membership{}, Organization{}, Invite{})
+	require.NoError(t, err)
+
+	// the cascade edge must exist on the child
+	_, err = generateCascade(t, invalidCascade{}, invalidChild{})
+	assert.ErrorIs(t, err, entx.ErrInvalidCascade)
+}
+
+type invalidCascade struct{ ent.Schema }
+
+func (invalidCascade) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.To("children", invalidChild.Type).Annotations(entx.CascadeAnnotationField("Owner")),
+	}
+}
+
+type invalidChild struct{ ent.Schema }
+
+func (invalidChild) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.From("parent", invalidCascade.Type).Ref("children").Unique(),
+	}
+}
+
+func TestCascadePlan(t *testing.T) {
+	plans := map[string][]entx.CascadeStep{
+		"Organization": {
+			{Parent: "Organization", Child: "Group", Edge: "groups", Field: "owner", Soft: true},
+			{Parent: "Organization", Child: "Invite", Edge: "invites", Field: "owner"},
+		},
+		"Group": {
+			{Parent: "Group", Child: "Membership", Field: "group", Through: true},
+			{Parent: "Group", Child: "Organization", Edge: "parent", Field: "groups", Soft: true},
+		},
+	}
+
+	hard := entx.CascadePlan(plans, "Organization", false)
+
+	children := []string{}
+	for _, s := range hard {
+		children = append(children, s.Parent+">"+s.Child)
+	}
+
+	// children are deleted before their parents and cycles are not followed
+	assert.Equal(t, []string{"Group>Membership", "Organization>Group", "Organization>Invite"}, children)
+
+	soft := entx.CascadePlan(plans, "Organization", true)
+	require.Len(t, soft, 1)
+	assert.Equal(t, "Group", soft[0].Child)
+
+	assert.Empty(t, entx.CascadePlan(plans, "Invite", false))
+}
@@ -1,13 +1,127 @@
 package entx_test
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
+
+	"entgo.io/ent/dialect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
 
 	"github.com/theopenlane/entx"
+)
 
-	"github.com/stretchr/testify/assert"
+// standInDriver is a database/sql driver standing in for the mysql, postgres and libsql servers; it records
+// the data sources it was opened with and the statements executed on each connection
+type standInDriver struct {
+	mu    sync.Mutex
+	dsns  []string
+	execs map[int][]string
+	// failPings is the number of pings that fail before the stand-in is ready
+	failPings int
+	pings     int
+}
+
+var (
+	mysqlStandIn  = &standInDriver{}
+	pgxStandIn    = &standInDriver{}
+	libSQLStandIn = &standInDriver{}
 )
 
+func init() {
+	sql.Register("mysql", mysqlStandIn)
+	sql.Register("pgx", pgxStandIn)
+	sql.Register("libsql", libSQLStandIn)
+}
+
+func (d *standInDriver) Open(dsn string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.dsns = append(d.dsns, dsn)
+
+	return standInConn{driver: d, id: len(d.dsns)}, nil
+}
+
+// executed returns the statements executed on each connection opened
+func (d *standInDriver) executed() [][]string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	out := make([][]string, 0, len(d.dsns))
+	for id := 1; id <= len(d.dsns); id++ {
+		out = append(out, d.execs[id])
+	}
+
+	return out
+}
+
+func (d *standInDriver) opened() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]string(nil), d.dsns...)
+}
+
+// starting makes the next pings fail as if the server was still starting
+func (d *standInDriver) starting(failPings int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.failPings = failPings
+	d.pings = 0
+}
+
+type standInConn struct {
+	driver *standInDriver
+	id     int
+}
+
+func (c standInConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	c.driver.mu.Lock()
+	defer c.driver.mu.Unlock()
+
+	if c.driver.execs == nil {
+		c.driver.execs = map[int][]string{}
+	}
+
+	c.driver.execs[c.id] = append(c.driver.execs[c.id], query)
+
+	return driver.RowsAffected(0), nil
+}
+
+func (standInConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("stand-in does not run statements")
+}
+
+func (standInConn) Close() error { return nil }
+
+func (standInConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("stand-in does not run transactions")
+}
+
+func (c standInConn) Ping(context.Context) error {
+	c.driver.mu.Lock()
+	defer c.driver.mu.Unlock()
+
+	c.driver.pings++
+
+	if c.driver.failPings > 0 {
+		c.driver.failPings--
+
+		return driver.ErrBadConn
+	}
+
+	return nil
+}
+
 func TestCheckDialect(t *testing.T) {
 	testCases := []struct {
 		name     string
@@ -36,9 +150,24 @@ func TestCheckDialect(t *testing.T) {
 			expected: "postgres",
 		},
 		{
-			name:     "unsupported",
+			name:     "modernc sqlite",
+			dialect:  "sqlite",
+			expected: "sqlite3",
+		},
+		{
+			name:     "mysql",
 			dialect:  "mysql",
-			errorMsg: "unsupported dialect: mysql",
+			expected: "mysql",
+		},
+		{
+			name:     "cockroachdb",
+			dialect:  "cockroachdb",
+			expected: "postgres",
+		},
+		{
+			name:     "unsupported",
+			dialect:  "oracle",
+			errorMsg: "unsupported dialect: oracle",
 		},
 	}
 
@@ -75,14 +204,34 @@ func TestMultiWriteSupport(t *testing.T) {
 			dialect:  "libsql",
 			expected: true,
 		},
+		{
+			name:     "modernc sqlite",
+			dialect:  "sqlite",
+			expected: true,
+		},
 		{
 			name:     "postgres",
 			dialect:  "postgres",
+			expected: true,
+		},
+		{
+			name:     "pgx",
+			dialect:  "pgx",
+			expected: true,
+		},
+		{
+			name:     "mysql",
+			dialect:  "mysql",
+			expected: true,
+		},
+		{
+			name:     "cockroachdb",
+			dialect:  "cockroachdb",
 			expected: false,
 		},
 		{
 			name:     "unsupported",
-			dialect:  "mysql",
+			dialect:  "oracle",
 			expected: false,
 		},
 	}
@@ -95,3 +244,367 @@ func TestMultiWriteSupport(t *testing.T) {
 		})
 	}
 }
+
+func TestNewDBConfigDialects(t *testing.T) {
+	testCases := []struct {
+		name       string
+		driverName string
+		source     func(t *testing.T) string
+		dialect    string
+		standIn    *standInDriver
+		standInDSN string
+		maxOpen    int
+	}{
+		{
+			name:       "sqlite3",
+			driverName: entx.DriverSQLite3,
+			source:     func(t *testing.T) string { return filepath.Join(t.TempDir(), "sqlite3.db") },
+			dialect:    dialect.SQLite,
+		},
+		{
+			name:       "modernc sqlite",
+			driverName: entx.DriverSQLite,
+			source:     func(t *testing.T) string { return "file:" + filepath.Join(t.TempDir(), "sqlite.db") },
+			dialect:    dialect.SQLite,
+		},
+		{
+			name:       "modernc sqlite in memory",
+			driverName: entx.DriverSQLite,
+			source:     func(*testing.T) string { return ":memory:" },
+			dialect:    dialect.SQLite,
+			maxOpen:    1,
+		},
+		{
+			name:       "sqlite3 in memory with settings",
+			driverName: entx.DriverSQLite3,
+			source:     func(*testing.T) string { return "file:entx?mode=memory&cache=shared&_fk=1" },
+			dialect:    dialect.SQLite,
+			maxOpen:    1,
+		},
+		{
+			name:       "mysql",
+			driverName: entx.DriverMySQL,
+			source:     func(*testing.T) string { return "root:pass@tcp(localhost:3306)/entx" },
+			dialect:    dialect.MySQL,
+			standIn:    mysqlStandIn,
+			standInDSN: "root:pass@tcp(localhost:3306)/entx?parseTime=true",
+		},
+		{
+			name:       "mysql with parse time",
+			driverName: entx.DriverMySQL,
+			source:     func(*testing.T) string { return "root:pass@tcp(localhost:3306)/entx?parseTime=false" },
+			dialect:    dialect.MySQL,
+			standIn:    mysqlStandIn,
+			standInDSN: "root:pass@tcp(localhost:3306)/entx?parseTime=false",
+		},
+		{
+			name:       "pgx",
+			driverName: entx.DriverPGX,
+			source:     func(*testing.T) string { return "postgres://postgres@localhost:5432/entx" },
+			dialect:    dialect.Postgres,
+			standIn:    pgxStandIn,
+			standInDSN: "postgres://postgres@localhost:5432/entx",
+		},
+		{
+			name:       "cockroachdb",
+			driverName: entx.DriverCockroachDB,
+			source:     func(*testing.T) string { return "postgres://root@localhost:26257/entx" },
+			dialect:    dialect.Postgres,
+			standIn:    pgxStandIn,
+			standInDSN: "postgres://root@localhost:26257/entx",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ec, err := entx.NewDBConfig(entx.Config{
+				DriverName:      tc.driverName,
+				PrimaryDBSource: tc.source(t),
+			})
+			require.NoError(t, err)
+
+			drv := ec.GetPrimaryDB()
+			t.Cleanup(func() { drv.Close() })
+
+			assert.Equal(t, tc.dialect, drv.Dialect())
+
+			if tc.standIn != nil {
+				assert.Contains(t, tc.standIn.opened(), tc.standInDSN)
+
+				return
+			}
+
+			assert.Equal(t, tc.maxOpen, drv.DB().Stats().MaxOpenConnections)
+
+			db := drv.DB()
+			ctx := context.Background()
+
+			_, err = db.ExecContext(ctx, "CREATE TABLE parents (id integer PRIMARY KEY)")
+			require.NoError(t, err)
+
+			_, err = db.ExecContext(ctx, "CREATE TABLE children (id integer PRIMARY KEY, parent_id integer REFERENCES parents (id))")
+			require.NoError(t, err)
+
+			// foreign keys are enforced
+			_, err = db.ExecContext(ctx, "INSERT INTO children (id, parent_id) VALUES (1, 1)")
+			assert.ErrorContains(t, err, "FOREIGN KEY")
+		})
+	}
+}
+
+func TestNewDBConfigDataSource(t *testing.T) {
+	testCases := []struct {
+		name     string
+		config   entx.Config
+		standIn  *standInDriver
+		expected string
+	}{
+		{
+			name: "postgres url statement timeout",
+			config: entx.Config{
+				DriverName:       entx.DriverPGX,
+				PrimaryDBSource:  "postgres://postgres@localhost:5432/timeout?sslmode=disable",
+				StatementTimeout: 5 * time.Second,
+			},
+			standIn:  pgxStandIn,
+			expected: "postgres://postgres@localhost:5432/timeout?sslmode=disable&statement_timeout=5000",
+		},
+		{
+			name: "postgres key value statement timeout",
+			config: entx.Config{
+				DriverName:       entx.DriverCockroachDB,
+				PrimaryDBSource:  "host=localhost dbname=timeout",
+				StatementTimeout: 250 * time.Millisecond,
+			},
+			standIn:  pgxStandIn,
+			expected: "host=localhost dbname=timeout statement_timeout=250",
+		},
+		{
+			name: "mysql statement timeout",
+			config: entx.Config{
+				DriverName:       entx.DriverMySQL,
+				PrimaryDBSource:  "root@tcp(localhost:3306)/timeout",
+				StatementTimeout: time.Second,
+			},
+			standIn:  mysqlStandIn,
+			expected: "root@tcp(localhost:3306)/timeout?parseTime=true&max_execution_time=1000",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ec, err := entx.NewDBConfig(tc.config)
+			require.NoError(t, err)
+
+			t.Cleanup(func() { ec.GetPrimaryDB().Close() })
+
+			assert.Contains(t, tc.standIn.opened(), tc.expected)
+		})
+	}
+}
+
+func TestNewDBConfigPool(t *testing.T) {
+	ec, err := entx.NewDBConfig(entx.Config{
+		DriverName:         entx.DriverPGX,
+		PrimaryDBSource:    "postgres://postgres@localhost:5432/pool",
+		MaxConnections:     10,
+		MaxIdleConnections: 2,
+		ConnMaxLifetime:    time.Minute,
+		ConnMaxIdleTime:    time.Second,
+	})
+	require.NoError(t, err)
+
+	t.Cleanup(func() { ec.GetPrimaryDB().Close() })
+
+	assert.Equal(t, 10, ec.GetPrimaryDB().DB().Stats().MaxOpenConnections)
+}
+
+func TestNewDBConfigSQLitePragmas(t *testing.T) {
+	for _, driverName := range []string{entx.DriverSQLite3, entx.DriverSQLite} {
+		t.Run(driverName, func(t *testing.T) {
+			ec, err := entx.NewDBConfig(entx.Config{
+				DriverName:        driverName,
+				PrimaryDBSource:   "file:" + filepath.Join(t.TempDir(), "pragma.db"),
+				SQLiteBusyTimeout: 3 * time.Second,
+				SQLiteJournalMode: "wal",
+			})
+			require.NoError(t, err)
+
+			db := ec.GetPrimaryDB().DB()
+			t.Cleanup(func() { db.Close() })
+
+			var (
+				busyTimeout int
+				journalMode string
+			)
+
+			require.NoError(t, db.QueryRow("PRAGMA busy_timeout").Scan(&busyTimeout))
+			require.NoError(t, db.QueryRow("PRAGMA journal_mode").Scan(&journalMode))
+
+			assert.Equal(t, 3000, busyTimeout)
+			assert.Equal(t, "wal", journalMode)
+		})
+	}
+}
+
+func TestNewDBConfigLibSQLPragmas(t *testing.T) {
+	ctx := context.Background()
+
+	ec, err := entx.NewDBConfig(entx.Config{
+		DriverName:        entx.DriverLibSQL,
+		PrimaryDBSource:   "libsql://entx.turso.io",
+		SQLiteBusyTimeout: 3 * time.Second,
+	})
+	require.NoError(t, err)
+
+	db := ec.GetPrimaryDB().DB()
+	t.Cleanup(func() { db.Close() })
+
+	// libsql does not accept the pragmas in the data source
+	assert.Equal(t, []string{"libsql://entx.turso.io"}, libSQLStandIn.opened())
+
+	conns := make([]*sql.Conn, 0, 3)
+
+	for range 3 {
+		conn, err := db.Conn(ctx)
+		require.NoError(t, err)
+
+		conns = append(conns, conn)
+	}
+
+	for _, conn := range conns {
+		require.NoError(t, conn.Close())
+	}
+
+	// every connection of the pool has the pragmas set
+	executed := libSQLStandIn.executed()
+	require.Len(t, executed, 3)
+
+	for _, execs := range executed {
+		assert.Equal(t, []string{"PRAGMA foreign_keys = on;", "PRAGMA busy_timeout = 3000;"}, execs)
+	}
+}
+
+func TestNewDBConfigPingRetry(t *testing.T) {
+	config := entx.Config{
+		DriverName:      entx.DriverPGX,
+		PrimaryDBSource: "postgres://postgres@localhost:5432/starting",
+		PingRetries:     3,
+		PingBackoff:     time.Millisecond,
+	}
+
+	pgxStandIn.starting(2)
+
+	ec, err := entx.NewDBConfig(config)
+	require.NoError(t, err)
+	ec.GetPrimaryDB().Close()
+
+	pgxStandIn.starting(5)
+
+	_, err = entx.NewDBConfig(config)
+	require.ErrorContains(t, err, "failed verifying database connection")
+
+	pgxStandIn.starting(0)
+}
+
+func TestWithSecondaryDBErrors(t *testing.T) {
+	_, err := entx.NewDBConfig(entx.Config{
+		DriverName:        entx.DriverCockroachDB,
+		PrimaryDBSource:   "postgres://root@localhost:26257/entx",
+		SecondaryDBSource: "postgres://root@localhost:26258/entx",
+	}, entx.WithSecondaryDB())
+	require.ErrorIs(t, err, entx.ErrMultiwriteUnsupported)
+
+	_, err = entx.NewDBConfig(entx.Config{
+		DriverName:        entx.DriverCockroachDB,
+		PrimaryDBSource:   "postgres://root@localhost:26257/entx",
+		SecondaryDBSource: "postgres://root@localhost:26258/entx",
+	}, entx.WithDegradedSecondaryDB(time.Second))
+	require.ErrorIs(t, err, entx.ErrMultiwriteUnsupported)
+
+	// a secondary that cannot be connected fails the config instead of exiting the process
+	_, err = entx.NewDBConfig(entx.Config{
+		DriverName:        entx.DriverSQLite3,
+		PrimaryDBSource:   filepath.Join(t.TempDir(), "primary.db"),
+		SecondaryDBSource: filepath.Join(t.TempDir(), "missing", "secondary.db"),
+	}, entx.WithSecondaryDB())
+	require.ErrorContains(t, err, "failed to create secondary db connection")
+}
+
+func TestConfigValidate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		config   entx.Config
+		errorMsg []string
+	}{
+		{
+			name: "valid",
+			config: entx.Config{
+				DriverName:        entx.DriverSQLite,
+				MaxConnections:    10,
+				SQLiteJournalMode: "WAL",
+				SQLiteBusyTimeout: time.Second,
+			},
+		},
+		{
+			name:     "unsupported driver",
+			config:   entx.Config{DriverName: "oracle"},
+			errorMsg: []string{"unsupported dialect: oracle"},
+		},
+		{
+			name: "invalid pool",
+			config: entx.Config{
+				DriverName:         entx.DriverPGX,
+				MaxConnections:     2,
+				MaxIdleConnections: 5,
+				ConnMaxLifetime:    -time.Second,
+				PingRetries:        -1,
+			},
+			errorMsg: []string{
+				"maxidleconnections must not be greater than maxconnections",
+				"connmaxlifetime must not be negative",
+				"pingretries must not be negative",
+			},
+		},
+		{
+			name: "sqlite statement timeout",
+			config: entx.Config{
+				DriverName:       entx.DriverSQLite3,
+				StatementTimeout: time.Second,
+			},
+			errorMsg: []string{"statementtimeout is not supported by sqlite"},
+		},
+		{
+			name: "unknown journal mode",
+			config: entx.Config{
+				DriverName:        entx.DriverSQLite3,
+				SQLiteJournalMode: "fast",
+			},
+			errorMsg: []string{"sqlitejournalmode must be one of"},
+		},
+		{
+			name: "unknown replica selection",
+			config: entx.Config{
+				DriverName:       entx.DriverPGX,
+				ReplicaSelection: "random",
+			},
+			errorMsg: []string{"unsupported replica selection: random"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.config.Validate()
+
+			if len(tc.errorMsg) == 0 {
+				assert.NoError(t, err)
+
+				return
+			}
+
+			for _, msg := range tc.errorMsg {
+				assert.ErrorContains(t, err, msg)
+			}
+		})
+	}
+}
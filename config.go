@@ -0,0 +1,276 @@
+package entx
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"entgo.io/ent/dialect"
+	"github.com/XSAM/otelsql"
+)
+
+// sqliteJournalModes are the journal modes accepted by sqlite
+var sqliteJournalModes = []string{"delete", "truncate", "persist", "memory", "wal", "off"}
+
+// Validate checks the settings are supported by the driver and returns all the problems found
+func (c Config) Validate() error {
+	var errs []error
+
+	entDialect, err := CheckEntDialect(c.DriverName)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := ParseReplicaSelection(c.ReplicaSelection); err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.MaxConnections < 0 {
+		errs = append(errs, newConfigError("maxconnections", "must not be negative"))
+	}
+
+	if c.MaxIdleConnections < 0 {
+		errs = append(errs, newConfigError("maxidleconnections", "must not be negative"))
+	}
+
+	if c.MaxConnections > 0 && c.MaxIdleConnections > c.MaxConnections {
+		errs = append(errs, newConfigError("maxidleconnections", "must not be greater than maxconnections"))
+	}
+
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"cachettl", c.CacheTTL},
+		{"connmaxlifetime", c.ConnMaxLifetime},
+		{"connmaxidletime", c.ConnMaxIdleTime},
+		{"statementtimeout", c.StatementTimeout},
+		{"pingbackoff", c.PingBackoff},
+		{"sqlitebusytimeout", c.SQLiteBusyTimeout},
+		{"slowquerythreshold", c.SlowQueryThreshold},
+	}
+
+	for _, d := range durations {
+		if d.value < 0 {
+			errs = append(errs, newConfigError(d.name, "must not be negative"))
+		}
+	}
+
+	if c.PingRetries < 0 {
+		errs = append(errs, newConfigError("pingretries", "must not be negative"))
+	}
+
+	if c.StatementTimeout > 0 && entDialect == dialect.SQLite {
+		errs = append(errs, newConfigError("statementtimeout", "is not supported by sqlite"))
+	}
+
+	if c.SQLiteJournalMode != "" && !slices.Contains(sqliteJournalModes, strings.ToLower(c.SQLiteJournalMode)) {
+		errs = append(errs, newConfigError("sqlitejournalmode", "must be one of "+strings.Join(sqliteJournalModes, ", ")))
+	}
+
+	return errors.Join(errs...)
+}
+
+// prepareDataSource adds the settings the driver needs to the data source unless they are set already:
+// foreign keys are enabled and pragmas set for sqlite, mysql times are parsed into time.Time, as expected
+// by ent, and the statement timeout is set for the servers supporting it
+func prepareDataSource(c Config, dataSource string) string {
+	switch c.DriverName {
+	case DriverSQLite3:
+		if !hasDataSourceParam(dataSource, "_fk") && !hasDataSourceParam(dataSource, "_foreign_keys") {
+			dataSource = addDataSourceParam(dataSource, "_fk=1")
+		}
+
+		if c.SQLiteBusyTimeout > 0 && !hasDataSourceParam(dataSource, "_busy_timeout") && !hasDataSourceParam(dataSource, "_timeout") {
+			dataSource = addDataSourceParam(dataSource, "_busy_timeout="+milliseconds(c.SQLiteBusyTimeout))
+		}
+
+		if c.SQLiteJournalMode != "" && !hasDataSourceParam(dataSource, "_journal_mode") && !hasDataSourceParam(dataSource, "_journal") {
+			dataSource = addDataSourceParam(dataSource, "_journal_mode="+strings.ToUpper(c.SQLiteJournalMode))
+		}
+	case DriverSQLite:
+		dataSource = addSQLitePragma(dataSource, "foreign_keys", "1")
+
+		if c.SQLiteBusyTimeout > 0 {
+			dataSource = addSQLitePragma(dataSource, "busy_timeout", milliseconds(c.SQLiteBusyTimeout))
+		}
+
+		if c.SQLiteJournalMode != "" {
+			dataSource = addSQLitePragma(dataSource, "journal_mode", strings.ToUpper(c.SQLiteJournalMode))
+		}
+	case DriverMySQL:
+		if !hasDataSourceParam(dataSource, "parseTime") {
+			dataSource = addDataSourceParam(dataSource, "parseTime=true")
+		}
+
+		if c.StatementTimeout > 0 && !hasDataSourceParam(dataSource, "max_execution_time") {
+			dataSource = addDataSourceParam(dataSource, "max_execution_time="+milliseconds(c.StatementTimeout))
+		}
+	case DriverPostgres, DriverPGX, DriverCockroachDB:
+		if c.StatementTimeout > 0 && !strings.Contains(dataSource, "statement_timeout") {
+			// key value data sources are space separated
+			if !strings.Contains(dataSource, "://") {
+				return strings.TrimSpace(dataSource) + " statement_timeout=" + milliseconds(c.StatementTimeout)
+			}
+
+			dataSource = addDataSourceParam(dataSource, "statement_timeout="+milliseconds(c.StatementTimeout))
+		}
+	}
+
+	return dataSource
+}
+
+// libSQLPragmas returns the pragmas set on libsql connections
+func libSQLPragmas(c Config) []string {
+	pragmas := []string{"foreign_keys = on"}
+
+	if c.SQLiteBusyTimeout > 0 {
+		pragmas = append(pragmas, "busy_timeout = "+milliseconds(c.SQLiteBusyTimeout))
+	}
+
+	if c.SQLiteJournalMode != "" {
+		pragmas = append(pragmas, "journal_mode = "+strings.ToUpper(c.SQLiteJournalMode))
+	}
+
+	return pragmas
+}
+
+// openWithConnPragmas opens the database with the pragmas set on every connection of the pool, for the drivers not
+// accepting them in the data source; a pragma run on the pool would only reach the connection it ran on
+func openWithConnPragmas(driverName, dataSource string, pragmas []string, opts ...otelsql.Option) (*sql.DB, error) {
+	db, err := sql.Open(driverName, dataSource)
+	if err != nil {
+		return nil, err
+	}
+
+	drv := db.Driver()
+
+	if err := db.Close(); err != nil {
+		return nil, err
+	}
+
+	var connector driver.Connector = dsnConnector{dsn: dataSource, driver: drv}
+
+	if dc, ok := drv.(driver.DriverContext); ok {
+		if connector, err = dc.OpenConnector(dataSource); err != nil {
+			return nil, err
+		}
+	}
+
+	return otelsql.OpenDB(pragmaConnector{Connector: connector, pragmas: pragmas}, opts...), nil
+}
+
+// dsnConnector opens the connections of a driver without a connector
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+// Connect opens a connection to the data source
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+// Driver returns the driver of the connections
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// pragmaConnector sets the pragmas on the connections it opens
+type pragmaConnector struct {
+	driver.Connector
+
+	pragmas []string
+}
+
+// Connect opens a connection and sets the pragmas on it
+func (c pragmaConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pragma := range c.pragmas {
+		if err := execConn(ctx, conn, "PRAGMA "+pragma+";"); err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to set %s: %w", pragma, err), conn.Close())
+		}
+	}
+
+	return conn, nil
+}
+
+// execConn runs the statement without arguments on the driver connection
+func execConn(ctx context.Context, conn driver.Conn, query string) error {
+	if e, ok := conn.(driver.ExecerContext); ok {
+		_, err := e.ExecContext(ctx, query, nil)
+		if !errors.Is(err, driver.ErrSkip) {
+			return err
+		}
+	}
+
+	stmt, err := conn.Prepare(query)
+	if err != nil {
+		return err
+	}
+
+	defer stmt.Close()
+
+	if s, ok := stmt.(driver.StmtExecContext); ok {
+		_, err = s.ExecContext(ctx, nil)
+	} else {
+		_, err = stmt.Exec(nil) //nolint:staticcheck // the driver does not implement StmtExecContext
+	}
+
+	return err
+}
+
+// hasDataSourceParam reports whether the query parameter is set in the data source
+func hasDataSourceParam(dataSource, key string) bool {
+	_, query, _ := strings.Cut(dataSource, "?")
+
+	for _, param := range strings.Split(query, "&") {
+		if k, _, _ := strings.Cut(param, "="); k == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addDataSourceParam appends the query parameter to the data source
+func addDataSourceParam(dataSource, param string) string {
+	if !strings.Contains(dataSource, "?") {
+		return dataSource + "?" + param
+	}
+
+	if strings.HasSuffix(dataSource, "?") || strings.HasSuffix(dataSource, "&") {
+		return dataSource + param
+	}
+
+	return dataSource + "&" + param
+}
+
+// addSQLitePragma adds the modernc.org/sqlite pragma parameter unless the pragma is already set
+func addSQLitePragma(dataSource, name, value string) string {
+	if strings.Contains(dataSource, name) {
+		return dataSource
+	}
+
+	return addDataSourceParam(dataSource, "_pragma="+name+"("+value+")")
+}
+
+// isInMemorySQLite reports whether the sqlite data source is an in-memory database
+func isInMemorySQLite(dataSource string) bool {
+	return strings.Contains(dataSource, ":memory:") || strings.Contains(dataSource, "mode=memory")
+}
+
+// milliseconds formats the duration as whole milliseconds
+func milliseconds(d time.Duration) string {
+	return strconv.FormatInt(d.Milliseconds(), 10)
+}
@@ -0,0 +1,272 @@
+package entx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"entgo.io/ent/dialect"
+	entsql "entgo.io/ent/dialect/sql"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultSecondaryRetryInterval is the default wait between secondary connection attempts in degraded mode
+const DefaultSecondaryRetryInterval = 30 * time.Second
+
+// WithDegradedSecondaryDB sets the secondary db connection like WithSecondaryDB, but the client starts with
+// only the primary and connects the secondary in the background, retrying at the interval until it succeeds.
+// Writes made before the secondary is connected are only applied to the primary, they are counted as divergences and
+// the health check reports the secondary stale until the client is restarted once the databases are in sync again
+func WithDegradedSecondaryDB(retryInterval time.Duration) DBOption {
+	return func(c *EntClientConfig) error {
+		if !CheckMultiwriteSupport(c.config.DriverName) {
+			return newMultiwriteError(c.config.DriverName)
+		}
+
+		if retryInterval <= 0 {
+			retryInterval = DefaultSecondaryRetryInterval
+		}
+
+		c.secondaryRetry = retryInterval
+		c.secondaryErr = ErrSecondaryNotConnected
+
+		return nil
+	}
+}
+
+// SecondaryError returns why the secondary is not connected in degraded mode, nil once it is connected
+func (c *EntClientConfig) SecondaryError() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.secondaryErr
+}
+
+// startSecondaryRetry connects the secondary in the background until it succeeds or the driver is closed
+func (c *EntClientConfig) startSecondaryRetry() {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.stopSecondary = cancel
+
+	go c.connectSecondary(ctx)
+}
+
+// connectSecondary tries to connect the secondary at the retry interval
+func (c *EntClientConfig) connectSecondary(ctx context.Context) {
+	for {
+		drv, err := c.newEntDB(ctx, c.config.SecondaryDBSource)
+		if err == nil {
+			if !c.setSecondary(ctx, drv) {
+				drv.Close()
+			}
+
+			return
+		}
+
+		c.mu.Lock()
+		c.secondaryErr = errors.Join(ErrSecondaryNotConnected, err)
+		c.mu.Unlock()
+
+		log.Warn().Err(err).Dur("retry", c.secondaryRetry).Msg("secondary database unavailable, running with the primary only")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.secondaryRetry):
+		}
+	}
+}
+
+// setSecondary pairs the connected secondary with the primary, it returns false when the
+// driver was closed while connecting
+func (c *EntClientConfig) setSecondary(ctx context.Context, drv *entsql.Driver) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ctx.Err() != nil {
+		return false
+	}
+
+	mw := &MultiWriteDriver{Wp: c.primaryDB, Ws: drv}
+
+	if c.degraded != nil && !c.degraded.upgrade(mw) {
+		return false
+	}
+
+	c.secondaryDB = drv
+	c.secondaryErr = nil
+	c.multiWrite = mw
+
+	var missed int64
+	if c.degraded != nil {
+		missed = c.degraded.missed.Load()
+	}
+
+	if missed > 0 {
+		log.Warn().Int64("missed", missed).Msg("secondary database connected without the writes made before, it is stale until resynced")
+	} else {
+		log.Info().Msg("secondary database connected, writes are sent to both databases")
+	}
+
+	return true
+}
+
+// missedWrites returns the number of writes applied to the primary only before the secondary was connected
+func (c *EntClientConfig) missedWrites() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.degraded == nil {
+		return 0
+	}
+
+	return c.degraded.missed.Load()
+}
+
+// degradedDriver sends the statements to the primary until the secondary is connected and to the
+// multi-write driver afterwards; transactions keep the driver they were started on
+type degradedDriver struct {
+	mu       sync.RWMutex
+	drv      dialect.Driver
+	upgraded bool
+	closed   bool
+	stop     context.CancelFunc
+
+	// missed is the number of writes applied to the primary only
+	missed atomic.Int64
+}
+
+var _ dialect.Driver = (*degradedDriver)(nil)
+
+// Query runs the query on the current driver
+func (d *degradedDriver) Query(ctx context.Context, query string, args, v any) error {
+	return d.current().Query(ctx, query, args, v)
+}
+
+// Exec runs the statement on the current driver
+func (d *degradedDriver) Exec(ctx context.Context, query string, args, v any) error {
+	drv, primaryOnly := d.writer()
+
+	if err := drv.Exec(ctx, query, args, v); err != nil {
+		return err
+	}
+
+	if primaryOnly {
+		d.missed.Add(1)
+	}
+
+	return nil
+}
+
+// Tx starts a transaction on the current driver
+func (d *degradedDriver) Tx(ctx context.Context) (dialect.Tx, error) {
+	drv, primaryOnly := d.writer()
+
+	tx, err := drv.Tx(ctx)
+	if err != nil || !primaryOnly {
+		return tx, err
+	}
+
+	return &degradedTx{Tx: tx, driver: d}, nil
+}
+
+// BeginTx calls the current driver BeginTx command if it is supported and falls back to Tx otherwise
+func (d *degradedDriver) BeginTx(ctx context.Context, opts *sql.TxOptions) (dialect.Tx, error) {
+	drv, primaryOnly := d.writer()
+
+	b, ok := drv.(interface {
+		BeginTx(context.Context, *sql.TxOptions) (dialect.Tx, error)
+	})
+	if !ok {
+		return d.Tx(ctx)
+	}
+
+	tx, err := b.BeginTx(ctx, opts)
+	if err != nil || !primaryOnly {
+		return tx, err
+	}
+
+	return &degradedTx{Tx: tx, driver: d}, nil
+}
+
+// Close stops connecting the secondary and closes the current driver
+func (d *degradedDriver) Close() error {
+	d.mu.Lock()
+	d.closed = true
+	drv := d.drv
+	d.mu.Unlock()
+
+	d.stop()
+
+	return drv.Close()
+}
+
+// Dialect returns the dialect name of the current driver
+func (d *degradedDriver) Dialect() string {
+	return d.current().Dialect()
+}
+
+// current returns the driver the statements are sent to
+func (d *degradedDriver) current() dialect.Driver {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.drv
+}
+
+// writer returns the driver the statements are sent to and whether it is the primary only
+func (d *degradedDriver) writer() (dialect.Driver, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.drv, !d.upgraded
+}
+
+// upgrade switches to the multi-write driver unless the driver is closed
+func (d *degradedDriver) upgrade(drv dialect.Driver) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return false
+	}
+
+	d.drv = drv
+	d.upgraded = true
+
+	return true
+}
+
+// degradedTx is a transaction on the primary only, its commit is counted as a missed write when it executed statements
+type degradedTx struct {
+	dialect.Tx
+
+	driver *degradedDriver
+	writes bool
+}
+
+// Exec runs the statement in the primary transaction
+func (tx *degradedTx) Exec(ctx context.Context, query string, args, v any) error {
+	if err := tx.Tx.Exec(ctx, query, args, v); err != nil {
+		return err
+	}
+
+	tx.writes = true
+
+	return nil
+}
+
+// Commit commits the primary transaction
+func (tx *degradedTx) Commit() error {
+	if err := tx.Tx.Commit(); err != nil {
+		return err
+	}
+
+	if tx.writes {
+		tx.driver.missed.Add(1)
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package entx_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	entsql "entgo.io/ent/dialect/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theopenlane/entx"
+)
+
+func countRows(t *testing.T, drv *entsql.Driver) int {
+	t.Helper()
+
+	var count int
+	require.NoError(t, drv.DB().QueryRow("SELECT COUNT(*) FROM users").Scan(&count))
+
+	return count
+}
+
+func TestDegradedSecondaryDB(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// the secondary cannot be opened until its directory exists
+	secondaryDir := filepath.Join(dir, "secondary")
+
+	ec, err := entx.NewDBConfig(entx.Config{
+		DriverName:        entx.DriverSQLite3,
+		PrimaryDBSource:   filepath.Join(dir, "primary.db"),
+		SecondaryDBSource: filepath.Join(secondaryDir, "secondary.db"),
+	}, entx.WithDegradedSecondaryDB(10*time.Millisecond))
+	require.NoError(t, err)
+
+	drv := ec.GetDriver()
+	t.Cleanup(func() { drv.Close() })
+
+	require.Nil(t, ec.GetSecondaryDB())
+	require.ErrorIs(t, ec.SecondaryError(), entx.ErrSecondaryNotConnected)
+
+	// writes go to the primary only while the secondary is not connected
+	require.NoError(t, drv.Exec(ctx, "CREATE TABLE users (id integer PRIMARY KEY)", []any{}, nil))
+
+	tx, err := drv.Tx(ctx)
+	require.NoError(t, err)
+	require.NoError(t, tx.Exec(ctx, "INSERT INTO users (id) VALUES (?)", []any{1}, nil))
+	require.NoError(t, tx.Commit())
+
+	// transactions without statements executed are not writes
+	tx, err = drv.Tx(ctx)
+	require.NoError(t, err)
+	require.NoError(t, tx.Query(ctx, "SELECT COUNT(*) FROM users", []any{}, &entsql.Rows{}))
+	require.NoError(t, tx.Commit())
+
+	assert.Equal(t, 1, countRows(t, ec.GetPrimaryDB()))
+
+	report := entx.NewHealthChecker(ec).Check(ctx)
+	assert.Equal(t, entx.HealthStatusDegraded, report.Status)
+	assert.Equal(t, entx.HealthStatusDown, report.Databases[1].Status)
+	assert.Contains(t, report.Databases[1].Error, entx.ErrSecondaryNotConnected.Error())
+
+	require.NoError(t, os.Mkdir(secondaryDir, 0o700))
+
+	require.Eventually(t, func() bool { return ec.GetSecondaryDB() != nil }, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, ec.SecondaryError())
+
+	// once connected, writes are sent to both databases
+	require.NoError(t, ec.GetSecondaryDB().Exec(ctx, "CREATE TABLE users (id integer PRIMARY KEY)", []any{}, nil))
+	require.NoError(t, drv.Exec(ctx, "INSERT INTO users (id) VALUES (?)", []any{2}, nil))
+
+	assert.Equal(t, 2, countRows(t, ec.GetPrimaryDB()))
+	assert.Equal(t, 1, countRows(t, ec.GetSecondaryDB()))
+
+	// the secondary misses the table and the row written before it was connected
+	report = entx.NewHealthChecker(ec).Check(ctx)
+	assert.Equal(t, entx.HealthStatusDegraded, report.Status)
+	assert.Equal(t, entx.HealthStatusUp, report.Databases[1].Status)
+	assert.Equal(t, int64(2), report.Replication.Divergences)
+	assert.Contains(t, report.Replication.Error, entx.ErrSecondaryStale.Error())
+}
+
+func TestDegradedSecondaryDBConnectedBeforeWrites(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	ec, err := entx.NewDBConfig(entx.Config{
+		DriverName:        entx.DriverSQLite3,
+		PrimaryDBSource:   filepath.Join(dir, "primary.db"),
+		SecondaryDBSource: filepath.Join(dir, "secondary.db"),
+	}, entx.WithDegradedSecondaryDB(10*time.Millisecond))
+	require.NoError(t, err)
+
+	drv := ec.GetDriver()
+	t.Cleanup(func() { drv.Close() })
+
+	require.Eventually(t, func() bool { return ec.GetSecondaryDB() != nil }, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, drv.Exec(ctx, "CREATE TABLE users (id integer PRIMARY KEY)", []any{}, nil))
+	require.NoError(t, drv.Exec(ctx, "INSERT INTO users (id) VALUES (?)", []any{1}, nil))
+	assert.Equal(t, 1, countRows(t, ec.GetSecondaryDB()))
+
+	report := entx.NewHealthChecker(ec).Check(ctx)
+	assert.Equal(t, entx.HealthStatusUp, report.Status)
+	assert.Zero(t, report.Replication.Divergences)
+}
+
+func TestDegradedSecondaryDBClose(t *testing.T) {
+	ec, err := entx.NewDBConfig(entx.Config{
+		DriverName:        entx.DriverSQLite3,
+		PrimaryDBSource:   filepath.Join(t.TempDir(), "primary.db"),
+		SecondaryDBSource: filepath.Join(t.TempDir(), "missing", "secondary.db"),
+	}, entx.WithDegradedSecondaryDB(10*time.Millisecond))
+	require.NoError(t, err)
+
+	// closing the driver stops connecting the secondary
+	require.NoError(t, ec.GetDriver().Close())
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Nil(t, ec.GetSecondaryDB())
+}
@@ -0,0 +1,722 @@
+package entx
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"entgo.io/ent/entc/gen"
+	"entgo.io/ent/schema/field"
+	"github.com/rs/zerolog/log"
+	"github.com/theopenlane/utils/contextx"
+)
+
+// EncryptedValuePrefix prefixes the values encrypted by a FieldEncryptor, it is followed by the id of the key and the
+// base64 encoded ciphertext, e.g. entx:enc:v1:2024-05:<ciphertext>
+const EncryptedValuePrefix = "entx:enc:v1:"
+
+// EncryptedMapKey is the key of the map holding the ciphertext of an encrypted map field
+const EncryptedMapKey = "_entx_encrypted"
+
+// DefaultRotationBatchSize is the number of records re-encrypted per batch
+const DefaultRotationBatchSize = 500
+
+var decryptionSkipKey = contextx.NewKey[bool]()
+
+// SkipDecryption returns a new context that skips the decryption interceptors, the records are read with their
+// ciphertext
+func SkipDecryption(parent context.Context) context.Context {
+	return decryptionSkipKey.Set(parent, true)
+}
+
+// CheckSkipDecryption checks whether skipping the decryption was requested
+func CheckSkipDecryption(ctx context.Context) bool {
+	skip, _ := decryptionSkipKey.Get(ctx)
+	return skip
+}
+
+// KeyProvider encrypts and decrypts the values of the encrypted fields. Each key has an id stored with the
+// ciphertext, so the values encrypted with a retired key are still decrypted after the current key is rotated
+type KeyProvider interface {
+	// CurrentKeyID returns the id of the key new values are encrypted with
+	CurrentKeyID(ctx context.Context) (string, error)
+	// Encrypt encrypts the plaintext with the key, the additional data is authenticated but not encrypted
+	Encrypt(ctx context.Context, keyID string, plaintext, additionalData []byte) ([]byte, error)
+	// Decrypt decrypts the ciphertext encrypted with the key and the additional data
+	Decrypt(ctx context.Context, keyID string, ciphertext, additionalData []byte) ([]byte, error)
+}
+
+// Keyring is a KeyProvider holding local AES-GCM keys
+type Keyring struct {
+	mu      sync.RWMutex
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// NewKeyring returns a keyring with the keys by id, new values are encrypted with the current key. The keys must be
+// 16, 24 or 32 bytes long to select AES-128, AES-192 or AES-256
+func NewKeyring(current string, keys map[string][]byte) (*Keyring, error) {
+	k := &Keyring{
+		keys: map[string]cipher.AEAD{},
+	}
+
+	for id, key := range keys {
+		if err := k.AddKey(id, key); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := k.SetCurrent(current); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// AddKey adds a key to the keyring, replacing the key with the same id
+func (k *Keyring) AddKey(id string, key []byte) error {
+	if id == "" || strings.Contains(id, ":") {
+		return fmt.Errorf("%w: key id %q must be set and cannot contain a colon", ErrInvalidEncryptionKey, id)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrInvalidEncryptionKey, id, err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrInvalidEncryptionKey, id, err)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.keys[id] = aead
+
+	return nil
+}
+
+// SetCurrent sets the key new values are encrypted with, the key must be in the keyring. The values encrypted with
+// the previous key are re-encrypted with a RotationRunner
+func (k *Keyring) SetCurrent(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, ok := k.keys[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrEncryptionKeyNotFound, id)
+	}
+
+	k.current = id
+
+	return nil
+}
+
+// CurrentKeyID returns the id of the key new values are encrypted with
+func (k *Keyring) CurrentKeyID(_ context.Context) (string, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.current, nil
+}
+
+// Encrypt encrypts the plaintext with the key, the random nonce is prepended to the ciphertext
+func (k *Keyring) Encrypt(_ context.Context, keyID string, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := k.key(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// Decrypt decrypts the ciphertext returned by Encrypt
+func (k *Keyring) Decrypt(_ context.Context, keyID string, ciphertext, additionalData []byte) ([]byte, error) {
+	aead, err := k.key(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: too short", ErrInvalidCiphertext)
+	}
+
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+
+	plaintext, err := aead.Open(nil, nonce, sealed, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCiphertext, err)
+	}
+
+	return plaintext, nil
+}
+
+// key returns the cipher of the key with the id
+func (k *Keyring) key(id string) (cipher.AEAD, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	aead, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrEncryptionKeyNotFound, id)
+	}
+
+	return aead, nil
+}
+
+// IsEncryptedValue reports whether the value was encrypted by a FieldEncryptor
+func IsEncryptedValue(v string) bool {
+	return strings.HasPrefix(v, EncryptedValuePrefix)
+}
+
+// EncryptedValueKeyID returns the id of the key the value was encrypted with, false when the value is not encrypted
+func EncryptedValueKeyID(v string) (string, bool) {
+	rest, ok := strings.CutPrefix(v, EncryptedValuePrefix)
+	if !ok {
+		return "", false
+	}
+
+	id, _, ok := strings.Cut(rest, ":")
+
+	return id, ok
+}
+
+// FieldEncryptor encrypts and decrypts the values of the encrypted fields with a KeyProvider, the generated hooks and
+// interceptors use it. The additional data binds a ciphertext to its schema, field and record, see
+// EncryptionAdditionalData, so it cannot be copied to another field or record. The values written are always
+// encrypted and values that are already encrypted are rejected; decrypting a plaintext value returns it as is, so the
+// values written before the field was encrypted are still read
+type FieldEncryptor struct {
+	provider KeyProvider
+}
+
+// NewFieldEncryptor returns a FieldEncryptor using the key provider
+func NewFieldEncryptor(provider KeyProvider) *FieldEncryptor {
+	return &FieldEncryptor{provider: provider}
+}
+
+// EncryptionAdditionalData returns the additional data binding the ciphertext of the schema field, e.g.
+// Credential.token, to the record with the id
+func EncryptionAdditionalData(schemaField string, id any) string {
+	return fmt.Sprintf("%s:%v", schemaField, id)
+}
+
+// EncryptString encrypts the value with the current key, values that are already encrypted are rejected
+func (e *FieldEncryptor) EncryptString(ctx context.Context, additionalData, v string) (string, error) {
+	if IsEncryptedValue(v) {
+		return "", ErrEncryptedInput
+	}
+
+	keyID, err := e.provider.CurrentKeyID(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := e.provider.Encrypt(ctx, keyID, []byte(v), []byte(additionalData))
+	if err != nil {
+		return "", err
+	}
+
+	return EncryptedValuePrefix + keyID + ":" + base64.RawStdEncoding.EncodeToString(ciphertext), nil
+}
+
+// DecryptString decrypts the value with the key it was encrypted with
+func (e *FieldEncryptor) DecryptString(ctx context.Context, additionalData, v string) (string, error) {
+	keyID, ok := EncryptedValueKeyID(v)
+	if !ok {
+		return v, nil
+	}
+
+	ciphertext, err := base64.RawStdEncoding.DecodeString(v[len(EncryptedValuePrefix)+len(keyID)+1:])
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidCiphertext, err)
+	}
+
+	plaintext, err := e.provider.Decrypt(ctx, keyID, ciphertext, []byte(additionalData))
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// EncryptStrings encrypts each value of the list
+func (e *FieldEncryptor) EncryptStrings(ctx context.Context, additionalData string, v []string) ([]string, error) {
+	return e.mapStrings(ctx, additionalData, v, e.EncryptString)
+}
+
+// DecryptStrings decrypts each value of the list
+func (e *FieldEncryptor) DecryptStrings(ctx context.Context, additionalData string, v []string) ([]string, error) {
+	return e.mapStrings(ctx, additionalData, v, e.DecryptString)
+}
+
+// mapStrings applies the function to each value of the list
+func (e *FieldEncryptor) mapStrings(ctx context.Context, additionalData string, v []string,
+	fn func(context.Context, string, string) (string, error)) ([]string, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	out := make([]string, len(v))
+
+	for i, s := range v {
+		var err error
+		if out[i], err = fn(ctx, additionalData, s); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+// EncryptJSON encrypts the JSON document, which is stored as a JSON string holding the ciphertext
+func (e *FieldEncryptor) EncryptJSON(ctx context.Context, additionalData string, v json.RawMessage) (json.RawMessage, error) {
+	if len(v) == 0 {
+		return v, nil
+	}
+
+	if _, ok := encryptedJSONString(v); ok {
+		return nil, ErrEncryptedInput
+	}
+
+	enc, err := e.EncryptString(ctx, additionalData, string(v))
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(enc)
+}
+
+// DecryptJSON decrypts the JSON document encrypted by EncryptJSON
+func (e *FieldEncryptor) DecryptJSON(ctx context.Context, additionalData string, v json.RawMessage) (json.RawMessage, error) {
+	enc, ok := encryptedJSONString(v)
+	if !ok {
+		return v, nil
+	}
+
+	dec, err := e.DecryptString(ctx, additionalData, enc)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.RawMessage(dec), nil
+}
+
+// EncryptMap encrypts the map, which is stored as a map holding the ciphertext under EncryptedMapKey
+func (e *FieldEncryptor) EncryptMap(ctx context.Context, additionalData string, v map[string]any) (map[string]any, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	if _, ok := v[EncryptedMapKey]; ok {
+		return nil, ErrEncryptedInput
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	enc, err := e.EncryptString(ctx, additionalData, string(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{EncryptedMapKey: enc}, nil
+}
+
+// DecryptMap decrypts the map encrypted by EncryptMap
+func (e *FieldEncryptor) DecryptMap(ctx context.Context, additionalData string, v map[string]any) (map[string]any, error) {
+	enc, ok := encryptedMapValue(v)
+	if !ok {
+		return v, nil
+	}
+
+	dec, err := e.DecryptString(ctx, additionalData, enc)
+	if err != nil {
+		return nil, err
+	}
+
+	out := map[string]any{}
+	if err := json.Unmarshal([]byte(dec), &out); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCiphertext, err)
+	}
+
+	return out, nil
+}
+
+// Stale reports whether the value of an encrypted field is plaintext or encrypted with another key than the current
+// one, the stale values are re-encrypted by the rotation targets. Unset values are never stale
+func (e *FieldEncryptor) Stale(ctx context.Context, v any) (bool, error) {
+	var values []string
+
+	switch v := v.(type) {
+	case string:
+		values = []string{v}
+	case *string:
+		if v != nil {
+			values = []string{*v}
+		}
+	case []string:
+		values = v
+	case json.RawMessage:
+		if len(v) > 0 {
+			enc, _ := encryptedJSONString(v)
+			values = []string{enc}
+		}
+	case map[string]any:
+		if v != nil {
+			enc, _ := encryptedMapValue(v)
+			values = []string{enc}
+		}
+	default:
+		return false, fmt.Errorf("%w: unsupported value type %T", ErrInvalidEncryptedField, v)
+	}
+
+	if len(values) == 0 {
+		return false, nil
+	}
+
+	current, err := e.provider.CurrentKeyID(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	for _, s := range values {
+		if keyID, ok := EncryptedValueKeyID(s); !ok || keyID != current {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// encryptedJSONString returns the ciphertext of an encrypted JSON document
+func encryptedJSONString(v json.RawMessage) (string, bool) {
+	if len(v) == 0 || v[0] != '"' {
+		return "", false
+	}
+
+	var s string
+	if err := json.Unmarshal(v, &s); err != nil || !IsEncryptedValue(s) {
+		return "", false
+	}
+
+	return s, true
+}
+
+// encryptedMapValue returns the ciphertext of an encrypted map
+func encryptedMapValue(v map[string]any) (string, bool) {
+	if len(v) != 1 {
+		return "", false
+	}
+
+	s, ok := v[EncryptedMapKey].(string)
+
+	return s, ok && IsEncryptedValue(s)
+}
+
+// RotationTarget re-encrypts the stale values of the encrypted fields of a schema, the targets are generated with
+// WithEncryption
+type RotationTarget struct {
+	// Schema the target applies to
+	Schema string
+	// Rotate re-encrypts the records following the cursor, at most limit, and returns the cursor of the next batch,
+	// the number of records read and the number re-encrypted; a nil cursor starts from the first record and the
+	// returned cursor is nil once all the records were read
+	Rotate func(ctx context.Context, cursor any, limit int) (next any, scanned int, rotated int, err error)
+}
+
+// RotationResult is the outcome of the rotation of a schema
+type RotationResult struct {
+	// Schema the target applies to
+	Schema string `json:"schema"`
+	// Scanned is the number of records read
+	Scanned int `json:"scanned"`
+	// Rotated is the number of records re-encrypted with the current key
+	Rotated int `json:"rotated"`
+	// Batches is the number of batches run
+	Batches int `json:"batches"`
+	// Error is set when the rotation failed, the records re-encrypted before the failure are still reported
+	Error string `json:"error,omitempty"`
+}
+
+// RotationReport is the report of a rotation run
+type RotationReport struct {
+	// StartedAt is when the run started
+	StartedAt time.Time `json:"startedat"`
+	// FinishedAt is when the run finished
+	FinishedAt time.Time `json:"finishedat"`
+	// Results of the targets, in the order they ran
+	Results []RotationResult `json:"results"`
+}
+
+// RotationOption configures a RotationRunner
+type RotationOption func(*RotationRunner)
+
+// WithRotationBatchSize sets the number of records read per batch, DefaultRotationBatchSize by default
+func WithRotationBatchSize(size int) RotationOption {
+	return func(r *RotationRunner) {
+		if size > 0 {
+			r.batchSize = size
+		}
+	}
+}
+
+// WithRotationClock sets the clock the report times are read from, time.Now by default
+func WithRotationClock(now func() time.Time) RotationOption {
+	return func(r *RotationRunner) {
+		r.now = now
+	}
+}
+
+// RotationRunner re-encrypts the values of the encrypted fields that are not encrypted with the current key, in
+// batches, after the current key of the KeyProvider was rotated. Plaintext values written before the fields were
+// encrypted are encrypted by the run
+type RotationRunner struct {
+	targets   []RotationTarget
+	batchSize int
+	now       func() time.Time
+}
+
+// NewRotationRunner returns a runner for the targets, which run in order
+func NewRotationRunner(targets []RotationTarget, opts ...RotationOption) *RotationRunner {
+	r := &RotationRunner{
+		targets:   targets,
+		batchSize: DefaultRotationBatchSize,
+		now:       time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Run runs the targets, a failing target does not stop the others; the errors are joined and returned with the report.
+// The soft deleted records are re-encrypted as well
+func (r *RotationRunner) Run(ctx context.Context) (*RotationReport, error) {
+	ctx = SkipSoftDelete(ctx)
+
+	report := &RotationReport{
+		StartedAt: r.now(),
+	}
+
+	var errs []error
+
+	for _, t := range r.targets {
+		result := RotationResult{Schema: t.Schema}
+
+		if err := r.run(ctx, t, &result); err != nil {
+			result.Error = err.Error()
+			errs = append(errs, fmt.Errorf("key rotation of %s: %w", t.Schema, err))
+
+			log.Error().Err(err).Str("schema", t.Schema).Int("rotated", result.Rotated).Msg("failed re-encrypting records")
+		} else if result.Rotated > 0 {
+			log.Info().Str("schema", t.Schema).Int("scanned", result.Scanned).Int("rotated", result.Rotated).
+				Msg("re-encrypted records with the current key")
+		}
+
+		report.Results = append(report.Results, result)
+	}
+
+	report.FinishedAt = r.now()
+
+	return report, errors.Join(errs...)
+}
+
+// run re-encrypts the records of the target in batches
+func (r *RotationRunner) run(ctx context.Context, t RotationTarget, result *RotationResult) error {
+	var cursor any
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		next, scanned, rotated, err := t.Rotate(ctx, cursor, r.batchSize)
+		if err != nil {
+			return err
+		}
+
+		if scanned == 0 {
+			return nil
+		}
+
+		result.Batches++
+		result.Scanned += scanned
+		result.Rotated += rotated
+
+		if next == nil {
+			return nil
+		}
+
+		cursor = next
+	}
+}
+
+// encryptedField is a field with the encrypted annotation
+type encryptedField struct {
+	*gen.Field
+
+	// Kind selects the FieldEncryptor methods of the field: String, Strings, JSON or Map
+	Kind string
+	// AdditionalData is the schema and field the ciphertext is bound to with the record id, history schemas use the
+	// schema they track so the values copied to the history records are decrypted with the tracked record
+	AdditionalData string
+}
+
+// encryptedNode is a schema with encrypted fields
+type encryptedNode struct {
+	*gen.Type
+
+	Fields []encryptedField
+	// Ref is the field of a history schema holding the id of the tracked record, which binds the ciphertext of the
+	// history records; the ciphertext of other schemas is bound to their id
+	Ref *gen.Field
+}
+
+// encryptedNodes returns the schemas with fields that have the encrypted annotation, including the history schemas
+// copying them
+func encryptedNodes(nodes []*gen.Type) ([]encryptedNode, error) {
+	var out []encryptedNode
+
+	for _, n := range nodes {
+		var fields []encryptedField
+
+		for _, f := range n.Fields {
+			if !HasAnnotation[EncryptedFieldAnnotation](f) {
+				continue
+			}
+
+			ef, err := newEncryptedField(n, f)
+			if err != nil {
+				return nil, err
+			}
+
+			fields = append(fields, ef)
+		}
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		en, err := newEncryptedNode(n, fields)
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, en)
+	}
+
+	return out, nil
+}
+
+// newEncryptedNode returns the schema with encrypted fields, or an error when the record id binding the ciphertext is
+// not known before the insert
+func newEncryptedNode(n *gen.Type, fields []encryptedField) (encryptedNode, error) {
+	en := encryptedNode{Type: n, Fields: fields}
+
+	if trackedSchemaName(n) != n.Name {
+		for _, f := range n.Fields {
+			if f.Name == "ref" {
+				en.Ref = f
+			}
+		}
+
+		if en.Ref == nil {
+			return encryptedNode{}, fmt.Errorf("%w: %s has no ref field binding the ciphertext to the tracked record", ErrInvalidEncryptedField, n.Name)
+		}
+
+		return en, nil
+	}
+
+	if n.ID == nil || !n.ID.UserDefined {
+		return encryptedNode{}, fmt.Errorf("%w: %s has a database generated id, the ciphertext is bound to the id set before the insert", ErrInvalidEncryptedField, n.Name)
+	}
+
+	return en, nil
+}
+
+// newEncryptedField returns the encrypted field, or an error when the field cannot be encrypted
+func newEncryptedField(n *gen.Type, f *gen.Field) (encryptedField, error) {
+	kind, err := encryptedFieldKind(f)
+	if err != nil {
+		return encryptedField{}, fmt.Errorf("%w: %s.%s %s", ErrInvalidEncryptedField, n.Name, f.Name, err)
+	}
+
+	if f.Nillable && kind != "String" {
+		return encryptedField{}, fmt.Errorf("%w: %s.%s only nillable string fields can be encrypted", ErrInvalidEncryptedField, n.Name, f.Name)
+	}
+
+	if f.Unique {
+		return encryptedField{}, fmt.Errorf("%w: %s.%s cannot be unique, the ciphertext of equal values differ", ErrInvalidEncryptedField, n.Name, f.Name)
+	}
+
+	return encryptedField{
+		Field:          f,
+		Kind:           kind,
+		AdditionalData: trackedSchemaName(n) + "." + f.Name,
+	}, nil
+}
+
+// encryptedFieldKind returns the kind of the encrypted field, which must be a string or a JSON field holding a list
+// of strings, a json.RawMessage or a map[string]any
+func encryptedFieldKind(f *gen.Field) (string, error) {
+	switch {
+	case f.Type == nil:
+		return "", errors.New("has no type")
+	case f.Type.Type == field.TypeString && f.Type.RType == nil:
+		return "String", nil
+	case f.Type.Type != field.TypeJSON:
+		return "", fmt.Errorf("is a %s field, only string and JSON fields can be encrypted", f.Type.Type)
+	}
+
+	if f.Type.RType == nil {
+		return "", errors.New("has no JSON type")
+	}
+
+	switch f.Type.RType.Ident {
+	case reflect.TypeFor[[]string]().String():
+		return "Strings", nil
+	case reflect.TypeFor[json.RawMessage]().String():
+		return "JSON", nil
+	case reflect.TypeFor[map[string]any]().String():
+		return "Map", nil
+	default:
+		return "", fmt.Errorf("has the JSON type %s, only []string, json.RawMessage and map[string]any can be encrypted", f.Type)
+	}
+}
+
+// trackedSchemaName returns the name of the schema tracked by a history schema, or the name of the schema
+func trackedSchemaName(n *gen.Type) string {
+	raw, ok := n.Annotations["History"].(map[string]any)
+	if !ok {
+		return n.Name
+	}
+
+	if isHistory, _ := raw["isHistory"].(bool); isHistory {
+		return strings.TrimSuffix(n.Name, "History")
+	}
+
+	return n.Name
+}
+
+// EncryptionTemplate generates the encryption hooks, decryption interceptors and key rotation targets of the schemas
+// with encrypted fields
+var EncryptionTemplate = parseEntxTemplate("encryption", "templates/encryption.tmpl")
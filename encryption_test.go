@@ -0,0 +1,335 @@
+package entx_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"entgo.io/ent"
+	"entgo.io/ent/schema"
+	"entgo.io/ent/schema/field"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theopenlane/entx"
+	"github.com/theopenlane/entx/history"
+)
+
+// Credential has one encrypted field of each kind
+type Credential struct{ ent.Schema }
+
+func (Credential) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("id"),
+		field.String("name"),
+		field.String("token").Annotations(entx.Encrypted()),
+		field.String("note").Optional().Nillable().Annotations(entx.Encrypted()),
+		field.Strings("codes").Optional().Annotations(entx.Encrypted()),
+		field.JSON("data", map[string]any{}).Optional().Annotations(entx.Encrypted()),
+		field.JSON("raw", json.RawMessage{}).Optional().Annotations(entx.Encrypted()),
+	}
+}
+
+// CredentialHistory tracks the encrypted token of Credential
+type CredentialHistory struct{ ent.Schema }
+
+func (CredentialHistory) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("ref"),
+		field.String("token").Immutable().Annotations(entx.Encrypted()),
+	}
+}
+
+func (CredentialHistory) Annotations() []schema.Annotation {
+	return []schema.Annotation{history.Annotations{IsHistory: true}}
+}
+
+type invalidEncrypted struct{ ent.Schema }
+
+func (invalidEncrypted) Fields() []ent.Field {
+	return []ent.Field{
+		field.Int("pin").Annotations(entx.Encrypted()),
+	}
+}
+
+type uniqueEncrypted struct{ ent.Schema }
+
+func (uniqueEncrypted) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("email").Unique().Annotations(entx.Encrypted()),
+	}
+}
+
+type generatedIDEncrypted struct{ ent.Schema }
+
+func (generatedIDEncrypted) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("secret").Annotations(entx.Encrypted()),
+	}
+}
+
+func newTestEncryptor(t *testing.T) (*entx.Keyring, *entx.FieldEncryptor) {
+	t.Helper()
+
+	ring, err := entx.NewKeyring("k1", map[string][]byte{
+		"k1": []byte(strings.Repeat("a", 32)),
+		"k2": []byte(strings.Repeat("b", 16)),
+	})
+	require.NoError(t, err)
+
+	return ring, entx.NewFieldEncryptor(ring)
+}
+
+func TestKeyring(t *testing.T) {
+	_, err := entx.NewKeyring("k1", map[string][]byte{"k1": []byte("short")})
+	assert.ErrorIs(t, err, entx.ErrInvalidEncryptionKey)
+
+	_, err = entx.NewKeyring("k:1", map[string][]byte{"k:1": []byte(strings.Repeat("a", 32))})
+	assert.ErrorIs(t, err, entx.ErrInvalidEncryptionKey)
+
+	_, err = entx.NewKeyring("missing", map[string][]byte{"k1": []byte(strings.Repeat("a", 32))})
+	assert.ErrorIs(t, err, entx.ErrEncryptionKeyNotFound)
+
+	ring, _ := newTestEncryptor(t)
+	ctx := context.Background()
+
+	ciphertext, err := ring.Encrypt(ctx, "k1", []byte("secret"), []byte("Credential.token"))
+	require.NoError(t, err)
+
+	plaintext, err := ring.Decrypt(ctx, "k1", ciphertext, []byte("Credential.token"))
+	require.NoError(t, err)
+	assert.Equal(t, "secret", string(plaintext))
+
+	_, err = ring.Decrypt(ctx, "k1", ciphertext, []byte("Credential.note"))
+	assert.ErrorIs(t, err, entx.ErrInvalidCiphertext)
+
+	_, err = ring.Decrypt(ctx, "k2", ciphertext, []byte("Credential.token"))
+	assert.ErrorIs(t, err, entx.ErrInvalidCiphertext)
+
+	_, err = ring.Decrypt(ctx, "k3", ciphertext, nil)
+	assert.ErrorIs(t, err, entx.ErrEncryptionKeyNotFound)
+}
+
+func TestFieldEncryptor(t *testing.T) {
+	ring, e := newTestEncryptor(t)
+	ctx := context.Background()
+
+	enc, err := e.EncryptString(ctx, "Credential.token", "secret")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(enc, entx.EncryptedValuePrefix+"k1:"))
+
+	keyID, ok := entx.EncryptedValueKeyID(enc)
+	assert.True(t, ok)
+	assert.Equal(t, "k1", keyID)
+
+	// encrypted values cannot be written and plaintext values are read as is
+	_, err = e.EncryptString(ctx, "Credential.token", enc)
+	assert.ErrorIs(t, err, entx.ErrEncryptedInput)
+
+	dec, err := e.DecryptString(ctx, "Credential.token", enc)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", dec)
+
+	dec, err = e.DecryptString(ctx, "Credential.token", "plain")
+	require.NoError(t, err)
+	assert.Equal(t, "plain", dec)
+
+	_, err = e.DecryptString(ctx, "Credential.note", enc)
+	assert.ErrorIs(t, err, entx.ErrInvalidCiphertext)
+
+	// the ciphertext copied to another record is not decrypted
+	assert.Equal(t, "Credential.token:c1", entx.EncryptionAdditionalData("Credential.token", "c1"))
+
+	bound, err := e.EncryptString(ctx, entx.EncryptionAdditionalData("Credential.token", "c1"), "secret")
+	require.NoError(t, err)
+
+	_, err = e.DecryptString(ctx, entx.EncryptionAdditionalData("Credential.token", "c2"), bound)
+	assert.ErrorIs(t, err, entx.ErrInvalidCiphertext)
+
+	codes, err := e.EncryptStrings(ctx, "Credential.codes", []string{"a", "b"})
+	require.NoError(t, err)
+	assert.Len(t, codes, 2)
+	assert.NotEqual(t, codes[0], codes[1])
+
+	codes, err = e.DecryptStrings(ctx, "Credential.codes", codes)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, codes)
+
+	raw, err := e.EncryptJSON(ctx, "Credential.raw", json.RawMessage(`{"x":1}`))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(raw), `"`+entx.EncryptedValuePrefix))
+
+	_, err = e.EncryptJSON(ctx, "Credential.raw", raw)
+	assert.ErrorIs(t, err, entx.ErrEncryptedInput)
+
+	raw, err = e.DecryptJSON(ctx, "Credential.raw", raw)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"x":1}`, string(raw))
+
+	data, err := e.EncryptMap(ctx, "Credential.data", map[string]any{"k": "v"})
+	require.NoError(t, err)
+	assert.Contains(t, data, entx.EncryptedMapKey)
+
+	_, err = e.EncryptMap(ctx, "Credential.data", data)
+	assert.ErrorIs(t, err, entx.ErrEncryptedInput)
+
+	_, err = e.EncryptStrings(ctx, "Credential.codes", []string{"a", enc})
+	assert.ErrorIs(t, err, entx.ErrEncryptedInput)
+
+	stale, err := e.Stale(ctx, data)
+	require.NoError(t, err)
+	assert.False(t, stale)
+
+	data, err = e.DecryptMap(ctx, "Credential.data", data)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"k": "v"}, data)
+
+	// values are stale when they are plaintext or encrypted with another key than the current one
+	stale, err = e.Stale(ctx, "plain")
+	require.NoError(t, err)
+	assert.True(t, stale)
+
+	stale, err = e.Stale(ctx, (*string)(nil))
+	require.NoError(t, err)
+	assert.False(t, stale)
+
+	require.NoError(t, ring.SetCurrent("k2"))
+
+	stale, err = e.Stale(ctx, enc)
+	require.NoError(t, err)
+	assert.True(t, stale)
+
+	// values encrypted with the retired key are still decrypted
+	dec, err = e.DecryptString(ctx, "Credential.token", enc)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", dec)
+
+	_, err = e.Stale(ctx, 1)
+	assert.ErrorIs(t, err, entx.ErrInvalidEncryptedField)
+}
+
+func TestRotationRunner(t *testing.T) {
+	ring, e := newTestEncryptor(t)
+	ctx := context.Background()
+
+	// the records are the encrypted values of a schema, indexed by id
+	records := []string{"plain"}
+
+	for range 4 {
+		enc, err := e.EncryptString(ctx, "Credential.token", "secret")
+		require.NoError(t, err)
+
+		records = append(records, enc)
+	}
+
+	require.NoError(t, ring.SetCurrent("k2"))
+
+	target := entx.RotationTarget{
+		Schema: "Credential",
+		Rotate: func(ctx context.Context, cursor any, limit int) (any, int, int, error) {
+			start := 0
+			if cursor != nil {
+				start = cursor.(int) + 1
+			}
+
+			end := min(start+limit, len(records))
+			rotated := 0
+
+			for i := start; i < end; i++ {
+				stale, err := e.Stale(ctx, records[i])
+				if err != nil || !stale {
+					continue
+				}
+
+				dec, err := e.DecryptString(ctx, "Credential.token", records[i])
+				require.NoError(t, err)
+
+				records[i], err = e.EncryptString(ctx, "Credential.token", dec)
+				require.NoError(t, err)
+
+				rotated++
+			}
+
+			if end-start < limit {
+				return nil, end - start, rotated, nil
+			}
+
+			return end - 1, end - start, rotated, nil
+		},
+	}
+
+	failing := entx.RotationTarget{
+		Schema: "Failing",
+		Rotate: func(context.Context, any, int) (any, int, int, error) {
+			return nil, 0, 0, errors.New("boom")
+		},
+	}
+
+	report, err := entx.NewRotationRunner([]entx.RotationTarget{target, failing}, entx.WithRotationBatchSize(2)).Run(ctx)
+	require.Error(t, err)
+	require.Len(t, report.Results, 2)
+	assert.Equal(t, entx.RotationResult{Schema: "Credential", Scanned: 5, Rotated: 5, Batches: 3}, report.Results[0])
+	assert.Equal(t, "boom", report.Results[1].Error)
+
+	for _, r := range records {
+		keyID, ok := entx.EncryptedValueKeyID(r)
+		assert.True(t, ok)
+		assert.Equal(t, "k2", keyID)
+	}
+
+	report, err = entx.NewRotationRunner([]entx.RotationTarget{target}).Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, entx.RotationResult{Schema: "Credential", Scanned: 5, Rotated: 0, Batches: 1}, report.Results[0])
+}
+
+func TestEncryptionTemplate(t *testing.T) {
+	out, err := generateTemplate(t, "encryption.go", entx.WithEncryption(), Credential{}, CredentialHistory{})
+	require.NoError(t, err)
+
+	assert.Contains(t, out, `	c.Credential.Use(HookCredentialEncryption(e))
+	c.Credential.Intercept(InterceptCredentialDecryption(e))
+	c.CredentialHistory.Use(HookCredentialHistoryEncryption(e))`)
+
+	assert.Contains(t, out, `additionalData, err := additionalDataCredential(ctx, mut, "Credential.token")`)
+	assert.Contains(t, out, `enc, err := e.EncryptStrings(ctx, additionalData, v)`)
+	assert.Contains(t, out, `enc, err := e.EncryptMap(ctx, additionalData, v)`)
+	assert.Contains(t, out, `enc, err := e.EncryptJSON(ctx, additionalData, v)`)
+	assert.Contains(t, out, `mut.AppendedCodes(); ok && len(appended) > 0`)
+
+	// the ciphertext is bound to the record id, the updates of several records cannot set it
+	assert.Contains(t, out, `	if id, ok := m.ID(); ok {
+		return entx.EncryptionAdditionalData(field, id), nil
+	}`)
+	assert.Contains(t, out, `return "", fmt.Errorf("%w: Credential", entx.ErrEncryptedBulkUpdate)`)
+
+	// the history records are bound to the record they track, the values copied are decrypted and encrypted again
+	assert.Contains(t, out, `additionalData, err := additionalDataCredentialHistory(ctx, mut, "Credential.token")`)
+	assert.Contains(t, out, `	if ref, ok := m.Ref(); ok {
+		return entx.EncryptionAdditionalData(field, ref), nil
+	}`)
+	assert.Contains(t, out, `		v, err = e.DecryptString(ctx, additionalData, v)`)
+	assert.Contains(t, out, `entx.EncryptionAdditionalData("Credential.token", rec.Ref)`)
+	assert.NotContains(t, out, `"CredentialHistory.token"`)
+
+	assert.Contains(t, out, `dec, err := e.DecryptString(ctx, entx.EncryptionAdditionalData("Credential.note", rec.ID), *rec.Note)`)
+	assert.Contains(t, out, `update.Set(credential.FieldData, raw)`)
+	assert.Contains(t, out, `query.All(entx.SkipDecryption(ctx))`)
+
+	_, err = generateTemplate(t, "encryption.go", entx.WithEncryption(), invalidEncrypted{})
+	assert.ErrorIs(t, err, entx.ErrInvalidEncryptedField)
+
+	_, err = generateTemplate(t, "encryption.go", entx.WithEncryption(), uniqueEncrypted{})
+	assert.ErrorIs(t, err, entx.ErrInvalidEncryptedField)
+
+	_, err = generateTemplate(t, "encryption.go", entx.WithEncryption(), generatedIDEncrypted{})
+	assert.ErrorIs(t, err, entx.ErrInvalidEncryptedField)
+	assert.ErrorContains(t, err, "database generated id")
+}
+
+func TestLintGraphEncrypted(t *testing.T) {
+	issues := entx.LintGraph(lintGraph(t, invalidEncrypted{}, Credential{}))
+	require.Len(t, issues, 1)
+	assert.Equal(t, "invalidEncrypted.pin: OPENLANE_ENCRYPTED_FIELD: is a int field, only string and JSON fields can be encrypted", issues[0].String())
+}
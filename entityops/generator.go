@@ -211,7 +211,7 @@ func fieldWorkflowEligible(field *gen.Field) (eligible bool, marker bool, err er
 	}
 
 	ann := &entx.WorkflowEligibleAnnotation{}
-	if err := ann.Decode(raw); err != nil {
+	if err := entx.DecodeAnnotation(raw, ann); err != nil {
 		return false, false, err
 	}
 
@@ -239,7 +239,7 @@ func edgeWorkflowEligible(edge *gen.Edge) (bool, error) {
 	}
 
 	ann := &entx.WorkflowEligibleAnnotation{}
-	if err := ann.Decode(raw); err != nil {
+	if err := entx.DecodeAnnotation(raw, ann); err != nil {
 		return false, err
 	}
 
@@ -274,7 +274,7 @@ func fieldTaskRules(field *gen.Field) ([]entx.TaskRuleSpec, error) {
 	}
 
 	ann := &entx.TaskRuleAnnotation{}
-	if err := ann.Decode(raw); err != nil {
+	if err := entx.DecodeAnnotation(raw, ann); err != nil {
 		return nil, err
 	}
 
@@ -293,7 +293,7 @@ func schemaTaskRules(schema *load.Schema) ([]entx.TaskRuleSpec, error) {
 	}
 
 	ann := &entx.TaskRuleAnnotation{}
-	if err := ann.Decode(raw); err != nil {
+	if err := entx.DecodeAnnotation(raw, ann); err != nil {
 		return nil, err
 	}
 
@@ -589,7 +589,7 @@ func collectConsoleRoute(node *gen.Type, schema *EntitySchema) error {
 	}
 
 	routeAnn := &entx.ConsoleRouteAnnotation{}
-	if err := routeAnn.Decode(raw); err != nil {
+	if err := entx.DecodeAnnotation(raw, routeAnn); err != nil {
 		return fmt.Errorf("decode console route annotation on %s: %w", node.Name, err)
 	}
 
@@ -3,13 +3,139 @@ package entx
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 var (
 	// ErrUnsupportedDialect is returned when an unsupported dialect is used
 	ErrUnsupportedDialect = errors.New("unsupported dialect")
+	// ErrMultiwriteUnsupported is returned when a secondary database is set for a driver that does not support multiwrite
+	ErrMultiwriteUnsupported = errors.New("multiwrite not supported")
+	// ErrUnsupportedReplicaSelection is returned when an unknown replica selection strategy is configured
+	ErrUnsupportedReplicaSelection = errors.New("unsupported replica selection")
+	// ErrSecondaryWriteFailed is returned when a write could not be applied to the secondary database
+	ErrSecondaryWriteFailed = errors.New("secondary write failed")
+	// ErrSecondaryNotConnected is reported while the secondary database is not connected in degraded mode
+	ErrSecondaryNotConnected = errors.New("secondary database not connected")
+	// ErrSecondaryStale is reported when writes were made to the primary only before the secondary was connected
+	ErrSecondaryStale = errors.New("secondary database is missing writes made before it was connected")
+	// ErrOutboxArgument is returned when a statement argument cannot be recorded in the outbox
+	ErrOutboxArgument = errors.New("unsupported outbox argument")
+	// ErrReplicationLag is returned when the secondary database is too far behind the primary
+	ErrReplicationLag = errors.New("secondary database replication lag exceeded")
+	// ErrReplicationDeadLettered is returned when secondary writes were dead lettered after failing too many times
+	ErrReplicationDeadLettered = errors.New("secondary writes were dead lettered")
+	// ErrUnsupportedMigrationProvider is returned when an unknown migration provider is configured
+	ErrUnsupportedMigrationProvider = errors.New("unsupported migration provider")
+	// ErrInvalidConfig is returned when the database config is invalid
+	ErrInvalidConfig = errors.New("invalid database config")
+	// ErrInvalidCascade is returned when a cascade annotation references a schema or edge that does not exist
+	ErrInvalidCascade = errors.New("invalid cascade annotation")
+	// ErrInvalidRetention is returned when a retention annotation is set on a schema it cannot apply to
+	ErrInvalidRetention = errors.New("invalid retention annotation")
+	// ErrDatabaseUnavailable is returned when the primary database fails its health check
+	ErrDatabaseUnavailable = errors.New("database unavailable")
+	// ErrNotSoftDeleted is returned when restoring a record that is not soft deleted
+	ErrNotSoftDeleted = errors.New("record is not soft deleted")
+	// ErrRestoreConflict is returned when restoring a soft deleted record would violate a unique constraint
+	ErrRestoreConflict = errors.New("restore conflicts with an existing record")
+	// ErrInvalidAnnotations is returned when the lint of the entx annotations of the schemas reports issues
+	ErrInvalidAnnotations = errors.New("invalid entx annotations")
+	// ErrInvalidExportable is returned when an exportable annotation references fields the schema does not have
+	ErrInvalidExportable = errors.New("invalid exportable annotation")
+	// ErrUnsupportedExportFormat is returned when an unknown export format is requested
+	ErrUnsupportedExportFormat = errors.New("unsupported export format")
+	// ErrExportOwnerRequired is returned when exporting an org owned schema without an owner
+	ErrExportOwnerRequired = errors.New("owner is required to export an org owned schema")
+	// ErrUnknownExportSchema is returned when exporting a schema that is not exportable
+	ErrUnknownExportSchema = errors.New("schema is not exportable")
+	// ErrAnnotationRegistered is returned when an annotation name is registered with two types
+	ErrAnnotationRegistered = errors.New("annotation already registered")
+	// ErrAnnotationNotRegistered is returned when decoding an annotation that is not registered
+	ErrAnnotationNotRegistered = errors.New("annotation not registered")
+	// ErrInvalidEncryptedField is returned when a field with the encrypted annotation cannot be encrypted
+	ErrInvalidEncryptedField = errors.New("invalid encrypted field")
+	// ErrInvalidEncryptionKey is returned when a key of the keyring is not a valid AES key
+	ErrInvalidEncryptionKey = errors.New("invalid encryption key")
+	// ErrEncryptionKeyNotFound is returned when the key a value was encrypted with is not in the keyring
+	ErrEncryptionKeyNotFound = errors.New("encryption key not found")
+	// ErrInvalidCiphertext is returned when an encrypted value is malformed or fails authentication
+	ErrInvalidCiphertext = errors.New("invalid ciphertext")
+	// ErrEncryptedAppend is returned when values are appended to an encrypted list field, which must be set instead
+	ErrEncryptedAppend = errors.New("values cannot be appended to an encrypted field")
+	// ErrEncryptedInput is returned when a value written to an encrypted field is already encrypted
+	ErrEncryptedInput = errors.New("value written to an encrypted field is already encrypted")
+	// ErrEncryptedBulkUpdate is returned when an encrypted field is set by an update of several records, the
+	// ciphertext is bound to a single record
+	ErrEncryptedBulkUpdate = errors.New("encrypted fields can only be set on a single record")
+	// ErrInvalidTags is returned when the tags annotation of a schema does not match its fields
+	ErrInvalidTags = errors.New("invalid tags annotation")
+	// ErrUnsupportedTagDialect is returned when counting tags on a dialect without JSON array functions
+	ErrUnsupportedTagDialect = errors.New("unsupported dialect for tag counts")
+	// ErrInvalidOrgScope is returned when an org owned schema cannot be scoped to the organization of the caller
+	ErrInvalidOrgScope = errors.New("invalid org owned schema")
+	// ErrMissingOrganization is returned when an org owned schema is used without an organization in the context
+	ErrMissingOrganization = errors.New("organization not found in context")
+	// ErrCrossOrgAccess is returned when a record of another organization is created or attached by an edge
+	ErrCrossOrgAccess = errors.New("record belongs to another organization")
 )
 
+// RestoreConflictError is returned when a restored record has the same unique fields as an active record
+type RestoreConflictError struct {
+	// Schema of the restored record
+	Schema string
+	// ID of the restored record
+	ID any
+	// Fields of the unique field or index the record conflicts on
+	Fields []string
+}
+
+// Error returns the RestoreConflictError in string format
+func (e *RestoreConflictError) Error() string {
+	return fmt.Sprintf("%s: %s %v on %s", ErrRestoreConflict, e.Schema, e.ID, strings.Join(e.Fields, ", "))
+}
+
+// Unwrap returns ErrRestoreConflict so the error can be checked with errors.Is
+func (e *RestoreConflictError) Unwrap() error {
+	return ErrRestoreConflict
+}
+
+// LintError is returned when the annotations of the schemas have problems
+type LintError struct {
+	Issues []LintIssue
+}
+
+// Error returns the LintError in string format
+func (e *LintError) Error() string {
+	lines := make([]string, 0, len(e.Issues))
+	for _, i := range e.Issues {
+		lines = append(lines, i.String())
+	}
+
+	return fmt.Sprintf("%s: %d issues\n%s", ErrInvalidAnnotations, len(e.Issues), strings.Join(lines, "\n"))
+}
+
+// Unwrap returns ErrInvalidAnnotations so the error can be checked with errors.Is
+func (e *LintError) Unwrap() error {
+	return ErrInvalidAnnotations
+}
+
 func newDialectError(dialect string) error {
 	return fmt.Errorf("%w: %s", ErrUnsupportedDialect, dialect)
 }
+
+func newMultiwriteError(driver string) error {
+	return fmt.Errorf("%w: %s", ErrMultiwriteUnsupported, driver)
+}
+
+func newReplicaSelectionError(selection string) error {
+	return fmt.Errorf("%w: %s", ErrUnsupportedReplicaSelection, selection)
+}
+
+func newMigrationProviderError(provider string) error {
+	return fmt.Errorf("%w: %s", ErrUnsupportedMigrationProvider, provider)
+}
+
+func newConfigError(field, reason string) error {
+	return fmt.Errorf("%w: %s %s", ErrInvalidConfig, field, reason)
+}
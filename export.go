@@ -0,0 +1,529 @@
+package entx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"entgo.io/ent/entc/gen"
+)
+
+const (
+	// DefaultExportPageSize is the number of records read per page by the generated exporters
+	DefaultExportPageSize = 1000
+
+	// exportOwnerField is the field the exports of org owned schemas are filtered on
+	exportOwnerField = "owner_id"
+	// exportSystemOwnedField is the field the system owned records are left out of exports on
+	exportSystemOwnedField = "system_owned"
+	// exportFormulaPrefixes are the first characters spreadsheets read a cell as a formula from
+	exportFormulaPrefixes = "=+-@\t\r"
+)
+
+// ExportFormat is the file format of an export
+type ExportFormat string
+
+const (
+	// ExportFormatCSV writes a header row with the column labels followed by a row per record, the text cells starting
+	// like a formula are prefixed with a quote so spreadsheets do not evaluate them
+	ExportFormatCSV ExportFormat = "csv"
+	// ExportFormatJSONL writes a JSON object per record keyed by the field names
+	ExportFormatJSONL ExportFormat = "jsonl"
+	// ExportFormatXLSX writes a single sheet workbook with a header row with the column labels, the text cells are
+	// guarded against formulas like the CSV cells
+	ExportFormatXLSX ExportFormat = "xlsx"
+)
+
+// ExportColumn is a column of an export
+type ExportColumn struct {
+	// Field is the ent field name (snake_case)
+	Field string
+	// Label is the column header of the CSV and XLSX exports
+	Label string
+}
+
+// ExportWriter writes the rows of an export, the values of a row are in the order of the columns
+type ExportWriter interface {
+	// WriteHeader writes the header of the export, it is called once before the rows
+	WriteHeader(columns []ExportColumn) error
+	// WriteRow writes a record
+	WriteRow(values []any) error
+	// Close flushes the export, the underlying writer is not closed
+	Close() error
+}
+
+// NewExportWriter returns a writer of the format streaming to w
+func NewExportWriter(format ExportFormat, w io.Writer) (ExportWriter, error) {
+	switch format {
+	case ExportFormatCSV:
+		return &csvExportWriter{w: csv.NewWriter(w)}, nil
+	case ExportFormatJSONL:
+		return &jsonlExportWriter{w: w}, nil
+	case ExportFormatXLSX:
+		return &xlsxExportWriter{zip: zip.NewWriter(w)}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedExportFormat, format)
+	}
+}
+
+// ExportConfig is the configuration of a generated exporter
+type ExportConfig struct {
+	// OwnerID is the organization the records of org owned schemas are exported for
+	OwnerID string
+	// IncludeSystemOwned exports the system owned records too
+	IncludeSystemOwned bool
+	// PageSize is the number of records read per query
+	PageSize int
+}
+
+// ExportOption configures a generated exporter
+type ExportOption func(*ExportConfig)
+
+// WithExportOwnerID sets the organization the records are exported for, it is required for org owned schemas
+func WithExportOwnerID(ownerID string) ExportOption {
+	return func(c *ExportConfig) {
+		c.OwnerID = ownerID
+	}
+}
+
+// WithExportIncludeSystemOwned sets whether the system owned records are exported, they are left out by default
+func WithExportIncludeSystemOwned(include bool) ExportOption {
+	return func(c *ExportConfig) {
+		c.IncludeSystemOwned = include
+	}
+}
+
+// WithExportPageSize sets the number of records read per query, DefaultExportPageSize by default
+func WithExportPageSize(size int) ExportOption {
+	return func(c *ExportConfig) {
+		if size > 0 {
+			c.PageSize = size
+		}
+	}
+}
+
+// NewExportConfig returns the configuration of the options, it is called by the generated exporters
+func NewExportConfig(opts ...ExportOption) ExportConfig {
+	c := ExportConfig{
+		PageSize: DefaultExportPageSize,
+	}
+
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	return c
+}
+
+// csvExportWriter writes the export as CSV
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+// WriteHeader writes the column labels
+func (e *csvExportWriter) WriteHeader(columns []ExportColumn) error {
+	labels := make([]string, 0, len(columns))
+	for _, c := range columns {
+		labels = append(labels, c.Label)
+	}
+
+	return e.w.Write(labels)
+}
+
+// WriteRow writes the values as text
+func (e *csvExportWriter) WriteRow(values []any) error {
+	record := make([]string, 0, len(values))
+
+	for _, v := range values {
+		text, err := exportCell(v)
+		if err != nil {
+			return err
+		}
+
+		record = append(record, text)
+	}
+
+	return e.w.Write(record)
+}
+
+// Close flushes the buffered rows
+func (e *csvExportWriter) Close() error {
+	e.w.Flush()
+
+	return e.w.Error()
+}
+
+// jsonlExportWriter writes the export as JSON lines
+type jsonlExportWriter struct {
+	w      io.Writer
+	fields [][]byte
+}
+
+// WriteHeader keeps the field names the values are keyed by
+func (e *jsonlExportWriter) WriteHeader(columns []ExportColumn) error {
+	e.fields = make([][]byte, 0, len(columns))
+
+	for _, c := range columns {
+		key, err := json.Marshal(c.Field)
+		if err != nil {
+			return err
+		}
+
+		e.fields = append(e.fields, key)
+	}
+
+	return nil
+}
+
+// WriteRow writes an object with the values keyed by the field names, in the order of the columns
+func (e *jsonlExportWriter) WriteRow(values []any) error {
+	var line bytes.Buffer
+
+	enc := json.NewEncoder(&line)
+	enc.SetEscapeHTML(false)
+
+	line.WriteByte('{')
+
+	for i, v := range values {
+		if i > 0 {
+			line.WriteByte(',')
+		}
+
+		line.Write(e.fields[i])
+		line.WriteByte(':')
+
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+
+		// the encoder ends each value with a newline
+		line.Truncate(line.Len() - 1)
+	}
+
+	line.WriteString("}\n")
+
+	_, err := e.w.Write(line.Bytes())
+
+	return err
+}
+
+// Close is a no-op, the rows are not buffered
+func (e *jsonlExportWriter) Close() error {
+	return nil
+}
+
+// xlsx parts of a single sheet workbook
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`
+	xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Export" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`
+	xlsxSheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetEnd = `</sheetData></worksheet>`
+)
+
+// xlsxExportWriter writes the export as a single sheet workbook, the sheet is streamed so the rows are not kept in
+// memory
+type xlsxExportWriter struct {
+	zip   *zip.Writer
+	sheet io.Writer
+	rows  int
+}
+
+// WriteHeader writes the workbook parts and the header row with the column labels
+func (e *xlsxExportWriter) WriteHeader(columns []ExportColumn) error {
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	}
+
+	for _, p := range parts {
+		w, err := e.zip.Create(p.name)
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.WriteString(w, p.content); err != nil {
+			return err
+		}
+	}
+
+	sheet, err := e.zip.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(sheet, xlsxSheetStart); err != nil {
+		return err
+	}
+
+	e.sheet = sheet
+
+	labels := make([]any, 0, len(columns))
+	for _, c := range columns {
+		labels = append(labels, c.Label)
+	}
+
+	return e.WriteRow(labels)
+}
+
+// WriteRow writes the values as a row, numbers and booleans are written as typed cells and other values as text
+func (e *xlsxExportWriter) WriteRow(values []any) error {
+	e.rows++
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, `<row r="%d">`, e.rows)
+
+	for _, v := range values {
+		v = exportValue(v)
+
+		switch rv := reflect.ValueOf(v); rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			fmt.Fprintf(&b, `<c t="n"><v>%v</v></c>`, v)
+		case reflect.Bool:
+			if rv.Bool() {
+				b.WriteString(`<c t="b"><v>1</v></c>`)
+			} else {
+				b.WriteString(`<c t="b"><v>0</v></c>`)
+			}
+		default:
+			text, err := exportCell(v)
+			if err != nil {
+				return err
+			}
+
+			b.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+
+			if err := xml.EscapeText(&b, []byte(text)); err != nil {
+				return err
+			}
+
+			b.WriteString(`</t></is></c>`)
+		}
+	}
+
+	b.WriteString(`</row>`)
+
+	_, err := io.WriteString(e.sheet, b.String())
+
+	return err
+}
+
+// Close ends the sheet and writes the zip directory
+func (e *xlsxExportWriter) Close() error {
+	if e.sheet != nil {
+		if _, err := io.WriteString(e.sheet, xlsxSheetEnd); err != nil {
+			return err
+		}
+	}
+
+	return e.zip.Close()
+}
+
+// exportValue dereferences the pointers of the nillable fields, nil pointers are returned as nil
+func exportValue(v any) any {
+	rv := reflect.ValueOf(v)
+
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+
+		rv = rv.Elem()
+	}
+
+	if !rv.IsValid() {
+		return nil
+	}
+
+	return rv.Interface()
+}
+
+// exportCell returns the text of a value of a CSV or XLSX cell; the text, other than numbers, starting like a formula is
+// prefixed with a quote so spreadsheets show it instead of evaluating it, e.g. =HYPERLINK(...) entered in a title
+func exportCell(v any) (string, error) {
+	text, err := exportText(v)
+	if err != nil || text == "" || !strings.ContainsRune(exportFormulaPrefixes, rune(text[0])) {
+		return text, err
+	}
+
+	switch reflect.ValueOf(exportValue(v)).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Float32, reflect.Float64:
+		return text, nil
+	}
+
+	return "'" + text, nil
+}
+
+// exportText returns the text of a value of a CSV or XLSX cell, lists, maps and structs are written as JSON
+func exportText(v any) (string, error) {
+	v = exportValue(v)
+
+	switch t := v.(type) {
+	case nil:
+		return "", nil
+	case time.Time:
+		return t.Format(time.RFC3339Nano), nil
+	case fmt.Stringer:
+		return t.String(), nil
+	}
+
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, 64), nil
+	default:
+		out, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+
+		return string(out), nil
+	}
+}
+
+// exportNode is an exportable schema with its exported columns
+type exportNode struct {
+	*gen.Type
+
+	// Columns are the exported fields with their labels
+	Columns []exportColumn
+	// OwnerField is the field the exports are filtered by owner on, nil when the schema is not org owned
+	OwnerField *gen.Field
+	// SystemOwnedField is the field the system owned records are left out on, nil when the schema has none
+	SystemOwnedField *gen.Field
+}
+
+// exportColumn is an exported field, the id field included
+type exportColumn struct {
+	*gen.Field
+
+	// Label is the column label
+	Label string
+}
+
+// exportNodes returns the schemas with the Exportable annotation and their exported columns, in name order
+func exportNodes(nodes []*gen.Type) ([]exportNode, error) {
+	var exported []exportNode
+
+	for _, n := range nodes {
+		ant, ok := GetAnnotation[*Exportable](n)
+		if !ok {
+			continue
+		}
+
+		node, err := newExportNode(n, ant)
+		if err != nil {
+			return nil, err
+		}
+
+		exported = append(exported, node)
+	}
+
+	slices.SortFunc(exported, func(a, b exportNode) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return exported, nil
+}
+
+// newExportNode returns the exported columns and filter fields of the schema
+func newExportNode(n *gen.Type, ant *Exportable) (exportNode, error) {
+	node := exportNode{Type: n}
+
+	fields := map[string]*gen.Field{n.ID.Name: n.ID}
+	for _, f := range n.Fields {
+		fields[f.Name] = f
+	}
+
+	for _, name := range slices.Concat(ant.Include, ant.Exclude) {
+		if _, ok := fields[name]; !ok {
+			return node, fmt.Errorf("%w: %s has no field %q", ErrInvalidExportable, n.Name, name)
+		}
+	}
+
+	for name := range ant.Labels {
+		if _, ok := fields[name]; !ok {
+			return node, fmt.Errorf("%w: %s has no field %q to label", ErrInvalidExportable, n.Name, name)
+		}
+	}
+
+	columns := ant.Include
+	if len(columns) == 0 {
+		columns = []string{n.ID.Name}
+
+		for _, f := range n.Fields {
+			if !f.Sensitive() && !HasAnnotation[EncryptedFieldAnnotation](f) {
+				columns = append(columns, f.Name)
+			}
+		}
+	}
+
+	for _, name := range columns {
+		if slices.Contains(ant.Exclude, name) {
+			continue
+		}
+
+		label := name
+		if l, ok := ant.Labels[name]; ok {
+			label = l
+		}
+
+		node.Columns = append(node.Columns, exportColumn{Field: fields[name], Label: label})
+	}
+
+	if ant.OrgOwned || HasAnnotation[OrgOwnedSchema](n) {
+		if node.OwnerField = fields[exportOwnerField]; node.OwnerField == nil {
+			return node, fmt.Errorf("%w: %s is org owned but has no %s field", ErrInvalidExportable, n.Name, exportOwnerField)
+		}
+	}
+
+	if ant.HasSystemOwned || HasAnnotation[SystemOwnedSchema](n) {
+		if node.SystemOwnedField = fields[exportSystemOwnedField]; node.SystemOwnedField == nil {
+			return node, fmt.Errorf("%w: %s has system owned records but no %s field", ErrInvalidExportable, n.Name, exportSystemOwnedField)
+		}
+	}
+
+	return node, nil
+}
+
+// ExportTemplate generates the typed exporters of the schemas with the Exportable annotation
+var ExportTemplate = parseEntxTemplate("export", "templates/export.tmpl")
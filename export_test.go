@@ -0,0 +1,206 @@
+package entx_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"entgo.io/ent"
+	"entgo.io/ent/schema"
+	"entgo.io/ent/schema/field"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theopenlane/entx"
+)
+
+// ExportTask is exported without its owner, secret and token, and with a labeled title
+type ExportTask struct{ ent.Schema }
+
+func (ExportTask) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("title"),
+		field.String("owner_id"),
+		field.Bool("system_owned").Optional(),
+		field.Int("priority").Optional().Nillable(),
+		field.String("secret").Sensitive(),
+		field.String("token").Annotations(entx.Encrypted()),
+	}
+}
+
+func (ExportTask) Annotations() []schema.Annotation {
+	return []schema.Annotation{
+		entx.NewExportable(
+			entx.ExportableOrgOwned(),
+			entx.ExportableSystemOwned(),
+			entx.ExportableExclude("owner_id"),
+			entx.ExportableLabel("title", "Task Title"),
+		),
+	}
+}
+
+// ExportNote only exports the listed fields
+type ExportNote struct{ ent.Schema }
+
+func (ExportNote) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("text"),
+		field.Time("created_at"),
+	}
+}
+
+func (ExportNote) Annotations() []schema.Annotation {
+	return []schema.Annotation{
+		entx.NewExportable(entx.ExportableInclude("created_at", "text")),
+	}
+}
+
+type invalidExport struct{ ent.Schema }
+
+func (invalidExport) Annotations() []schema.Annotation {
+	return []schema.Annotation{
+		entx.NewExportable(entx.ExportableInclude("missing")),
+	}
+}
+
+func TestExportTemplate(t *testing.T) {
+	out, err := generateTemplate(t, "export.go", entx.WithExporters(), ExportTask{}, ExportNote{})
+	require.NoError(t, err)
+
+	assert.Contains(t, out, `var ExportSchemas = []string{
+	"ExportNote",
+	"ExportTask",
+}`)
+	assert.Contains(t, out, `case "ExportTask":
+		return c.ExportTask.Export(ctx, w, opts...)`)
+
+	// the sensitive and encrypted fields are left out of the default columns
+	assert.Contains(t, out, `var ExportTaskExportColumns = []entx.ExportColumn{
+	{Field: "id", Label: "id"},
+	{Field: "title", Label: "Task Title"},
+	{Field: "system_owned", Label: "system_owned"},
+	{Field: "priority", Label: "priority"},
+}`)
+	assert.Contains(t, out, `var ExportNoteExportColumns = []entx.ExportColumn{
+	{Field: "created_at", Label: "created_at"},
+	{Field: "text", Label: "text"},
+}`)
+
+	// the owner filter is required and the system owned records are left out by default
+	assert.Contains(t, out, `predicate.ExportTask(sql.FieldEQ(exporttask.FieldOwnerID, cfg.OwnerID))`)
+	assert.Contains(t, out, `sql.EQ(s.C(exporttask.FieldSystemOwned), false)`)
+	assert.Equal(t, 1, bytes.Count([]byte(out), []byte("entx.ErrExportOwnerRequired")))
+
+	assert.Contains(t, out, "query = query.Where(exporttask.IDGT(cursor))")
+	assert.Contains(t, out, `rec.Title,
+				rec.SystemOwned,
+				rec.Priority,`)
+
+	_, err = generateTemplate(t, "export.go", entx.WithExporters(), invalidExport{})
+	assert.ErrorIs(t, err, entx.ErrInvalidExportable)
+}
+
+func TestExportWriters(t *testing.T) {
+	columns := []entx.ExportColumn{
+		{Field: "id", Label: "ID"},
+		{Field: "title", Label: "Title"},
+		{Field: "priority", Label: "Priority"},
+		{Field: "tags", Label: "Tags"},
+		{Field: "done", Label: "Done"},
+		{Field: "due", Label: "Due"},
+	}
+
+	priority, lowered := 3, -2
+	due := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	rows := [][]any{
+		{"t1", "first, <task>", &priority, []string{"a", "b"}, true, due},
+		{"t2", "second", (*int)(nil), []string(nil), false, time.Time{}},
+		{"t3", "=HYPERLINK(\"https://example.com\")", &lowered, []string{"@a"}, false, due},
+	}
+
+	write := func(format entx.ExportFormat) string {
+		var buf bytes.Buffer
+
+		w, err := entx.NewExportWriter(format, &buf)
+		require.NoError(t, err)
+
+		require.NoError(t, w.WriteHeader(columns))
+
+		for _, row := range rows {
+			require.NoError(t, w.WriteRow(row))
+		}
+
+		require.NoError(t, w.Close())
+
+		return buf.String()
+	}
+
+	assert.Equal(t, `ID,Title,Priority,Tags,Done,Due
+t1,"first, <task>",3,"[""a"",""b""]",true,2024-05-01T12:00:00Z
+t2,second,,null,false,0001-01-01T00:00:00Z
+t3,"'=HYPERLINK(""https://example.com"")",-2,"[""@a""]",false,2024-05-01T12:00:00Z
+`, write(entx.ExportFormatCSV))
+
+	assert.Equal(t, `{"id":"t1","title":"first, <task>","priority":3,"tags":["a","b"],"done":true,"due":"2024-05-01T12:00:00Z"}
+{"id":"t2","title":"second","priority":null,"tags":null,"done":false,"due":"0001-01-01T00:00:00Z"}
+{"id":"t3","title":"=HYPERLINK(\"https://example.com\")","priority":-2,"tags":["@a"],"done":false,"due":"2024-05-01T12:00:00Z"}
+`, write(entx.ExportFormatJSONL))
+
+	out := write(entx.ExportFormatXLSX)
+
+	zr, err := zip.NewReader(bytes.NewReader([]byte(out)), int64(len(out)))
+	require.NoError(t, err)
+
+	names := make([]string, 0, len(zr.File))
+	sheet := ""
+
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			r, err := f.Open()
+			require.NoError(t, err)
+
+			raw, err := io.ReadAll(r)
+			require.NoError(t, err)
+
+			sheet = string(raw)
+		}
+	}
+
+	assert.ElementsMatch(t, []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"}, names)
+	assert.Contains(t, sheet, `<row r="1"><c t="inlineStr"><is><t xml:space="preserve">ID</t></is></c>`)
+	assert.Contains(t, sheet, `<t xml:space="preserve">first, &lt;task&gt;</t>`)
+	assert.Contains(t, sheet, `<c t="n"><v>3</v></c>`)
+	assert.Contains(t, sheet, `<c t="b"><v>1</v></c>`)
+	assert.Contains(t, sheet, `<t xml:space="preserve">&#39;=HYPERLINK(&#34;https://example.com&#34;)</t>`)
+	assert.Contains(t, sheet, `<c t="n"><v>-2</v></c>`)
+	assert.Contains(t, sheet, `<row r="4">`)
+	assert.True(t, bytes.HasSuffix([]byte(sheet), []byte("</sheetData></worksheet>")))
+
+	_, err = entx.NewExportWriter("pdf", io.Discard)
+	assert.ErrorIs(t, err, entx.ErrUnsupportedExportFormat)
+}
+
+func TestExportWritersFormulaCells(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, err := entx.NewExportWriter(entx.ExportFormatCSV, &buf)
+	require.NoError(t, err)
+
+	require.NoError(t, w.WriteRow([]any{"+1", "-x", "@SUM(A1)", "\tx", "a=b", -1.5, int64(-3)}))
+	require.NoError(t, w.Close())
+
+	assert.Equal(t, "'+1,'-x,'@SUM(A1),'\tx,a=b,-1.5,-3\n", buf.String())
+}
+
+func TestNewExportConfig(t *testing.T) {
+	cfg := entx.NewExportConfig()
+	assert.Equal(t, entx.ExportConfig{PageSize: entx.DefaultExportPageSize}, cfg)
+
+	cfg = entx.NewExportConfig(entx.WithExportOwnerID("org"), entx.WithExportIncludeSystemOwned(true), entx.WithExportPageSize(10), entx.WithExportPageSize(0))
+	assert.Equal(t, entx.ExportConfig{OwnerID: "org", IncludeSystemOwned: true, PageSize: 10}, cfg)
+}
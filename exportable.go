@@ -16,6 +16,13 @@ type Exportable struct {
 	OrgOwned bool
 	// HasSystemOwned indicates if the schema has systemOwned field and will automatically add the systemOwned=false filter during export validation.
 	HasSystemOwned bool
+	// Include restricts the exported columns to the fields (snake_case), in order; all fields but the sensitive
+	// and encrypted ones are exported by default, the encrypted fields are exported decrypted once included
+	Include []string `json:"Include,omitempty"`
+	// Exclude removes the fields (snake_case) from the exported columns
+	Exclude []string `json:"Exclude,omitempty"`
+	// Labels are the column labels of the exported fields by field name (snake_case), the field name is used by default
+	Labels map[string]string `json:"Labels,omitempty"`
 }
 
 // Options for the Exportable annotation.
@@ -32,12 +39,46 @@ func NewExportable(opts ...ExportableOption) Exportable {
 	return e
 }
 
+// ExportableOrgOwned sets the schema as owned by an organization, exports are filtered by the owner
+func ExportableOrgOwned() ExportableOption {
+	return func(e *Exportable) {
+		e.OrgOwned = true
+	}
+}
+
+// ExportableSystemOwned sets the schema as having system owned records, which are left out of exports
+func ExportableSystemOwned() ExportableOption {
+	return func(e *Exportable) {
+		e.HasSystemOwned = true
+	}
+}
+
+// ExportableInclude restricts the exported columns to the fields, in order
+func ExportableInclude(fields ...string) ExportableOption {
+	return func(e *Exportable) {
+		e.Include = append(e.Include, fields...)
+	}
+}
+
+// ExportableExclude removes the fields from the exported columns
+func ExportableExclude(fields ...string) ExportableOption {
+	return func(e *Exportable) {
+		e.Exclude = append(e.Exclude, fields...)
+	}
+}
+
+// ExportableLabel sets the column label of the exported field
+func ExportableLabel(field, label string) ExportableOption {
+	return func(e *Exportable) {
+		if e.Labels == nil {
+			e.Labels = map[string]string{}
+		}
+
+		e.Labels[field] = label
+	}
+}
+
 // Name returns the name of the Exportable annotation.
 func (Exportable) Name() string {
 	return "Exportable"
 }
-
-// Decode unmarshalls the Exportable annotation
-func (a *Exportable) Decode(annotation any) error {
-	return DecodeAnnotation(annotation, a)
-}
@@ -0,0 +1,3 @@
+// Package fgamodel provides an entgo extension generating the OpenFGA authorization model of the schemas, in DSL
+// and JSON, and a map of the crud relations of each schema from the entx fga and ownership annotations
+package fgamodel
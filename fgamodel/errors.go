@@ -0,0 +1,6 @@
+package fgamodel
+
+import "errors"
+
+// ErrUnknownParent indicates a FGACrudParent annotation references a schema that is not in the graph
+var ErrUnknownParent = errors.New("fgamodel: unknown parent schema")
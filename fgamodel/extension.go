@@ -0,0 +1,186 @@
+package fgamodel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"entgo.io/ent/entc"
+	"entgo.io/ent/entc/gen"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/tools/imports"
+)
+
+// ExtensionOption is a function that modifies the Extension configuration.
+type ExtensionOption = func(*Extension)
+
+// Config is the configuration for the fgamodel extension.
+type Config struct {
+	// ModelDir is the directory the model.fga and model.json files are written to
+	ModelDir string
+	// OutputDir is the directory the go file with the crud relations map is written to
+	OutputDir string
+	// PackageName is the package of the generated go file
+	PackageName string
+}
+
+// New creates a new fgamodel extension
+func New(opts ...ExtensionOption) *Extension {
+	extension := &Extension{
+		// Set configuration defaults that can get overridden with ExtensionOption
+		config: &Config{
+			ModelDir:    "./fga/model",
+			OutputDir:   "./internal/ent/generated",
+			PackageName: "generated",
+		},
+	}
+
+	for _, opt := range opts {
+		opt(extension)
+	}
+
+	return extension
+}
+
+// Extension implements entc.Extension
+type Extension struct {
+	entc.DefaultExtension
+	config *Config
+}
+
+// WithModelDir allows you to set an alternative directory for the model files
+// Defaults to "./fga/model"
+func WithModelDir(modelDir string) ExtensionOption {
+	return func(e *Extension) {
+		e.config.ModelDir = modelDir
+	}
+}
+
+// WithGeneratedDir allows you to set an alternative output directory for the crud relations map
+// Defaults to "./internal/ent/generated"
+func WithGeneratedDir(outputDir string) ExtensionOption {
+	return func(e *Extension) {
+		e.config.OutputDir = outputDir
+	}
+}
+
+// WithPackageName allows you to set an alternative package name for the generated file
+// Defaults to "generated"
+func WithPackageName(packageName string) ExtensionOption {
+	return func(e *Extension) {
+		e.config.PackageName = packageName
+	}
+}
+
+// Hooks satisfies the entc.Extension interface
+func (e Extension) Hooks() []gen.Hook {
+	return []gen.Hook{
+		e.Hook(),
+	}
+}
+
+// Hook is the function that generates the fga model and the crud relations map
+// this is called after all schemas have been generated
+func (e Extension) Hook() gen.Hook {
+	return func(next gen.Generator) gen.Generator {
+		return gen.GenerateFunc(func(g *gen.Graph) error {
+			if err := next.Generate(g); err != nil {
+				return err
+			}
+
+			model, crud, err := NewModel(g.Nodes)
+			if err != nil {
+				return err
+			}
+
+			return e.write(model, crud)
+		})
+	}
+}
+
+// write writes the model files and the crud relations map
+func (e Extension) write(model *Model, crud map[string]CRUDRelations) error {
+	if err := os.MkdirAll(e.config.ModelDir, 0o755); err != nil { //nolint:mnd
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(e.config.ModelDir, "model.fga"), []byte(model.DSL()), 0o600); err != nil { //nolint:mnd
+		return err
+	}
+
+	raw, err := json.MarshalIndent(model, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(e.config.ModelDir, "model.json"), append(raw, '\n'), 0o600); err != nil { //nolint:mnd
+		return err
+	}
+
+	src, err := GenerateRelationsMap(e.config.PackageName, crud)
+	if err != nil {
+		return err
+	}
+
+	outputPath := filepath.Join(e.config.OutputDir, "fga_relations.go")
+
+	if err := os.WriteFile(outputPath, src, 0o600); err != nil { //nolint:mnd
+		log.Error().Err(err).Msgf("failed to write to file %s", outputPath)
+
+		return err
+	}
+
+	return nil
+}
+
+var relationsTemplate = template.Must(template.New("fga_relations").Parse(`// Code generated by ent (fgamodel). DO NOT EDIT.
+
+package {{ .PackageName }}
+
+// FGACRUDRelations are the fga relations checked for the operations on the objects of a schema. Create is a
+// relation of the owning organization, and a relation is empty when the operation is skipped
+type FGACRUDRelations struct {
+	ObjectType string
+	Create     string
+	View       string
+	Edit       string
+	Delete     string
+}
+
+// FGARelationsMap maps <SchemaName> -> the fga relations of its object type, generated with the fga model
+// so the relations checked cannot drift from the model
+var FGARelationsMap = map[string]FGACRUDRelations{
+{{- range $name, $r := .Relations }}
+	{{ printf "%q" $name }}: {
+		ObjectType: {{ printf "%q" $r.ObjectType }},
+		Create:     {{ printf "%q" $r.Create }},
+		View:       {{ printf "%q" $r.View }},
+		Edit:       {{ printf "%q" $r.Edit }},
+		Delete:     {{ printf "%q" $r.Delete }},
+	},
+{{- end }}
+}
+`))
+
+// GenerateRelationsMap returns the formatted go source of the crud relations map
+func GenerateRelationsMap(packageName string, crud map[string]CRUDRelations) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := relationsTemplate.Execute(&buf, map[string]any{
+		"PackageName": packageName,
+		"Relations":   crud,
+	}); err != nil {
+		return nil, err
+	}
+
+	// run gofmt and goimports on the file contents
+	formatted, err := imports.Process("fga_relations.go", buf.Bytes(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to format file", err)
+	}
+
+	return formatted, nil
+}
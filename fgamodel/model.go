@@ -0,0 +1,567 @@
+package fgamodel
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"entgo.io/ent/entc/gen"
+	"github.com/stoewer/go-strcase"
+
+	"github.com/theopenlane/entx"
+)
+
+// SchemaVersion is the OpenFGA schema version of the generated model
+const SchemaVersion = "1.1"
+
+// Relations checked for the crud operations of the generated types
+const (
+	// RelationCanView allows reading the object
+	RelationCanView = "can_view"
+	// RelationCanEdit allows updating the object
+	RelationCanEdit = "can_edit"
+	// RelationCanDelete allows deleting the object
+	RelationCanDelete = "can_delete"
+	// RelationCanCreatePrefix prefixes the organization relations allowing the creation of its org owned schemas
+	RelationCanCreatePrefix = "can_create_"
+)
+
+// types of the model that are not generated from schemas
+const (
+	userType         = "user"
+	serviceType      = "service"
+	groupType        = "group"
+	organizationType = "organization"
+	systemType       = "system"
+
+	groupMember = groupType + "#member"
+)
+
+// Model is an OpenFGA authorization model
+type Model struct {
+	// SchemaVersion of the model
+	SchemaVersion string
+	// Types of the model, in definition order
+	Types []TypeDefinition
+}
+
+// TypeDefinition is a type of the model with its relations, in definition order
+type TypeDefinition struct {
+	// Type is the object type
+	Type string
+	// Relations of the type
+	Relations []Relation
+}
+
+// Relation is a relation of a type; its users are the union of the directly related user types, the computed
+// relations and the inherited relations, minus the users of the excluded relation
+type Relation struct {
+	// Name of the relation
+	Name string
+	// DirectTypes are the user types that can be directly related, e.g. user, group#member or user:*
+	DirectTypes []string
+	// Computed are the relations of the object granting the relation
+	Computed []string
+	// Inherited are the relations of related objects granting the relation
+	Inherited []Inherited
+	// Excluded is the relation whose users are denied the relation
+	Excluded string
+}
+
+// Inherited grants the relation to the users having Relation on the object related through From,
+// written "Relation from From" in the DSL
+type Inherited struct {
+	// Relation on the related object
+	Relation string
+	// From is the relation of the object to the related object
+	From string
+}
+
+// CRUDRelations are the relations checked for the operations on the objects of a schema, a relation is empty
+// when the operation is skipped
+type CRUDRelations struct {
+	// ObjectType is the fga type of the schema
+	ObjectType string
+	// Create is the organization relation allowing the creation of the object, set for org owned schemas
+	Create string
+	// View is the relation allowing reading the object
+	View string
+	// Edit is the relation allowing updating the object
+	Edit string
+	// Delete is the relation allowing deleting the object
+	Delete string
+}
+
+// schemaInfo is the fga configuration of a schema read from its annotations
+type schemaInfo struct {
+	name        string
+	objectType  string
+	skip        entx.FGASkipMode
+	orgOwned    bool
+	systemOwned bool
+	groupPerms  bool
+	parents     []string
+}
+
+// canEdit reports whether the type has the can_edit relation
+func (s schemaInfo) canEdit() bool {
+	return s.objectType == organizationType || !s.skip.Has(entx.SkipUpdate)
+}
+
+// canDelete reports whether the type has the can_delete relation
+func (s schemaInfo) canDelete() bool {
+	return s.objectType == organizationType || !s.skip.Has(entx.SkipDelete)
+}
+
+// canCreate reports whether the organization has a relation allowing the creation of the type
+func (s schemaInfo) canCreate() bool {
+	return s.orgOwned && !s.skip.Has(entx.SkipCreate)
+}
+
+// NewModel returns the authorization model of the schemas and the crud relations of each schema, keyed by schema
+// name; schemas skipped with FGACrudSkip(FGASkipType) and history schemas are left out
+func NewModel(nodes []*gen.Type) (*Model, map[string]CRUDRelations, error) {
+	infos := make([]schemaInfo, 0, len(nodes))
+	byType := map[string]schemaInfo{}
+
+	for _, n := range nodes {
+		info, ok := newSchemaInfo(n)
+		if !ok {
+			continue
+		}
+
+		infos = append(infos, info)
+		byType[info.objectType] = info
+	}
+
+	// organizations own the org owned schemas and can always be edited and deleted
+	if _, ok := byType[organizationType]; !ok {
+		byType[organizationType] = schemaInfo{objectType: organizationType}
+	}
+
+	var (
+		needsGroup, needsOrganization, needsSystem bool
+		creates                                    []string
+	)
+
+	for _, info := range infos {
+		for _, p := range info.parents {
+			parent := strcase.SnakeCase(p)
+			if _, ok := byType[parent]; !ok {
+				return nil, nil, fmt.Errorf("%w: %s of %s", ErrUnknownParent, p, info.name)
+			}
+
+			needsOrganization = needsOrganization || parent == organizationType
+		}
+
+		needsGroup = needsGroup || info.groupPerms
+		needsOrganization = needsOrganization || info.orgOwned
+		needsSystem = needsSystem || info.systemOwned
+
+		if info.canCreate() {
+			creates = append(creates, RelationCanCreatePrefix+info.objectType)
+		}
+	}
+
+	needsGroup = needsGroup || len(creates) > 0
+
+	m := &Model{
+		SchemaVersion: SchemaVersion,
+		Types: []TypeDefinition{
+			{Type: userType},
+			{Type: serviceType},
+		},
+	}
+
+	if needsSystem {
+		m.Types = append(m.Types, TypeDefinition{
+			Type: systemType,
+			Relations: []Relation{
+				{Name: "system_admin", DirectTypes: []string{userType, serviceType}},
+			},
+		})
+	}
+
+	if needsGroup && !hasType(infos, groupType) {
+		m.Types = append(m.Types, TypeDefinition{Type: groupType, Relations: groupRelations()})
+	}
+
+	if needsOrganization && !hasType(infos, organizationType) {
+		m.Types = append(m.Types, TypeDefinition{Type: organizationType, Relations: organizationRelations(creates)})
+	}
+
+	crud := make(map[string]CRUDRelations, len(infos))
+
+	for _, info := range infos {
+		td := TypeDefinition{Type: info.objectType}
+
+		switch info.objectType {
+		case organizationType:
+			td.Relations = organizationRelations(creates)
+		case groupType:
+			td.Relations = append(groupRelations(), schemaRelations(info, byType)...)
+		default:
+			td.Relations = schemaRelations(info, byType)
+		}
+
+		m.Types = append(m.Types, td)
+		crud[info.name] = crudRelations(info)
+	}
+
+	return m, crud, nil
+}
+
+// newSchemaInfo reads the fga annotations of the schema, it reports false when the schema has no fga type
+func newSchemaInfo(n *gen.Type) (schemaInfo, bool) {
+	info := schemaInfo{
+		name:        n.Name,
+		objectType:  strcase.SnakeCase(n.Name),
+		orgOwned:    entx.HasAnnotation[entx.OrgOwnedSchema](n),
+		systemOwned: entx.HasAnnotation[entx.SystemOwnedSchema](n),
+		groupPerms:  entx.HasAnnotation[entx.GroupPermissionsEnabled](n),
+	}
+
+	if strings.HasSuffix(n.Name, "History") {
+		return info, false
+	}
+
+	if ant, ok := entx.GetAnnotation[*entx.FGACrudAnnotation](n); ok {
+		info.skip = ant.Skip
+	}
+
+	if info.skip.Has(entx.FGASkipType) {
+		return info, false
+	}
+
+	if ant, ok := entx.GetAnnotation[*entx.FGAParentCrudAnnotation](n); ok {
+		info.parents = ant.ParentSchemas
+	}
+
+	return info, true
+}
+
+// hasType reports whether a schema has the fga type
+func hasType(infos []schemaInfo, objectType string) bool {
+	for _, info := range infos {
+		if info.objectType == objectType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// groupRelations are the relations of the group type, whose members are granted the group permissions
+func groupRelations() []Relation {
+	return []Relation{
+		{Name: "member", DirectTypes: []string{userType, serviceType}},
+	}
+}
+
+// organizationRelations are the relations of the organization type, which owns the org owned schemas
+func organizationRelations(creates []string) []Relation {
+	relations := []Relation{
+		{Name: "owner", DirectTypes: []string{userType}},
+		{Name: "admin", DirectTypes: []string{userType, serviceType}, Computed: []string{"owner"}},
+		{Name: "member", DirectTypes: []string{userType, serviceType}, Computed: []string{"admin"}},
+		{Name: RelationCanDelete, Computed: []string{"owner"}},
+		{Name: RelationCanEdit, Computed: []string{"admin"}},
+		{Name: RelationCanView, Computed: []string{"member"}},
+	}
+
+	for _, create := range creates {
+		relations = append(relations, Relation{
+			Name:        create,
+			DirectTypes: []string{userType, serviceType, groupMember},
+			Computed:    []string{"admin"},
+		})
+	}
+
+	return relations
+}
+
+// schemaRelations are the relations of a schema type: the objects it inherits from, the direct grants and the
+// crud relations, which are inherited from the owner and parents that have them
+func schemaRelations(info schemaInfo, byType map[string]schemaInfo) []Relation {
+	var (
+		relations []Relation
+		sources   []schemaInfo
+		from      []string
+	)
+
+	if info.orgOwned {
+		relations = append(relations, Relation{Name: "owner", DirectTypes: []string{organizationType}})
+		sources = append(sources, byType[organizationType])
+		from = append(from, "owner")
+	}
+
+	for _, p := range info.parents {
+		parent := byType[strcase.SnakeCase(p)]
+		if info.orgOwned && parent.objectType == organizationType {
+			continue
+		}
+
+		relations = append(relations, Relation{Name: parent.objectType, DirectTypes: []string{parent.objectType}})
+		sources = append(sources, parent)
+		from = append(from, parent.objectType)
+	}
+
+	if info.systemOwned {
+		relations = append(relations, Relation{Name: systemType, DirectTypes: []string{systemType}})
+	}
+
+	grantees := []string{userType, serviceType}
+	if info.groupPerms {
+		grantees = append(grantees, groupMember)
+	}
+
+	if info.canEdit() {
+		relations = append(relations, Relation{Name: "editor", DirectTypes: grantees})
+	}
+
+	relations = append(relations, Relation{Name: "viewer", DirectTypes: grantees})
+
+	excluded := ""
+	if info.groupPerms {
+		excluded = "blocked"
+		relations = append(relations, Relation{Name: excluded, DirectTypes: []string{userType, groupMember}})
+	}
+
+	// inherited returns the relation inherited from the sources that have it
+	inherited := func(relation string, has func(schemaInfo) bool) []Inherited {
+		var out []Inherited
+
+		for i, s := range sources {
+			if has(s) {
+				out = append(out, Inherited{Relation: relation, From: from[i]})
+			}
+		}
+
+		if info.systemOwned && relation != RelationCanView {
+			out = append(out, Inherited{Relation: "system_admin", From: systemType})
+		}
+
+		return out
+	}
+
+	// the strongest relation of the type is also granted the weaker ones
+	var stronger []string
+
+	if info.canDelete() {
+		relations = append(relations, Relation{
+			Name:        RelationCanDelete,
+			DirectTypes: []string{userType, serviceType},
+			Inherited:   inherited(RelationCanDelete, schemaInfo.canDelete),
+		})
+
+		stronger = []string{RelationCanDelete}
+	}
+
+	if info.canEdit() {
+		relations = append(relations, Relation{
+			Name:        RelationCanEdit,
+			DirectTypes: []string{userType, serviceType},
+			Computed:    append([]string{"editor"}, stronger...),
+			Inherited:   inherited(RelationCanEdit, schemaInfo.canEdit),
+			Excluded:    excluded,
+		})
+
+		stronger = []string{RelationCanEdit}
+	}
+
+	view := []string{userType, serviceType}
+	if info.systemOwned {
+		// system owned objects can be shared with everyone
+		view = append(view, userType+":*", serviceType+":*")
+	}
+
+	relations = append(relations, Relation{
+		Name:        RelationCanView,
+		DirectTypes: view,
+		Computed:    append([]string{"viewer"}, stronger...),
+		Inherited:   inherited(RelationCanView, func(schemaInfo) bool { return true }),
+		Excluded:    excluded,
+	})
+
+	return relations
+}
+
+// crudRelations returns the relations checked for the operations on the schema
+func crudRelations(info schemaInfo) CRUDRelations {
+	crud := CRUDRelations{
+		ObjectType: info.objectType,
+		View:       RelationCanView,
+	}
+
+	if info.canCreate() {
+		crud.Create = RelationCanCreatePrefix + info.objectType
+	}
+
+	if info.canEdit() {
+		crud.Edit = RelationCanEdit
+	}
+
+	if info.canDelete() {
+		crud.Delete = RelationCanDelete
+	}
+
+	return crud
+}
+
+// DSL returns the model in the OpenFGA DSL
+func (m *Model) DSL() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "model\n  schema %s\n", m.SchemaVersion)
+
+	for _, t := range m.Types {
+		fmt.Fprintf(&b, "\ntype %s\n", t.Type)
+
+		if len(t.Relations) == 0 {
+			continue
+		}
+
+		b.WriteString("  relations\n")
+
+		for _, r := range t.Relations {
+			fmt.Fprintf(&b, "    define %s: %s\n", r.Name, r.dsl())
+		}
+	}
+
+	return b.String()
+}
+
+// dsl returns the relation definition in the OpenFGA DSL
+func (r Relation) dsl() string {
+	var parts []string
+
+	if len(r.DirectTypes) > 0 {
+		parts = append(parts, "["+strings.Join(r.DirectTypes, ", ")+"]")
+	}
+
+	parts = append(parts, r.Computed...)
+
+	for _, i := range r.Inherited {
+		parts = append(parts, i.Relation+" from "+i.From)
+	}
+
+	expr := strings.Join(parts, " or ")
+
+	if r.Excluded == "" {
+		return expr
+	}
+
+	if len(parts) > 1 {
+		expr = "(" + expr + ")"
+	}
+
+	return expr + " but not " + r.Excluded
+}
+
+// jsonModel is the OpenFGA json representation of the model
+type jsonModel struct {
+	SchemaVersion   string     `json:"schema_version"`
+	TypeDefinitions []jsonType `json:"type_definitions"`
+}
+
+type jsonType struct {
+	Type      string         `json:"type"`
+	Relations map[string]any `json:"relations,omitempty"`
+	Metadata  *jsonMetadata  `json:"metadata,omitempty"`
+}
+
+type jsonMetadata struct {
+	Relations map[string]jsonRelationMetadata `json:"relations"`
+}
+
+type jsonRelationMetadata struct {
+	DirectlyRelatedUserTypes []map[string]any `json:"directly_related_user_types"`
+}
+
+// MarshalJSON returns the model in the OpenFGA json format
+func (m *Model) MarshalJSON() ([]byte, error) {
+	out := jsonModel{
+		SchemaVersion:   m.SchemaVersion,
+		TypeDefinitions: make([]jsonType, 0, len(m.Types)),
+	}
+
+	for _, t := range m.Types {
+		jt := jsonType{Type: t.Type}
+
+		if len(t.Relations) > 0 {
+			jt.Relations = map[string]any{}
+			jt.Metadata = &jsonMetadata{Relations: map[string]jsonRelationMetadata{}}
+
+			for _, r := range t.Relations {
+				jt.Relations[r.Name] = r.userset()
+				jt.Metadata.Relations[r.Name] = jsonRelationMetadata{DirectlyRelatedUserTypes: r.userTypes()}
+			}
+		}
+
+		out.TypeDefinitions = append(out.TypeDefinitions, jt)
+	}
+
+	return json.Marshal(out)
+}
+
+// userset returns the json userset rewrite of the relation
+func (r Relation) userset() map[string]any {
+	var children []map[string]any
+
+	if len(r.DirectTypes) > 0 {
+		children = append(children, map[string]any{"this": map[string]any{}})
+	}
+
+	for _, c := range r.Computed {
+		children = append(children, computedUserset(c))
+	}
+
+	for _, i := range r.Inherited {
+		children = append(children, map[string]any{
+			"tupleToUserset": map[string]any{
+				"tupleset":        map[string]any{"relation": i.From},
+				"computedUserset": map[string]any{"relation": i.Relation},
+			},
+		})
+	}
+
+	userset := children[0]
+	if len(children) > 1 {
+		userset = map[string]any{"union": map[string]any{"child": children}}
+	}
+
+	if r.Excluded == "" {
+		return userset
+	}
+
+	return map[string]any{
+		"difference": map[string]any{
+			"base":     userset,
+			"subtract": computedUserset(r.Excluded),
+		},
+	}
+}
+
+// computedUserset returns the json userset of the relation on the same object
+func computedUserset(relation string) map[string]any {
+	return map[string]any{"computedUserset": map[string]any{"relation": relation}}
+}
+
+// userTypes returns the json directly related user types of the relation
+func (r Relation) userTypes() []map[string]any {
+	types := make([]map[string]any, 0, len(r.DirectTypes))
+
+	for _, t := range r.DirectTypes {
+		switch {
+		case strings.HasSuffix(t, ":*"):
+			types = append(types, map[string]any{"type": strings.TrimSuffix(t, ":*"), "wildcard": map[string]any{}})
+		case strings.Contains(t, "#"):
+			typ, relation, _ := strings.Cut(t, "#")
+			types = append(types, map[string]any{"type": typ, "relation": relation})
+		default:
+			types = append(types, map[string]any{"type": t})
+		}
+	}
+
+	return types
+}
@@ -0,0 +1,183 @@
+package fgamodel
+
+import (
+	"encoding/json"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"entgo.io/ent/entc/gen"
+	"entgo.io/ent/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theopenlane/entx"
+)
+
+// node returns a schema type with the annotations
+func node(name string, ants ...schema.Annotation) *gen.Type {
+	n := &gen.Type{Name: name, Annotations: gen.Annotations{}}
+
+	for _, ant := range ants {
+		n.Annotations[ant.Name()] = ant
+	}
+
+	return n
+}
+
+func testNodes() []*gen.Type {
+	return []*gen.Type{
+		node("Organization"),
+		node("Program", entx.OrgOwnedSchema{}, entx.GroupPermissionsEnabled{}),
+		node("Control", entx.OrgOwnedSchema{}, entx.GroupPermissionsEnabled{}, entx.FGACrudParent("Program")),
+		node("Standard", entx.SystemOwnedSchema{}, entx.FGACrudSkip(entx.SkipCreate, entx.SkipDelete)),
+		node("APIToken", entx.FGACrudSkip()),
+		node("ControlHistory", entx.OrgOwnedSchema{}),
+	}
+}
+
+func TestNewModelDSL(t *testing.T) {
+	m, _, err := NewModel(testNodes())
+	require.NoError(t, err)
+
+	dsl := m.DSL()
+
+	assert.Contains(t, dsl, "model\n  schema 1.1\n\ntype user\n\ntype service\n")
+	assert.Contains(t, dsl, "type system\n  relations\n    define system_admin: [user, service]\n")
+	assert.Contains(t, dsl, "type group\n  relations\n    define member: [user, service]\n")
+
+	// the organization grants the creation of its org owned schemas
+	assert.Contains(t, dsl, `type organization
+  relations
+    define owner: [user]
+    define admin: [user, service] or owner
+    define member: [user, service] or admin
+    define can_delete: owner
+    define can_edit: admin
+    define can_view: member
+    define can_create_program: [user, service, group#member] or admin
+    define can_create_control: [user, service, group#member] or admin
+`)
+
+	// parents and the owner are inherited, group permissions can be blocked
+	assert.Contains(t, dsl, `type control
+  relations
+    define owner: [organization]
+    define program: [program]
+    define editor: [user, service, group#member]
+    define viewer: [user, service, group#member]
+    define blocked: [user, group#member]
+    define can_delete: [user, service] or can_delete from owner or can_delete from program
+    define can_edit: ([user, service] or editor or can_delete or can_edit from owner or can_edit from program) but not blocked
+    define can_view: ([user, service] or viewer or can_edit or can_view from owner or can_view from program) but not blocked
+`)
+
+	// skipped operations have no relation
+	assert.Contains(t, dsl, `type standard
+  relations
+    define system: [system]
+    define editor: [user, service]
+    define viewer: [user, service]
+    define can_edit: [user, service] or editor or system_admin from system
+    define can_view: [user, service, user:*, service:*] or viewer or can_edit
+`)
+
+	assert.NotContains(t, dsl, "type api_token")
+	assert.NotContains(t, dsl, "history")
+}
+
+func TestNewModelJSON(t *testing.T) {
+	m, _, err := NewModel(testNodes())
+	require.NoError(t, err)
+
+	raw, err := json.Marshal(m)
+	require.NoError(t, err)
+
+	var out struct {
+		SchemaVersion   string `json:"schema_version"`
+		TypeDefinitions []struct {
+			Type      string                    `json:"type"`
+			Relations map[string]map[string]any `json:"relations"`
+			Metadata  struct {
+				Relations map[string]struct {
+					DirectlyRelatedUserTypes []map[string]any `json:"directly_related_user_types"`
+				} `json:"relations"`
+			} `json:"metadata"`
+		} `json:"type_definitions"`
+	}
+
+	require.NoError(t, json.Unmarshal(raw, &out))
+	assert.Equal(t, "1.1", out.SchemaVersion)
+
+	types := []string{}
+	for _, td := range out.TypeDefinitions {
+		types = append(types, td.Type)
+	}
+
+	assert.Equal(t, []string{"user", "service", "system", "group", "organization", "program", "control", "standard"}, types)
+
+	control := out.TypeDefinitions[6]
+
+	assert.Equal(t, map[string]any{"this": map[string]any{}}, control.Relations["owner"])
+	assert.Equal(t, []map[string]any{{"type": "organization"}}, control.Metadata.Relations["owner"].DirectlyRelatedUserTypes)
+	assert.Equal(t, []map[string]any{{"type": "user"}, {"type": "group", "relation": "member"}},
+		control.Metadata.Relations["blocked"].DirectlyRelatedUserTypes)
+
+	canView := control.Relations["can_view"]["difference"].(map[string]any)
+	assert.Equal(t, map[string]any{"computedUserset": map[string]any{"relation": "blocked"}}, canView["subtract"])
+
+	union := canView["base"].(map[string]any)["union"].(map[string]any)["child"].([]any)
+	require.Len(t, union, 5)
+	assert.Equal(t, map[string]any{
+		"tupleToUserset": map[string]any{
+			"tupleset":        map[string]any{"relation": "program"},
+			"computedUserset": map[string]any{"relation": "can_view"},
+		},
+	}, union[4])
+
+	standard := out.TypeDefinitions[7]
+	assert.Contains(t, standard.Metadata.Relations["can_view"].DirectlyRelatedUserTypes, map[string]any{"type": "user", "wildcard": map[string]any{}})
+}
+
+func TestNewModelCRUDRelations(t *testing.T) {
+	_, crud, err := NewModel(testNodes())
+	require.NoError(t, err)
+
+	assert.Equal(t, CRUDRelations{
+		ObjectType: "control",
+		Create:     "can_create_control",
+		View:       RelationCanView,
+		Edit:       RelationCanEdit,
+		Delete:     RelationCanDelete,
+	}, crud["Control"])
+
+	assert.Equal(t, CRUDRelations{ObjectType: "standard", View: RelationCanView, Edit: RelationCanEdit}, crud["Standard"])
+	assert.Equal(t, "organization", crud["Organization"].ObjectType)
+	assert.NotContains(t, crud, "APIToken")
+	assert.NotContains(t, crud, "ControlHistory")
+
+	src, err := GenerateRelationsMap("generated", crud)
+	require.NoError(t, err)
+
+	_, err = parser.ParseFile(token.NewFileSet(), "fga_relations.go", src, parser.AllErrors)
+	require.NoError(t, err, string(src))
+
+	assert.Contains(t, string(src), `"Control": {
+		ObjectType: "control",
+		Create:     "can_create_control",`)
+}
+
+func TestNewModelUnknownParent(t *testing.T) {
+	_, _, err := NewModel([]*gen.Type{
+		node("Control", entx.OrgOwnedSchema{}, entx.FGACrudParent("Program")),
+	})
+	require.ErrorIs(t, err, ErrUnknownParent)
+
+	// the organization does not need to be a schema
+	m, _, err := NewModel([]*gen.Type{
+		node("Setting", entx.FGACrudParent("Organization")),
+	})
+	require.NoError(t, err)
+	assert.Contains(t, m.DSL(), "type organization\n")
+	assert.Contains(t, m.DSL(), "define can_view: [user, service] or viewer or can_edit or can_view from organization\n")
+}
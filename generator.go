@@ -12,6 +12,8 @@ type Extension struct {
 
 	templates []*gen.Template
 
+	hooks []gen.Hook
+
 	gqlSchemaHooks []entgql.SchemaHook
 }
 
@@ -26,11 +28,84 @@ func WithJSONScalar() ExtensionOption {
 	}
 }
 
+// WithCascadeDelete adds the template generating the cascade delete hooks and plans from the
+// CascadeAnnotation and CascadeThroughAnnotation of the schemas
+func WithCascadeDelete() ExtensionOption {
+	return func(ex *Extension) error {
+		ex.templates = append(ex.templates, CascadeDeleteTemplate)
+		return nil
+	}
+}
+
+// WithSoftDeleteRestore adds the template generating the Restore methods of the soft deletable schemas, which restore
+// a soft deleted record with the records soft deleted by the cascade of its delete
+func WithSoftDeleteRestore() ExtensionOption {
+	return func(ex *Extension) error {
+		ex.templates = append(ex.templates, SoftDeleteRestoreTemplate)
+		return nil
+	}
+}
+
+// WithRetention adds the template generating the retention policies of the schemas with a RetentionAnnotation,
+// which are run with a RetentionRunner to purge the soft deleted records past their retention window
+func WithRetention() ExtensionOption {
+	return func(ex *Extension) error {
+		ex.templates = append(ex.templates, RetentionTemplate)
+		return nil
+	}
+}
+
+// WithExporters adds the template generating the typed exporters of the schemas with the Exportable annotation, which
+// stream the records to an ExportWriter page by page
+func WithExporters() ExtensionOption {
+	return func(ex *Extension) error {
+		ex.templates = append(ex.templates, ExportTemplate)
+		return nil
+	}
+}
+
+// WithEncryption adds the template generating the hooks encrypting the fields with the EncryptedFieldAnnotation on
+// write, the interceptors decrypting them on read and the key rotation targets re-encrypting them with the current key
+func WithEncryption() ExtensionOption {
+	return func(ex *Extension) error {
+		ex.templates = append(ex.templates, EncryptionTemplate)
+		return nil
+	}
+}
+
+// WithTagHelpers adds the template generating the tag counts, rename, merge and any-of/all-of filter helpers of the
+// schemas with the TagsAnnotation, set by the tag mixin
+func WithTagHelpers() ExtensionOption {
+	return func(ex *Extension) error {
+		ex.templates = append(ex.templates, TagsTemplate)
+		return nil
+	}
+}
+
+// WithOrgScoping adds the template generating the interceptors and hooks scoping the queries and mutations of the
+// schemas with the OrgOwnedSchema annotation to the organization of the caller, registered with an entx.OrgScope
+func WithOrgScoping() ExtensionOption {
+	return func(ex *Extension) error {
+		ex.templates = append(ex.templates, OrgScopeTemplate)
+		return nil
+	}
+}
+
+// WithAnnotationLint adds a hook checking the entx annotations of the schemas before the code is generated, the
+// issues are logged and fail the generation in strict mode
+func WithAnnotationLint(strict bool, opts ...LintOption) ExtensionOption {
+	return func(ex *Extension) error {
+		ex.hooks = append(ex.hooks, lintHook(strict, opts...))
+		return nil
+	}
+}
+
 // NewExtension returns an entc Extension that allows the entx package to generate
 // the schema changes and templates needed to function
 func NewExtension(opts ...ExtensionOption) (*Extension, error) {
 	e := &Extension{
 		templates:      []*gen.Template{},
+		hooks:          []gen.Hook{},
 		gqlSchemaHooks: []entgql.SchemaHook{},
 	}
 
@@ -48,6 +123,11 @@ func (e *Extension) Templates() []*gen.Template {
 	return e.templates
 }
 
+// Hooks of the extension
+func (e *Extension) Hooks() []gen.Hook {
+	return e.hooks
+}
+
 // GQLSchemaHooks of the extension to seamlessly edit the final gql interface
 func (e *Extension) GQLSchemaHooks() []entgql.SchemaHook {
 	return e.gqlSchemaHooks
@@ -0,0 +1,393 @@
+package genhooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"entgo.io/ent/entc/gen"
+	"github.com/rs/zerolog/log"
+
+	"github.com/theopenlane/entx"
+)
+
+const (
+	// catalogJSONFile is the name of the machine-readable annotation catalog
+	catalogJSONFile = "annotation_catalog.json"
+	// catalogMarkdownFile is the name of the markdown feature matrix
+	catalogMarkdownFile = "annotation_catalog.md"
+	// entxAnnotationPrefix is the prefix of the entx annotation names
+	entxAnnotationPrefix = "OPENLANE_"
+)
+
+// CatalogConfig holds configuration options for the annotation catalog generation
+type CatalogConfig struct {
+	outputDir string
+	markdown  bool
+	json      bool
+}
+
+// CatalogOption adds functional params for CatalogConfig
+type CatalogOption func(*CatalogConfig)
+
+// WithCatalogOutputDir sets the directory to output the annotation catalog files
+func WithCatalogOutputDir(dir string) CatalogOption {
+	return func(c *CatalogConfig) {
+		c.outputDir = dir
+	}
+}
+
+// WithCatalogMarkdown sets whether the markdown feature matrix is generated, true by default
+func WithCatalogMarkdown(enabled bool) CatalogOption {
+	return func(c *CatalogConfig) {
+		c.markdown = enabled
+	}
+}
+
+// WithCatalogJSON sets whether the JSON catalog is generated, true by default
+func WithCatalogJSON(enabled bool) CatalogOption {
+	return func(c *CatalogConfig) {
+		c.json = enabled
+	}
+}
+
+// AnnotationCatalog lists the entx annotations set on the schemas, their fields and their edges
+type AnnotationCatalog struct {
+	// Schemas of the graph, in name order
+	Schemas []CatalogSchema `json:"schemas"`
+}
+
+// CatalogSchema is a schema of the annotation catalog
+type CatalogSchema struct {
+	// Name is the schema name (e.g., ActionPlan)
+	Name string `json:"name"`
+	// Features are the features the annotations of the schema and its fields enable
+	Features CatalogFeatures `json:"features"`
+	// Annotations are the decoded schema annotations by annotation name
+	Annotations map[string]any `json:"annotations,omitempty"`
+	// Fields are the fields with entx annotations, in schema order
+	Fields []CatalogField `json:"fields,omitempty"`
+	// Edges are the edges with entx annotations, in schema order
+	Edges []CatalogField `json:"edges,omitempty"`
+}
+
+// CatalogField is a field or an edge of the annotation catalog
+type CatalogField struct {
+	// Name is the ent field or edge name
+	Name string `json:"name"`
+	// Annotations are the decoded annotations by annotation name
+	Annotations map[string]any `json:"annotations"`
+}
+
+// CatalogFeatures are the features enabled on a schema by its annotations
+type CatalogFeatures struct {
+	// Searchable is set when the schema has searchable fields and search is not skipped
+	Searchable bool `json:"searchable"`
+	// Exportable is set when the schema has the Exportable annotation
+	Exportable bool `json:"exportable"`
+	// WorkflowEligible is set when fields of the schema can be modified through workflows
+	WorkflowEligible bool `json:"workflowEligible"`
+	// CSVReference is set when fields or edges of the schema are resolved from CSV references
+	CSVReference bool `json:"csvReference"`
+	// IntegrationMapping is set when the schema or its fields are integration mapping targets
+	IntegrationMapping bool `json:"integrationMapping"`
+	// WebhookPayload is set when fields of the schema are included in webhook payloads
+	WebhookPayload bool `json:"webhookPayload"`
+	// TaskRules is set when the schema or its fields generate suggested tasks
+	TaskRules bool `json:"taskRules"`
+	// Cascade is set when deletes of the schema cascade to other schemas
+	Cascade bool `json:"cascade"`
+	// Retention is set when soft deleted records of the schema are purged after a retention window
+	Retention bool `json:"retention"`
+	// OrgOwned is set when the schema is org owned
+	OrgOwned bool `json:"orgOwned"`
+	// SystemOwned is set when the schema can have system owned objects
+	SystemOwned bool `json:"systemOwned"`
+}
+
+// GenAnnotationCatalog generates a JSON catalog and a markdown feature matrix of the entx annotations of the schemas
+func GenAnnotationCatalog(opts ...CatalogOption) gen.Hook {
+	return func(next gen.Generator) gen.Generator {
+		return gen.GenerateFunc(func(g *gen.Graph) error {
+			c := &CatalogConfig{
+				markdown: true,
+				json:     true,
+			}
+
+			for _, opt := range opts {
+				opt(c)
+			}
+
+			if c.outputDir == "" {
+				return next.Generate(g)
+			}
+
+			if err := generateAnnotationCatalog(c, NewAnnotationCatalog(g.Nodes)); err != nil {
+				return err
+			}
+
+			return next.Generate(g)
+		})
+	}
+}
+
+// NewAnnotationCatalog decodes the entx annotations of the schemas into a catalog
+func NewAnnotationCatalog(nodes []*gen.Type) *AnnotationCatalog {
+	catalog := &AnnotationCatalog{
+		Schemas: make([]CatalogSchema, 0, len(nodes)),
+	}
+
+	for _, n := range nodes {
+		catalog.Schemas = append(catalog.Schemas, newCatalogSchema(n))
+	}
+
+	slices.SortFunc(catalog.Schemas, func(a, b CatalogSchema) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return catalog
+}
+
+// newCatalogSchema decodes the annotations of the schema, its fields and its edges
+func newCatalogSchema(n *gen.Type) CatalogSchema {
+	s := CatalogSchema{
+		Name:        n.Name,
+		Annotations: decodeCatalogAnnotations(n.Annotations),
+	}
+
+	for _, f := range n.Fields {
+		if ants := decodeCatalogAnnotations(f.Annotations); len(ants) > 0 {
+			s.Fields = append(s.Fields, CatalogField{Name: f.Name, Annotations: ants})
+		}
+	}
+
+	for _, e := range n.Edges {
+		if ants := decodeCatalogAnnotations(e.Annotations); len(ants) > 0 {
+			s.Edges = append(s.Edges, CatalogField{Name: e.Name, Annotations: ants})
+		}
+	}
+
+	s.Features = catalogFeatures(s)
+
+	return s
+}
+
+// decodeCatalogAnnotations decodes the registered annotations, the entx annotations that are not registered are kept
+// as their raw value
+func decodeCatalogAnnotations(raw gen.Annotations) map[string]any {
+	ants := map[string]any{}
+	registered := entx.RegisteredAnnotations()
+
+	for name, v := range raw {
+		if !slices.Contains(registered, name) {
+			if strings.HasPrefix(name, entxAnnotationPrefix) {
+				ants[name] = v
+			}
+
+			continue
+		}
+
+		decoded, err := entx.DecodeRegisteredAnnotation(name, v)
+		if err != nil {
+			log.Warn().Err(err).Str("annotation", name).Msg("failed decoding annotation for the catalog")
+
+			ants[name] = v
+
+			continue
+		}
+
+		ants[name] = decoded
+	}
+
+	return ants
+}
+
+// catalogFeatures returns the features enabled by the decoded annotations of the schema
+func catalogFeatures(s CatalogSchema) CatalogFeatures {
+	features := CatalogFeatures{}
+
+	_, features.Exportable = s.Annotations["Exportable"]
+	_, features.Retention = s.Annotations[entx.RetentionAnnotationName]
+	_, features.OrgOwned = s.Annotations[entx.OrgOwnedSchemaName]
+	_, features.SystemOwned = s.Annotations[entx.SystemOwnedSchemaName]
+	_, features.Cascade = s.Annotations[entx.CascadeThroughAnnotationName]
+	_, features.TaskRules = s.Annotations[entx.TaskRuleAnnotationName]
+	_, features.IntegrationMapping = s.Annotations[entx.IntegrationMappingSchemaAnnotationName]
+
+	skipSearch := false
+	if a, ok := s.Annotations[entx.SchemaGenAnnotationName].(*entx.SchemaGenAnnotation); ok {
+		skipSearch = a.Skip || a.SkipSearch
+	}
+
+	for _, f := range s.Fields {
+		if a, ok := f.Annotations[entx.SearchFieldAnnotationName].(*entx.SearchFieldAnnotation); ok && a.Searchable {
+			features.Searchable = !skipSearch
+		}
+
+		if a, ok := f.Annotations[entx.WorkflowEligibleAnnotationName].(*entx.WorkflowEligibleAnnotation); ok && a.Eligible {
+			features.WorkflowEligible = true
+		}
+
+		if a, ok := f.Annotations[entx.WebhookPayloadFieldAnnotationName].(*entx.WebhookPayloadFieldAnnotation); ok && a.Include {
+			features.WebhookPayload = true
+		}
+
+		if _, ok := f.Annotations[entx.IntegrationMappingFieldAnnotationName]; ok {
+			features.IntegrationMapping = true
+		}
+
+		if _, ok := f.Annotations[entx.TaskRuleAnnotationName]; ok {
+			features.TaskRules = true
+		}
+
+		if _, ok := f.Annotations[entx.CSVReferenceAnnotationName]; ok {
+			features.CSVReference = true
+		}
+	}
+
+	for _, e := range s.Edges {
+		if _, ok := e.Annotations[entx.CSVReferenceAnnotationName]; ok {
+			features.CSVReference = true
+		}
+
+		if _, ok := e.Annotations[entx.CascadeAnnotationName]; ok {
+			features.Cascade = true
+		}
+	}
+
+	return features
+}
+
+// catalogColumns are the columns of the markdown feature matrix
+var catalogColumns = []struct {
+	title   string
+	enabled func(CatalogFeatures) bool
+}{
+	{"Searchable", func(f CatalogFeatures) bool { return f.Searchable }},
+	{"Exportable", func(f CatalogFeatures) bool { return f.Exportable }},
+	{"Workflow eligible", func(f CatalogFeatures) bool { return f.WorkflowEligible }},
+	{"CSV reference", func(f CatalogFeatures) bool { return f.CSVReference }},
+	{"Integration mapping", func(f CatalogFeatures) bool { return f.IntegrationMapping }},
+	{"Webhook payload", func(f CatalogFeatures) bool { return f.WebhookPayload }},
+	{"Task rules", func(f CatalogFeatures) bool { return f.TaskRules }},
+	{"Cascade", func(f CatalogFeatures) bool { return f.Cascade }},
+	{"Retention", func(f CatalogFeatures) bool { return f.Retention }},
+	{"Org owned", func(f CatalogFeatures) bool { return f.OrgOwned }},
+	{"System owned", func(f CatalogFeatures) bool { return f.SystemOwned }},
+}
+
+// Markdown returns the feature matrix of the schemas followed by the annotations of each schema, its fields and its
+// edges
+func (c *AnnotationCatalog) Markdown() (string, error) {
+	var b strings.Builder
+
+	b.WriteString("<!-- Code generated by entx, DO NOT EDIT. -->\n\n# Annotation catalog\n\n| Schema |")
+
+	for _, col := range catalogColumns {
+		b.WriteString(" " + col.title + " |")
+	}
+
+	b.WriteString("\n| --- |" + strings.Repeat(" :---: |", len(catalogColumns)) + "\n")
+
+	for _, s := range c.Schemas {
+		fmt.Fprintf(&b, "| [%s](#%s) |", s.Name, strings.ToLower(s.Name))
+
+		for _, col := range catalogColumns {
+			if col.enabled(s.Features) {
+				b.WriteString(" ✓ |")
+			} else {
+				b.WriteString("   |")
+			}
+		}
+
+		b.WriteString("\n")
+	}
+
+	for _, s := range c.Schemas {
+		if len(s.Annotations) == 0 && len(s.Fields) == 0 && len(s.Edges) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&b, "\n## %s\n\n| Target | Name | Annotation | Value |\n| --- | --- | --- | --- |\n", s.Name)
+
+		rows := []struct {
+			target string
+			fields []CatalogField
+		}{
+			{"schema", []CatalogField{{Name: s.Name, Annotations: s.Annotations}}},
+			{"field", s.Fields},
+			{"edge", s.Edges},
+		}
+
+		for _, row := range rows {
+			for _, f := range row.fields {
+				names := make([]string, 0, len(f.Annotations))
+				for name := range f.Annotations {
+					names = append(names, name)
+				}
+
+				slices.Sort(names)
+
+				for _, name := range names {
+					value, err := json.Marshal(f.Annotations[name])
+					if err != nil {
+						return "", err
+					}
+
+					fmt.Fprintf(&b, "| %s | %s | %s | `%s` |\n", row.target, f.Name, name, strings.ReplaceAll(string(value), "|", `\|`))
+				}
+			}
+		}
+	}
+
+	return b.String(), nil
+}
+
+// generateAnnotationCatalog writes the catalog files to the output directory
+func generateAnnotationCatalog(c *CatalogConfig, catalog *AnnotationCatalog) error {
+	if err := os.MkdirAll(c.outputDir, dirPermissions); err != nil {
+		log.Error().Err(err).Str("path", c.outputDir).Msg("failed to create annotation catalog output directory")
+
+		return err
+	}
+
+	if c.json {
+		out, err := json.MarshalIndent(catalog, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		if err := writeCatalogFile(filepath.Join(c.outputDir, catalogJSONFile), append(out, '\n')); err != nil {
+			return err
+		}
+	}
+
+	if c.markdown {
+		out, err := catalog.Markdown()
+		if err != nil {
+			return err
+		}
+
+		if err := writeCatalogFile(filepath.Join(c.outputDir, catalogMarkdownFile), []byte(out)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeCatalogFile writes a catalog file
+func writeCatalogFile(path string, content []byte) error {
+	if err := os.WriteFile(filepath.Clean(path), content, 0o600); err != nil { //nolint:mnd
+		log.Error().Err(err).Str("path", path).Msg("failed to write annotation catalog file")
+
+		return err
+	}
+
+	log.Debug().Str("path", path).Msg("generated annotation catalog file")
+
+	return nil
+}
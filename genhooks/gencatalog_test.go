@@ -0,0 +1,132 @@
+package genhooks
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"entgo.io/ent/entc/gen"
+	"entgo.io/ent/schema/field"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theopenlane/entx"
+)
+
+func catalogNodes() []*gen.Type {
+	user := &gen.Type{
+		Name:        "User",
+		Annotations: map[string]any{},
+	}
+
+	task := &gen.Type{
+		Name: "Task",
+		Annotations: map[string]any{
+			"Exportable":            map[string]any{"OrgOwned": true},
+			entx.OrgOwnedSchemaName: map[string]any{},
+			entx.IntegrationMappingSchemaAnnotationName: map[string]any{"Include": []any{"title"}},
+			"OPENLANE_CUSTOM": "custom",
+			"EntGQL":          map[string]any{"QueryField": map[string]any{}},
+		},
+		Fields: []*gen.Field{
+			{
+				Name: "title",
+				Type: &field.TypeInfo{Type: field.TypeString},
+				Annotations: map[string]any{
+					entx.SearchFieldAnnotationName:      map[string]any{"Searchable": true},
+					entx.WorkflowEligibleAnnotationName: map[string]any{"Eligible": true},
+					entx.DisplayNameAnnotationName:      map[string]any{},
+				},
+			},
+			{
+				Name:        "details",
+				Type:        &field.TypeInfo{Type: field.TypeString},
+				Annotations: map[string]any{},
+			},
+		},
+		Edges: []*gen.Edge{
+			{
+				Name: "assignee",
+				Type: user,
+				Annotations: map[string]any{
+					entx.CSVReferenceAnnotationName: map[string]any{"CSVColumn": "AssigneeEmail", "MatchField": "email"},
+				},
+			},
+		},
+	}
+
+	return []*gen.Type{task, user}
+}
+
+func TestNewAnnotationCatalog(t *testing.T) {
+	catalog := NewAnnotationCatalog(catalogNodes())
+	require.Len(t, catalog.Schemas, 2)
+
+	task := catalog.Schemas[0]
+	assert.Equal(t, "Task", task.Name)
+	assert.Equal(t, CatalogFeatures{
+		Searchable:         true,
+		Exportable:         true,
+		WorkflowEligible:   true,
+		CSVReference:       true,
+		IntegrationMapping: true,
+		OrgOwned:           true,
+	}, task.Features)
+
+	assert.Equal(t, &entx.Exportable{OrgOwned: true}, task.Annotations["Exportable"])
+	assert.Equal(t, &entx.IntegrationMappingSchemaAnnotation{Include: []string{"title"}}, task.Annotations[entx.IntegrationMappingSchemaAnnotationName])
+	assert.Equal(t, &entx.OrgOwnedSchema{}, task.Annotations[entx.OrgOwnedSchemaName])
+	assert.Equal(t, "custom", task.Annotations["OPENLANE_CUSTOM"])
+	assert.NotContains(t, task.Annotations, "EntGQL")
+
+	require.Len(t, task.Fields, 1)
+	assert.Equal(t, "title", task.Fields[0].Name)
+	assert.Equal(t, &entx.SearchFieldAnnotation{Searchable: true}, task.Fields[0].Annotations[entx.SearchFieldAnnotationName])
+	assert.Equal(t, &entx.DisplayNameAnnotation{}, task.Fields[0].Annotations[entx.DisplayNameAnnotationName])
+
+	require.Len(t, task.Edges, 1)
+	assert.Equal(t, &entx.CSVReferenceAnnotation{CSVColumn: "AssigneeEmail", MatchField: "email"}, task.Edges[0].Annotations[entx.CSVReferenceAnnotationName])
+
+	user := catalog.Schemas[1]
+	assert.Equal(t, CatalogSchema{Name: "User", Annotations: map[string]any{}}, user)
+}
+
+func TestAnnotationCatalogMarkdown(t *testing.T) {
+	out, err := NewAnnotationCatalog(catalogNodes()).Markdown()
+	require.NoError(t, err)
+
+	assert.Contains(t, out, "| Schema | Searchable | Exportable | Workflow eligible | CSV reference | Integration mapping |")
+	assert.Contains(t, out, "| [Task](#task) | ✓ | ✓ | ✓ | ✓ | ✓ |   |   |   |   | ✓ |   |\n")
+	assert.Contains(t, out, "| [User](#user) |   |")
+	assert.Contains(t, out, "## Task\n")
+	assert.NotContains(t, out, "## User\n")
+	assert.Contains(t, out, "| schema | Task | Exportable | `{\"OrgOwned\":true,\"HasSystemOwned\":false}` |\n")
+	assert.Contains(t, out, "| field | title | OPENLANE_SEARCH | `{\"Searchable\":true,\"ExcludeAdmin\":false,\"JSONPath\":\"\",\"JSONDotPath\":\"\"}` |\n")
+	assert.Contains(t, out, "| edge | assignee | OPENLANE_CSV_REFERENCE |")
+}
+
+func TestGenAnnotationCatalog(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "catalog")
+
+	generated := false
+	next := gen.GenerateFunc(func(*gen.Graph) error {
+		generated = true
+		return nil
+	})
+
+	err := GenAnnotationCatalog(WithCatalogOutputDir(dir), WithCatalogMarkdown(false))(next).Generate(&gen.Graph{Nodes: catalogNodes()})
+	require.NoError(t, err)
+	assert.True(t, generated)
+
+	raw, err := os.ReadFile(filepath.Join(dir, catalogJSONFile))
+	require.NoError(t, err)
+
+	var catalog AnnotationCatalog
+
+	require.NoError(t, json.Unmarshal(raw, &catalog))
+	require.Len(t, catalog.Schemas, 2)
+	assert.True(t, catalog.Schemas[0].Features.Searchable)
+
+	assert.NoFileExists(t, filepath.Join(dir, catalogMarkdownFile))
+}
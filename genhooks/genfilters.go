@@ -52,6 +52,46 @@ func WithStringSliceWhereOps() entgql.SchemaHook {
 	}
 }
 
+// WithTagWhereOps is a schema hook that adds "HasAny" and "HasAll" filter operations for the tags field of the schemas with the entx.TagsAnnotation in the generated GraphQL where input types. For example, a "tagsHasAny" field taking a list of tags is added to filter the records with any of them, the resolvers apply it with the TagsAnyOf and TagsAllOf predicates generated with entx.WithTagHelpers
+func WithTagWhereOps() entgql.SchemaHook {
+	return func(g *gen.Graph, s *ast.Schema) error {
+		for _, n := range g.Schemas {
+			ant, ok := entx.GetAnnotation[*entx.TagsAnnotation](n)
+			if !ok || ant.Field == "" {
+				continue
+			}
+
+			if entSkipWhere(n) {
+				continue
+			}
+
+			whereDef := s.Types[n.Name+"WhereInput"]
+			if whereDef == nil || whereDef.Kind != ast.InputObject {
+				continue
+			}
+
+			existing := map[string]bool{}
+			for _, f := range whereDef.Fields {
+				existing[f.Name] = true
+			}
+
+			for _, f := range n.Fields {
+				if f.Name != ant.Field || entSkipWhere(f) {
+					continue
+				}
+
+				fieldName := strcase.LowerCamelCase(f.Name)
+				list := ast.ListType(ast.NonNullNamedType("String", nil), nil)
+
+				addInputField(whereDef, existing, fieldName+"HasAny", list)
+				addInputField(whereDef, existing, fieldName+"HasAll", list)
+			}
+		}
+
+		return nil
+	}
+}
+
 // entSkipWhere checks if the field has entgql.SkipWhereInput, entgql.SkipType which indicate that the field should be skipped when generating where input filter types
 func entSkipWhere[T any](t T) bool {
 	entAnt, ok := entx.GetAnnotation[*entgql.Annotation](t)
@@ -7,6 +7,9 @@ import (
 	"entgo.io/ent/entc/gen"
 	"entgo.io/ent/entc/load"
 	"github.com/stretchr/testify/assert"
+	"github.com/vektah/gqlparser/v2/ast"
+
+	"github.com/theopenlane/entx"
 )
 
 func TestEntSkipWhere(t *testing.T) {
@@ -132,3 +135,58 @@ func TestEntSkipWhere(t *testing.T) {
 		})
 	}
 }
+
+func TestWithTagWhereOps(t *testing.T) {
+	tagsAnt := entx.TagsAnnotation{Field: "tags"}
+
+	graph := &gen.Graph{
+		Schemas: []*load.Schema{
+			{
+				Name:        "Note",
+				Annotations: gen.Annotations{tagsAnt.Name(): tagsAnt},
+				Fields: []*load.Field{
+					{Name: "name"},
+					{Name: "tags"},
+				},
+			},
+			{
+				Name: "Task",
+				Fields: []*load.Field{
+					{Name: "tags"},
+				},
+			},
+			{
+				Name: "Hidden",
+				Annotations: gen.Annotations{
+					tagsAnt.Name(): tagsAnt,
+					entgql.Annotation{}.Name(): entgql.Annotation{
+						Skip: entgql.SkipWhereInput,
+					},
+				},
+				Fields: []*load.Field{
+					{Name: "tags"},
+				},
+			},
+		},
+	}
+
+	s := &ast.Schema{Types: map[string]*ast.Definition{}}
+	for _, name := range []string{"NoteWhereInput", "TaskWhereInput", "HiddenWhereInput"} {
+		s.Types[name] = &ast.Definition{Name: name, Kind: ast.InputObject}
+	}
+
+	// the existing fields are kept as they are
+	s.Types["NoteWhereInput"].Fields = ast.FieldList{{Name: "tagsHasAll", Type: ast.NamedType("String", nil)}}
+
+	err := WithTagWhereOps()(graph, s)
+	assert.NoError(t, err)
+
+	note := s.Types["NoteWhereInput"].Fields
+	assert.Len(t, note, 2)
+	assert.Equal(t, "String", note[0].Type.String())
+	assert.Equal(t, "tagsHasAny", note[1].Name)
+	assert.Equal(t, "[String!]", note[1].Type.String())
+
+	assert.Empty(t, s.Types["TaskWhereInput"].Fields)
+	assert.Empty(t, s.Types["HiddenWhereInput"].Fields)
+}
@@ -0,0 +1,428 @@
+package entx
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	entsql "entgo.io/ent/dialect/sql"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultHealthTimeout is the default time allowed for each database check
+const DefaultHealthTimeout = 5 * time.Second
+
+// DefaultHealthDivergenceWindow is the default time the replication is reported degraded after a write diverged
+const DefaultHealthDivergenceWindow = 15 * time.Minute
+
+// HealthStatus is the overall state of a checked component
+type HealthStatus string
+
+const (
+	// HealthStatusUp is reported when the component is fully working
+	HealthStatusUp HealthStatus = "up"
+	// HealthStatusDegraded is reported when the component works with reduced capability, e.g. the
+	// secondary or a replica is unavailable while the primary is up
+	HealthStatusDegraded HealthStatus = "degraded"
+	// HealthStatusDown is reported when the component is not working
+	HealthStatusDown HealthStatus = "down"
+)
+
+// DatabaseRole is the role of a connection in the client config
+type DatabaseRole string
+
+const (
+	// DatabaseRolePrimary is the primary database
+	DatabaseRolePrimary DatabaseRole = "primary"
+	// DatabaseRoleSecondary is the secondary database writes are copied to
+	DatabaseRoleSecondary DatabaseRole = "secondary"
+	// DatabaseRoleReplica is a read replica
+	DatabaseRoleReplica DatabaseRole = "replica"
+)
+
+// PoolStats are the connection pool statistics of a database
+type PoolStats struct {
+	// MaxOpenConnections is the maximum number of open connections, 0 is unlimited
+	MaxOpenConnections int `json:"maxopenconnections"`
+	// OpenConnections is the number of established connections, in use or idle
+	OpenConnections int `json:"openconnections"`
+	// InUse is the number of connections in use
+	InUse int `json:"inuse"`
+	// Idle is the number of idle connections
+	Idle int `json:"idle"`
+	// WaitCount is the number of connections waited for
+	WaitCount int64 `json:"waitcount"`
+	// WaitDuration is the total time blocked waiting for a connection
+	WaitDuration time.Duration `json:"waitduration"`
+	// MaxIdleClosed is the number of connections closed due to the idle connection limit
+	MaxIdleClosed int64 `json:"maxidleclosed"`
+	// MaxIdleTimeClosed is the number of connections closed due to the idle time limit
+	MaxIdleTimeClosed int64 `json:"maxidletimeclosed"`
+	// MaxLifetimeClosed is the number of connections closed due to the lifetime limit
+	MaxLifetimeClosed int64 `json:"maxlifetimeclosed"`
+}
+
+// DatabaseHealth is the health of a single database connection
+type DatabaseHealth struct {
+	// Name identifies the connection, e.g. primary or replica-0
+	Name string `json:"name"`
+	// Role is the role of the connection
+	Role DatabaseRole `json:"role"`
+	// Status is up when the database answered the ping, down otherwise
+	Status HealthStatus `json:"status"`
+	// Latency is the ping round trip time
+	Latency time.Duration `json:"latency"`
+	// Error is the ping error, if any
+	Error string `json:"error,omitempty"`
+	// Pool are the connection pool statistics
+	Pool PoolStats `json:"pool"`
+}
+
+// ReplicationHealth is the health of the secondary writes
+type ReplicationHealth struct {
+	// Mode is sync when writes go to both databases in the same request, async when replayed from an outbox
+	Mode string `json:"mode"`
+	// Status is degraded when the secondary is unavailable, lagging, stale or a write diverged within the divergence window
+	Status HealthStatus `json:"status"`
+	// Divergences is the total number of writes committed to the primary but not the secondary
+	Divergences int64 `json:"divergences"`
+	// LastDivergence is when the last write was committed to the primary but not the secondary, if any was
+	LastDivergence time.Time `json:"lastdivergence,omitzero"`
+	// Pending is the number of async writes waiting to be replayed
+	Pending int `json:"pending"`
+	// Behind is the age of the oldest async write waiting to be replayed
+	Behind time.Duration `json:"behind"`
+	// Error describes why the replication is degraded, if it is
+	Error string `json:"error,omitempty"`
+}
+
+// MigrationHealth is the migration state of the primary database
+type MigrationHealth struct {
+	MigrationStatus
+
+	// Status is degraded when migrations are pending or the status could not be read
+	Status HealthStatus `json:"status"`
+	// Error is the error reading the migration status, if any
+	Error string `json:"error,omitempty"`
+}
+
+// HealthReport is the health of all the database connections of a client config
+type HealthReport struct {
+	// Status is down when the primary is down, degraded when anything else is not fully working
+	Status HealthStatus `json:"status"`
+	// CheckedAt is when the checks started
+	CheckedAt time.Time `json:"checkedat"`
+	// Databases is the health of each connection, primary first
+	Databases []DatabaseHealth `json:"databases"`
+	// Replication is the health of the secondary writes, if a secondary is set
+	Replication *ReplicationHealth `json:"replication,omitempty"`
+	// Migrations is the migration state, if migrations are checked
+	Migrations *MigrationHealth `json:"migrations,omitempty"`
+}
+
+// HealthOption configures a HealthChecker
+type HealthOption func(*HealthChecker)
+
+// WithHealthTimeout sets the time allowed for each database check
+func WithHealthTimeout(timeout time.Duration) HealthOption {
+	return func(h *HealthChecker) {
+		h.timeout = timeout
+	}
+}
+
+// WithHealthMaxReplicationLag sets how far behind async secondary writes may be before the replication is
+// reported degraded, by default any pending write older than the check timeout degrades it
+func WithHealthMaxReplicationLag(maxLag time.Duration) HealthOption {
+	return func(h *HealthChecker) {
+		h.maxLag = maxLag
+	}
+}
+
+// WithHealthDivergenceWindow sets how long the replication is reported degraded after a write was committed to the
+// primary but not the secondary, DefaultHealthDivergenceWindow by default
+func WithHealthDivergenceWindow(window time.Duration) HealthOption {
+	return func(h *HealthChecker) {
+		h.divergenceWindow = window
+	}
+}
+
+// WithHealthMigrations enables the migration check using the migration options, e.g. the directory; the migrations
+// are not checked otherwise
+func WithHealthMigrations(opts ...MigrationOption) HealthOption {
+	return func(h *HealthChecker) {
+		h.checkMigrations = true
+		h.migrationOpts = opts
+	}
+}
+
+// HealthChecker checks the database connections of a client config
+type HealthChecker struct {
+	ec               *EntClientConfig
+	timeout          time.Duration
+	maxLag           time.Duration
+	divergenceWindow time.Duration
+	checkMigrations  bool
+	migrationOpts    []MigrationOption
+}
+
+// NewHealthChecker returns a health checker for the client config connections
+func NewHealthChecker(ec *EntClientConfig, opts ...HealthOption) *HealthChecker {
+	h := &HealthChecker{
+		ec:               ec,
+		timeout:          DefaultHealthTimeout,
+		divergenceWindow: DefaultHealthDivergenceWindow,
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	if h.maxLag <= 0 {
+		h.maxLag = h.timeout
+	}
+
+	return h
+}
+
+// Check runs the health checks, the databases are checked concurrently
+func (h *HealthChecker) Check(ctx context.Context) HealthReport {
+	report := HealthReport{CheckedAt: time.Now()}
+
+	type target struct {
+		name string
+		role DatabaseRole
+		drv  *entsql.Driver
+		// err is why the connection is not available, e.g. the secondary in degraded mode
+		err error
+	}
+
+	targets := []target{{name: string(DatabaseRolePrimary), role: DatabaseRolePrimary, drv: h.ec.primaryDB}}
+
+	secondary := h.ec.GetSecondaryDB()
+	hasSecondary := secondary != nil || h.ec.secondaryRetry > 0
+
+	if hasSecondary {
+		targets = append(targets, target{name: string(DatabaseRoleSecondary), role: DatabaseRoleSecondary, drv: secondary, err: h.ec.SecondaryError()})
+	}
+
+	for i, r := range h.ec.replicaDBs {
+		targets = append(targets, target{name: string(DatabaseRoleReplica) + "-" + strconv.Itoa(i), role: DatabaseRoleReplica, drv: r})
+	}
+
+	report.Databases = make([]DatabaseHealth, len(targets))
+
+	var wg sync.WaitGroup
+
+	for i, t := range targets {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if t.drv == nil {
+				// the secondary may connect between reading the connection and the error
+				err := t.err
+				if err == nil {
+					err = ErrSecondaryNotConnected
+				}
+
+				report.Databases[i] = DatabaseHealth{Name: t.name, Role: t.role, Status: HealthStatusDown, Error: err.Error()}
+
+				return
+			}
+
+			report.Databases[i] = h.checkDatabase(ctx, t.name, t.role, t.drv.DB())
+		}()
+	}
+
+	wg.Wait()
+
+	if hasSecondary {
+		report.Replication = h.checkReplication(ctx, report.Databases[1])
+	}
+
+	// the migration status can only be read from a working primary
+	if h.checkMigrations && report.Databases[0].Status == HealthStatusUp {
+		report.Migrations = h.checkMigrationStatus(ctx)
+	}
+
+	report.Status = report.status()
+
+	return report
+}
+
+// Healthcheck returns a check that fails only when the primary database is down, so a degraded
+// secondary or replica does not take the service out of rotation
+func (h *HealthChecker) Healthcheck() func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		report := h.Check(ctx)
+		if report.Status != HealthStatusDown {
+			return nil
+		}
+
+		return fmt.Errorf("%w: %s", ErrDatabaseUnavailable, report.Databases[0].Error)
+	}
+}
+
+// Handler returns an HTTP readiness handler serving the health report as JSON; it responds
+// with 503 Service Unavailable when the report is down and 200 OK otherwise
+func (h *HealthChecker) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := h.Check(r.Context())
+
+		code := http.StatusOK
+		if report.Status == HealthStatusDown {
+			code = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(code)
+
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			log.Error().Err(err).Msg("failed writing database health report")
+		}
+	})
+}
+
+// checkDatabase pings the database and reads its pool statistics
+func (h *HealthChecker) checkDatabase(ctx context.Context, name string, role DatabaseRole, db *sql.DB) DatabaseHealth {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	health := DatabaseHealth{Name: name, Role: role, Status: HealthStatusUp}
+
+	start := time.Now()
+	err := db.PingContext(ctx)
+	health.Latency = time.Since(start)
+
+	if err != nil {
+		health.Status = HealthStatusDown
+		health.Error = err.Error()
+	}
+
+	health.Pool = newPoolStats(db.Stats())
+
+	return health
+}
+
+// checkReplication reports the health of the secondary writes
+func (h *HealthChecker) checkReplication(ctx context.Context, secondary DatabaseHealth) *ReplicationHealth {
+	health := &ReplicationHealth{Mode: "sync", Status: HealthStatusUp}
+
+	if mw := h.ec.getMultiWrite(); mw != nil {
+		health.Divergences = mw.Divergences()
+		health.LastDivergence = mw.LastDivergence()
+
+		if !health.LastDivergence.IsZero() && time.Since(health.LastDivergence) < h.divergenceWindow {
+			health.Status = HealthStatusDegraded
+			health.Error = fmt.Sprintf("writes diverged within the last %s, %d in total", h.divergenceWindow, health.Divergences)
+		}
+	}
+
+	// the writes made before a degraded secondary was connected were never sent to it
+	if missed := h.ec.missedWrites(); missed > 0 {
+		health.Divergences += missed
+		health.Status = HealthStatusDegraded
+		health.Error = fmt.Sprintf("%s: %d writes", ErrSecondaryStale, missed)
+	}
+
+	if h.ec.replicator != nil {
+		health.Mode = "async"
+
+		ctx, cancel := context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+
+		lag, err := h.ec.replicator.Lag(ctx)
+
+		health.Pending = lag.Pending
+		health.Behind = lag.Behind
+
+		switch {
+		case err != nil:
+			health.Status = HealthStatusDegraded
+			health.Error = fmt.Sprintf("replication lag check failed: %s", err)
+		case lag.Behind > h.maxLag:
+			health.Status = HealthStatusDegraded
+			health.Error = fmt.Sprintf("%s: %d pending writes, %s behind", ErrReplicationLag, lag.Pending, lag.Behind)
+		}
+	}
+
+	if secondary.Status != HealthStatusUp {
+		health.Status = HealthStatusDegraded
+		health.Error = "secondary database unavailable: " + secondary.Error
+	}
+
+	return health
+}
+
+// checkMigrationStatus reports the migrations pending on the primary database
+func (h *HealthChecker) checkMigrationStatus(ctx context.Context) *MigrationHealth {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	health := &MigrationHealth{Status: HealthStatusUp}
+
+	status, err := GetMigrationStatus(ctx, h.ec, h.migrationOpts...)
+	if err != nil {
+		health.Status = HealthStatusDegraded
+		health.Error = err.Error()
+
+		return health
+	}
+
+	health.MigrationStatus = *status
+
+	if len(status.Pending) > 0 {
+		health.Status = HealthStatusDegraded
+	}
+
+	return health
+}
+
+// status returns the overall status of the report
+func (r HealthReport) status() HealthStatus {
+	status := HealthStatusUp
+
+	for _, db := range r.Databases {
+		if db.Status == HealthStatusUp {
+			continue
+		}
+
+		if db.Role == DatabaseRolePrimary {
+			return HealthStatusDown
+		}
+
+		status = HealthStatusDegraded
+	}
+
+	if r.Replication != nil && r.Replication.Status != HealthStatusUp {
+		status = HealthStatusDegraded
+	}
+
+	if r.Migrations != nil && r.Migrations.Status != HealthStatusUp {
+		status = HealthStatusDegraded
+	}
+
+	return status
+}
+
+// newPoolStats returns the pool statistics of the database stats
+func newPoolStats(s sql.DBStats) PoolStats {
+	return PoolStats{
+		MaxOpenConnections: s.MaxOpenConnections,
+		OpenConnections:    s.OpenConnections,
+		InUse:              s.InUse,
+		Idle:               s.Idle,
+		WaitCount:          s.WaitCount,
+		WaitDuration:       s.WaitDuration,
+		MaxIdleClosed:      s.MaxIdleClosed,
+		MaxIdleTimeClosed:  s.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  s.MaxLifetimeClosed,
+	}
+}
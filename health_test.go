@@ -0,0 +1,168 @@
+package entx_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theopenlane/entx"
+)
+
+// newHealthClient returns a sqlite client config with a secondary and a replica
+func newHealthClient(t *testing.T) *entx.EntClientConfig {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	ec, err := entx.NewDBConfig(entx.Config{
+		DriverName:        entx.DriverSQLite3,
+		PrimaryDBSource:   filepath.Join(dir, "primary.db"),
+		SecondaryDBSource: filepath.Join(dir, "secondary.db"),
+		ReplicaDBSources:  []string{filepath.Join(dir, "primary.db")},
+	}, entx.WithSecondaryDB())
+	require.NoError(t, err)
+
+	t.Cleanup(func() { ec.GetDriver().Close() })
+
+	return ec
+}
+
+func TestHealthCheckerUp(t *testing.T) {
+	ec := newHealthClient(t)
+
+	report := entx.NewHealthChecker(ec).Check(context.Background())
+
+	assert.Equal(t, entx.HealthStatusUp, report.Status)
+	require.Len(t, report.Databases, 3)
+
+	names := []string{}
+	for _, db := range report.Databases {
+		names = append(names, db.Name)
+
+		assert.Equal(t, entx.HealthStatusUp, db.Status)
+		assert.Empty(t, db.Error)
+		assert.Positive(t, db.Latency)
+	}
+
+	assert.Equal(t, []string{"primary", "secondary", "replica-0"}, names)
+	assert.Equal(t, entx.DatabaseRoleReplica, report.Databases[2].Role)
+
+	require.NotNil(t, report.Replication)
+	assert.Equal(t, "sync", report.Replication.Mode)
+	assert.Equal(t, entx.HealthStatusUp, report.Replication.Status)
+	assert.Nil(t, report.Migrations)
+}
+
+func TestHealthCheckerDegraded(t *testing.T) {
+	ec := newHealthClient(t)
+	h := entx.NewHealthChecker(ec)
+
+	require.NoError(t, ec.GetSecondaryDB().Close())
+
+	report := h.Check(context.Background())
+
+	assert.Equal(t, entx.HealthStatusDegraded, report.Status)
+	assert.Equal(t, entx.HealthStatusUp, report.Databases[0].Status)
+	assert.Equal(t, entx.HealthStatusDown, report.Databases[1].Status)
+	assert.NotEmpty(t, report.Databases[1].Error)
+	assert.Equal(t, entx.HealthStatusDegraded, report.Replication.Status)
+
+	// a degraded secondary does not fail the readiness check
+	require.NoError(t, h.Healthcheck()(context.Background()))
+
+	rec := httptest.NewRecorder()
+	h.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestHealthCheckerDivergences(t *testing.T) {
+	ctx := context.Background()
+	ec := newHealthClient(t)
+
+	// the deferred foreign key only fails the secondary commit, after the primary committed
+	require.NoError(t, ec.GetPrimaryDB().Exec(ctx, "CREATE TABLE users (id integer PRIMARY KEY, org_id integer)", []any{}, nil))
+	require.NoError(t, ec.GetSecondaryDB().Exec(ctx, "CREATE TABLE orgs (id integer PRIMARY KEY)", []any{}, nil))
+	require.NoError(t, ec.GetSecondaryDB().Exec(ctx, "CREATE TABLE users (id integer PRIMARY KEY, org_id integer REFERENCES orgs (id) DEFERRABLE INITIALLY DEFERRED)", []any{}, nil))
+
+	h := entx.NewHealthChecker(ec)
+
+	report := h.Check(ctx)
+	assert.Equal(t, entx.HealthStatusUp, report.Replication.Status)
+	assert.True(t, report.Replication.LastDivergence.IsZero())
+
+	require.NoError(t, ec.GetDriver().Exec(ctx, "INSERT INTO users (id, org_id) VALUES (?, ?)", []any{1, 1}, nil))
+
+	// every probe sees the divergence within the window, not only the first one
+	for _, checker := range []*entx.HealthChecker{h, h, entx.NewHealthChecker(ec)} {
+		report = checker.Check(ctx)
+
+		assert.Equal(t, entx.HealthStatusDegraded, report.Status)
+		assert.Equal(t, entx.HealthStatusDegraded, report.Replication.Status)
+		assert.Equal(t, int64(1), report.Replication.Divergences)
+		assert.False(t, report.Replication.LastDivergence.IsZero())
+	}
+
+	// the total is kept once the window has passed
+	report = entx.NewHealthChecker(ec, entx.WithHealthDivergenceWindow(time.Nanosecond)).Check(ctx)
+	assert.Equal(t, entx.HealthStatusUp, report.Status)
+	assert.Equal(t, int64(1), report.Replication.Divergences)
+}
+
+func TestHealthCheckerDown(t *testing.T) {
+	ec := newHealthClient(t)
+	h := entx.NewHealthChecker(ec)
+
+	require.NoError(t, ec.GetPrimaryDB().Close())
+
+	assert.ErrorIs(t, h.Healthcheck()(context.Background()), entx.ErrDatabaseUnavailable)
+
+	rec := httptest.NewRecorder()
+	h.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var report entx.HealthReport
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&report))
+
+	assert.Equal(t, entx.HealthStatusDown, report.Status)
+	assert.Equal(t, entx.HealthStatusDown, report.Databases[0].Status)
+}
+
+func TestHealthCheckerMigrations(t *testing.T) {
+	ctx := context.Background()
+	ec := newMigrationClient(t, entx.MigrationProviderAtlas, true)
+
+	dir := newMigrationDir(t, map[string]string{
+		"20240101000000_users.sql": "CREATE TABLE users (id integer PRIMARY KEY);\n",
+	})
+
+	h := entx.NewHealthChecker(ec, entx.WithHealthMigrations(entx.WithMigrationDir(dir)))
+
+	report := h.Check(ctx)
+
+	assert.Equal(t, entx.HealthStatusDegraded, report.Status)
+	require.NotNil(t, report.Migrations)
+	assert.Equal(t, []string{"20240101000000_users.sql"}, report.Migrations.Pending)
+	assert.Zero(t, report.Migrations.Applied)
+
+	require.NoError(t, entx.RunMigrations(ctx, ec, nil, entx.WithMigrationDir(dir)))
+
+	report = h.Check(ctx)
+
+	assert.Equal(t, entx.HealthStatusUp, report.Status)
+	assert.Empty(t, report.Migrations.Pending)
+	assert.Equal(t, 1, report.Migrations.Applied)
+	assert.Equal(t, "20240101000000", report.Migrations.Current)
+
+	// the migrations are only checked when enabled
+	assert.Nil(t, entx.NewHealthChecker(ec).Check(ctx).Migrations)
+}
@@ -0,0 +1,519 @@
+package entx
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"entgo.io/ent/entc"
+	"entgo.io/ent/entc/gen"
+	"entgo.io/ent/schema"
+	"entgo.io/ent/schema/field"
+	"github.com/rs/zerolog/log"
+)
+
+// LintIssue is a problem found in the entx annotations of a schema
+type LintIssue struct {
+	// Schema the annotation is set on
+	Schema string
+	// Field or edge the annotation is set on, empty for schema annotations
+	Field string
+	// Pos is the filename:line position of the schema, when known
+	Pos string
+	// Annotation is the name of the annotation
+	Annotation string
+	// Message describes the problem
+	Message string
+}
+
+// String returns the issue with its location
+func (i LintIssue) String() string {
+	location := i.Schema
+	if i.Field != "" {
+		location += "." + i.Field
+	}
+
+	if i.Pos != "" {
+		location = i.Pos + ": " + location
+	}
+
+	return fmt.Sprintf("%s: %s: %s", location, i.Annotation, i.Message)
+}
+
+// LintRule checks the annotations of a schema of the graph and reports the problems found
+type LintRule func(l *Linter, n *gen.Type)
+
+// Linter checks the entx annotations of the schemas of a graph
+type Linter struct {
+	nodes  []*gen.Type
+	rules  []LintRule
+	issues []LintIssue
+}
+
+// LintOption configures a Linter
+type LintOption func(*Linter)
+
+// WithLintRules adds rules to the built-in rules, e.g. for annotations defined outside of entx
+func WithLintRules(rules ...LintRule) LintOption {
+	return func(l *Linter) {
+		l.rules = append(l.rules, rules...)
+	}
+}
+
+// LintSchema loads the graph of the schema package and checks the annotations of its schemas
+func LintSchema(schemaPath string, opts ...LintOption) ([]LintIssue, error) {
+	g, err := entc.LoadGraph(schemaPath, &gen.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	return LintGraph(g, opts...), nil
+}
+
+// LintGraph checks the annotations of the schemas of the graph and returns all the problems found
+func LintGraph(g *gen.Graph, opts ...LintOption) []LintIssue {
+	l := &Linter{
+		nodes: g.Nodes,
+		rules: []LintRule{
+			lintCascade,
+			lintRetention,
+			lintFGA,
+			lintConsoleRoute,
+			lintFieldMarkers,
+			lintCSVReferences,
+			lintIntegrationMapping,
+			lintSearch,
+			lintTaskRules,
+			lintFileCategory,
+			lintExportable,
+			lintEncrypted,
+			lintTags,
+		},
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	for _, n := range l.nodes {
+		for _, rule := range l.rules {
+			rule(l, n)
+		}
+	}
+
+	return l.issues
+}
+
+// Nodes returns the schemas of the graph
+func (l *Linter) Nodes() []*gen.Type {
+	return l.nodes
+}
+
+// Node returns the schema with the name
+func (l *Linter) Node(name string) *gen.Type {
+	return findNode(l.nodes, name)
+}
+
+// Report adds an issue with the annotation of the schema, field is empty for schema annotations
+func (l *Linter) Report(n *gen.Type, field, annotation, format string, args ...any) {
+	l.issues = append(l.issues, LintIssue{
+		Schema:     n.Name,
+		Field:      field,
+		Pos:        schemaPos(n),
+		Annotation: annotation,
+		Message:    fmt.Sprintf(format, args...),
+	})
+}
+
+// LintDecode decodes the annotation from the annotations, reporting an issue when it cannot be decoded
+func LintDecode[T schema.Annotation](l *Linter, n *gen.Type, field string, ants gen.Annotations) (T, bool) {
+	out, ok, err := LookupAnnotation[T](ants)
+	if err != nil {
+		l.Report(n, field, annotationName[T](), "cannot be decoded: %v", err)
+
+		return out, false
+	}
+
+	return out, ok
+}
+
+// lintCascade checks the cascade annotations reference existing schemas and edges
+func lintCascade(l *Linter, n *gen.Type) {
+	for _, e := range n.Edges {
+		ant, ok := LintDecode[*CascadeAnnotation](l, n, e.Name, e.Annotations)
+		if !ok {
+			continue
+		}
+
+		if _, err := newCascadeTemplateStep(n, e.Type, ant.Field); err != nil {
+			l.Report(n, e.Name, CascadeAnnotationName, "%s has no edge %q to %s", e.Type.Name, ant.Field, n.Name)
+		}
+	}
+
+	ant, ok := LintDecode[*CascadeThroughAnnotation](l, n, "", n.Annotations)
+	if !ok {
+		return
+	}
+
+	for _, s := range ant.Schemas {
+		child := l.Node(s.Through)
+		if child == nil {
+			l.Report(n, "", CascadeThroughAnnotationName, "through schema %q does not exist", s.Through)
+			continue
+		}
+
+		if _, err := newCascadeTemplateStep(n, child, s.Field); err != nil {
+			l.Report(n, "", CascadeThroughAnnotationName, "%s has no edge %q to %s", child.Name, s.Field, n.Name)
+		}
+	}
+}
+
+// lintRetention checks the retention window applies to a soft deletable schema
+func lintRetention(l *Linter, n *gen.Type) {
+	ant, ok := LintDecode[*RetentionAnnotation](l, n, "", n.Annotations)
+	if !ok {
+		return
+	}
+
+	switch {
+	case ant.Window <= 0:
+		l.Report(n, "", RetentionAnnotationName, "retention window must be positive")
+	case !isSoftDeletable(n):
+		l.Report(n, "", RetentionAnnotationName, "schema is not soft deletable")
+	}
+}
+
+// lintFGA checks the fga parents exist
+func lintFGA(l *Linter, n *gen.Type) {
+	LintDecode[*FGACrudAnnotation](l, n, "", n.Annotations)
+
+	ant, ok := LintDecode[*FGAParentCrudAnnotation](l, n, "", n.Annotations)
+	if !ok {
+		return
+	}
+
+	for _, p := range ant.ParentSchemas {
+		// the organization does not need to be a schema of the graph
+		if l.Node(p) == nil && !strings.EqualFold(p, "organization") {
+			l.Report(n, "", FGACrudParentAnnotationName, "parent schema %q does not exist", p)
+		}
+	}
+}
+
+// lintConsoleRoute checks the console route links objects through a path segment or a query parameter
+func lintConsoleRoute(l *Linter, n *gen.Type) {
+	ant, ok := LintDecode[*ConsoleRouteAnnotation](l, n, "", n.Annotations)
+	if !ok {
+		return
+	}
+
+	if ant.IDParam != "" && ant.Suffix != "" {
+		l.Report(n, "", ConsoleRouteAnnotationName, "IDParam %q and Suffix %q are mutually exclusive", ant.IDParam, ant.Suffix)
+	}
+}
+
+// lintFieldMarkers checks the display name, mention source and approval markers are set on at most one field of
+// the right type
+func lintFieldMarkers(l *Linter, n *gen.Type) {
+	var display, mentionJSON, mentionText, status, approver []string
+
+	for _, f := range n.Fields {
+		if _, ok := f.Annotations[DisplayNameAnnotationName]; ok {
+			display = append(display, f.Name)
+		}
+
+		if _, ok := f.Annotations[MentionSourceAnnotationName]; ok {
+			switch fieldType(f) {
+			case field.TypeJSON:
+				mentionJSON = append(mentionJSON, f.Name)
+			case field.TypeString:
+				mentionText = append(mentionText, f.Name)
+			default:
+				l.Report(n, f.Name, MentionSourceAnnotationName, "mention source must be a string or JSON field")
+			}
+		}
+
+		if _, ok := f.Annotations[ApprovalStatusAnnotationName]; ok {
+			status = append(status, f.Name)
+
+			if fieldType(f) != field.TypeEnum {
+				l.Report(n, f.Name, ApprovalStatusAnnotationName, "approval status must be an enum field")
+			}
+		}
+
+		if _, ok := f.Annotations[ApprovalApproverAnnotationName]; ok {
+			approver = append(approver, f.Name)
+
+			if fieldType(f) != field.TypeString {
+				l.Report(n, f.Name, ApprovalApproverAnnotationName, "approval approver must be a string field")
+			}
+		}
+	}
+
+	for name, fields := range map[string][]string{
+		DisplayNameAnnotationName:      display,
+		MentionSourceAnnotationName:    mentionJSON,
+		ApprovalStatusAnnotationName:   status,
+		ApprovalApproverAnnotationName: approver,
+	} {
+		if len(fields) > 1 {
+			l.Report(n, fields[1], name, "set on more than one field: %s", strings.Join(fields, ", "))
+		}
+	}
+
+	if len(mentionText) > 1 {
+		l.Report(n, mentionText[1], MentionSourceAnnotationName, "set on more than one field: %s", strings.Join(mentionText, ", "))
+	}
+
+	orgOwned := HasAnnotation[OrgOwnedSchema](n)
+
+	if (len(mentionJSON) > 0 || len(mentionText) > 0) && !orgOwned {
+		l.Report(n, "", MentionSourceAnnotationName, "mention scanning requires an org owned schema")
+	}
+
+	if (len(status) > 0) != (len(approver) > 0) {
+		l.Report(n, "", ApprovalStatusAnnotationName, "approval requires both a status and an approver field")
+	}
+
+	if len(status) > 0 && len(approver) > 0 && !orgOwned {
+		l.Report(n, "", ApprovalStatusAnnotationName, "approval flow requires an org owned schema")
+	}
+}
+
+// lintCSVReferences checks the csv references have a column, a target schema and a match field on the target
+func lintCSVReferences(l *Linter, n *gen.Type) {
+	check := func(name string, ants gen.Annotations, target string) {
+		ant, ok := LintDecode[*CSVReferenceAnnotation](l, n, name, ants)
+		if !ok {
+			return
+		}
+
+		if ant.CSVColumn == "" {
+			l.Report(n, name, CSVReferenceAnnotationName, "CSVColumn is required")
+		}
+
+		if ant.TargetEntity != "" {
+			target = ant.TargetEntity
+		}
+
+		if target == "" {
+			l.Report(n, name, CSVReferenceAnnotationName, "TargetEntity is required when the field has no edge")
+			return
+		}
+
+		t := l.Node(target)
+		if t == nil {
+			l.Report(n, name, CSVReferenceAnnotationName, "TargetEntity %q does not exist", target)
+			return
+		}
+
+		switch {
+		case ant.MatchField == "":
+			l.Report(n, name, CSVReferenceAnnotationName, "MatchField is required")
+		case !hasField(t, ant.MatchField):
+			l.Report(n, name, CSVReferenceAnnotationName, "MatchField %q is not a field of %s", ant.MatchField, target)
+		}
+	}
+
+	for _, f := range n.Fields {
+		target := ""
+
+		for _, e := range n.Edges {
+			if e.Field() == f {
+				target = e.Type.Name
+			}
+		}
+
+		check(f.Name, f.Annotations, target)
+	}
+
+	for _, e := range n.Edges {
+		check(e.Name, e.Annotations, e.Type.Name)
+	}
+}
+
+// lintIntegrationMapping checks the integration mapping includes and excludes name fields of the schema and the
+// mapping keys are unique
+func lintIntegrationMapping(l *Linter, n *gen.Type) {
+	keys := map[string]string{}
+
+	for _, f := range n.Fields {
+		ant, ok := LintDecode[*IntegrationMappingFieldAnnotation](l, n, f.Name, f.Annotations)
+		if !ok || ant.Key == "" {
+			continue
+		}
+
+		if other, ok := keys[ant.Key]; ok {
+			l.Report(n, f.Name, IntegrationMappingFieldAnnotationName, "key %q is also used by %s", ant.Key, other)
+		}
+
+		keys[ant.Key] = f.Name
+	}
+
+	ant, ok := LintDecode[*IntegrationMappingSchemaAnnotation](l, n, "", n.Annotations)
+	if !ok {
+		return
+	}
+
+	for _, name := range ant.Include {
+		if !hasField(n, name) {
+			l.Report(n, "", IntegrationMappingSchemaAnnotationName, "included field %q does not exist", name)
+		}
+
+		if slices.Contains(ant.Exclude, name) {
+			l.Report(n, "", IntegrationMappingSchemaAnnotationName, "field %q is both included and excluded", name)
+		}
+	}
+
+	for _, name := range ant.Exclude {
+		if !hasField(n, name) {
+			l.Report(n, "", IntegrationMappingSchemaAnnotationName, "excluded field %q does not exist", name)
+		}
+	}
+}
+
+// lintSearch checks json paths are only set on json fields
+func lintSearch(l *Linter, n *gen.Type) {
+	LintDecode[*SchemaGenAnnotation](l, n, "", n.Annotations)
+	LintDecode[*QueryGenAnnotation](l, n, "", n.Annotations)
+
+	for _, f := range n.Fields {
+		ant, ok := LintDecode[*SearchFieldAnnotation](l, n, f.Name, f.Annotations)
+		if !ok {
+			continue
+		}
+
+		if (ant.JSONPath != "" || ant.JSONDotPath != "") && fieldType(f) != field.TypeJSON {
+			l.Report(n, f.Name, SearchFieldAnnotationName, "json path set on a %s field", fieldType(f))
+		}
+	}
+}
+
+// lintTaskRules checks the task rules have a rule id and a known trigger
+func lintTaskRules(l *Linter, n *gen.Type) {
+	check := func(name string, ants gen.Annotations) {
+		ant, ok := LintDecode[*TaskRuleAnnotation](l, n, name, ants)
+		if !ok {
+			return
+		}
+
+		for i, rule := range ant.Rules {
+			if rule.RuleID == "" {
+				l.Report(n, name, TaskRuleAnnotationName, "rule %d has no RuleID", i)
+			}
+
+			switch rule.Trigger {
+			case "", TaskRuleOnCreateOrUpdate, TaskRuleOnCreateOnly:
+			default:
+				l.Report(n, name, TaskRuleAnnotationName, "rule %q has an unknown trigger %q", rule.RuleID, rule.Trigger)
+			}
+		}
+	}
+
+	check("", n.Annotations)
+
+	for _, f := range n.Fields {
+		check(f.Name, f.Annotations)
+	}
+}
+
+// lintFileCategory checks the file category is set
+func lintFileCategory(l *Linter, n *gen.Type) {
+	ant, ok := LintDecode[*FileCategoryAnnotation](l, n, "", n.Annotations)
+	if ok && ant.Category == "" {
+		l.Report(n, "", FileCategoryAnnotationName, "category is empty")
+	}
+}
+
+// lintExportable checks the exported fields exist and the owner filters have their fields
+func lintExportable(l *Linter, n *gen.Type) {
+	ant, ok := LintDecode[*Exportable](l, n, "", n.Annotations)
+	if !ok || n.ID == nil {
+		return
+	}
+
+	if _, err := newExportNode(n, ant); err != nil {
+		l.Report(n, "", ant.Name(), "%s", strings.TrimPrefix(err.Error(), ErrInvalidExportable.Error()+": "))
+	}
+}
+
+// lintEncrypted checks the encrypted fields can be encrypted
+func lintEncrypted(l *Linter, n *gen.Type) {
+	for _, f := range n.Fields {
+		if !HasAnnotation[EncryptedFieldAnnotation](f) {
+			continue
+		}
+
+		if _, err := newEncryptedField(n, f); err != nil {
+			prefix := fmt.Sprintf("%s: %s.%s ", ErrInvalidEncryptedField, n.Name, f.Name)
+			l.Report(n, f.Name, EncryptedFieldAnnotationName, "%s", strings.TrimPrefix(err.Error(), prefix))
+		}
+	}
+}
+
+// fieldType returns the ent type of the field
+func fieldType(f *gen.Field) field.Type {
+	if f.Type == nil {
+		return field.TypeInvalid
+	}
+
+	return f.Type.Type
+}
+
+// schemaPos returns the position of the schema, empty for types not loaded from a schema package
+func schemaPos(n *gen.Type) (pos string) {
+	defer func() {
+		if recover() != nil {
+			pos = ""
+		}
+	}()
+
+	return n.Pos()
+}
+
+// hasField reports whether the schema has the field, the id included
+func hasField(n *gen.Type, name string) bool {
+	if n.ID != nil && n.ID.Name == name {
+		return true
+	}
+
+	for _, f := range n.Fields {
+		if f.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lintHook checks the annotations before the code is generated, failing the generation on problems in strict mode
+func lintHook(strict bool, opts ...LintOption) gen.Hook {
+	return func(next gen.Generator) gen.Generator {
+		return gen.GenerateFunc(func(g *gen.Graph) error {
+			issues := LintGraph(g, opts...)
+
+			for _, i := range issues {
+				log.Warn().Str("schema", i.Schema).Str("field", i.Field).Str("annotation", i.Annotation).Msg(i.Message)
+			}
+
+			if strict && len(issues) > 0 {
+				return &LintError{Issues: issues}
+			}
+
+			return next.Generate(g)
+		})
+	}
+}
+
+// lintTags checks the tags annotation names a []string field
+func lintTags(l *Linter, n *gen.Type) {
+	ant, ok := LintDecode[*TagsAnnotation](l, n, "", n.Annotations)
+	if !ok {
+		return
+	}
+
+	if _, err := newTagNode(n, ant); err != nil {
+		prefix := fmt.Sprintf("%s: %s.%s ", ErrInvalidTags, n.Name, ant.Field)
+		l.Report(n, ant.Field, TagsAnnotationName, "%s", strings.TrimPrefix(err.Error(), prefix))
+	}
+}
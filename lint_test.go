@@ -0,0 +1,159 @@
+package entx_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"entgo.io/ent"
+	"entgo.io/ent/entc/gen"
+	"entgo.io/ent/entc/load"
+	"entgo.io/ent/schema"
+	"entgo.io/ent/schema/edge"
+	"entgo.io/ent/schema/field"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theopenlane/entx"
+)
+
+// LintTask has one of each annotation mistake
+type LintTask struct{ ent.Schema }
+
+func (LintTask) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("title").Annotations(entx.DisplayName()),
+		field.String("slug").Annotations(entx.DisplayName()),
+		field.String("summary").Annotations(entx.FieldJSONPathSearchable("$.summary")),
+		field.Int("assignee_id").Optional().Annotations(entx.CSVRef().FromColumn("AssigneeEmail").MatchOn("email")),
+		field.String("control_id").Annotations(entx.CSVRef().FromColumn("ControlRefCode").MatchOn("ref_code").TargetEntity("Control")),
+		field.String("external_id").Annotations(entx.IntegrationMappingField().Key("externalID")),
+		field.String("source_id").Annotations(entx.IntegrationMappingField().Key("externalID")),
+	}
+}
+
+func (LintTask) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.To("assignee", LintUser.Type).Field("assignee_id").Unique(),
+	}
+}
+
+func (LintTask) Annotations() []schema.Annotation {
+	return []schema.Annotation{
+		entx.ConsoleRoute(entx.WithConsoleIDParam("id"), entx.WithConsoleSuffix("view")),
+		entx.IntegrationMappingSchema().Include("title", "due_date").Exclude("title"),
+		entx.RetentionWindow(time.Hour),
+		entx.SchemaTaskRule(entx.TaskRuleSpec{RuleID: "review", Trigger: "onDelete"}),
+	}
+}
+
+type LintUser struct{ ent.Schema }
+
+func (LintUser) Fields() []ent.Field {
+	return []ent.Field{field.String("name")}
+}
+
+// lintGraph builds the graph of the schemas
+func lintGraph(t *testing.T, schemas ...ent.Interface) *gen.Graph {
+	t.Helper()
+
+	loaded := make([]*load.Schema, 0, len(schemas))
+
+	for _, s := range schemas {
+		raw, err := load.MarshalSchema(s)
+		require.NoError(t, err)
+
+		ls, err := load.UnmarshalSchema(raw)
+		require.NoError(t, err)
+
+		loaded = append(loaded, ls)
+	}
+
+	graph, err := gen.NewGraph(&gen.Config{
+		Schema:  "example.com/lint/schema",
+		Package: "example.com/lint/ent",
+		IDType:  &field.TypeInfo{Type: field.TypeInt},
+	}, loaded...)
+	require.NoError(t, err)
+
+	return graph
+}
+
+func TestLintGraph(t *testing.T) {
+	issues := entx.LintGraph(lintGraph(t, LintTask{}, LintUser{}))
+
+	messages := make([]string, 0, len(issues))
+	for _, i := range issues {
+		messages = append(messages, i.String())
+	}
+
+	assert.ElementsMatch(t, []string{
+		`LintTask.slug: OPENLANE_DISPLAY_NAME: set on more than one field: title, slug`,
+		`LintTask.summary: OPENLANE_SEARCH: json path set on a string field`,
+		`LintTask.assignee_id: OPENLANE_CSV_REFERENCE: MatchField "email" is not a field of LintUser`,
+		`LintTask.control_id: OPENLANE_CSV_REFERENCE: TargetEntity "Control" does not exist`,
+		`LintTask.source_id: OPENLANE_INTEGRATION_MAPPING_FIELD: key "externalID" is also used by external_id`,
+		`LintTask: OPENLANE_CONSOLE_ROUTE: IDParam "id" and Suffix "view" are mutually exclusive`,
+		`LintTask: OPENLANE_INTEGRATION_MAPPING_SCHEMA: included field "due_date" does not exist`,
+		`LintTask: OPENLANE_INTEGRATION_MAPPING_SCHEMA: field "title" is both included and excluded`,
+		`LintTask: OPENLANE_RETENTION: schema is not soft deletable`,
+		`LintTask: OPENLANE_TASK_RULE: rule "review" has an unknown trigger "onDelete"`,
+	}, messages)
+
+	assert.Empty(t, entx.LintGraph(lintGraph(t, Organization{}, Group{}, Invite{}, Membership{})))
+}
+
+func TestLintGraphRules(t *testing.T) {
+	rule := func(l *entx.Linter, n *gen.Type) {
+		if n.Name == "LintUser" {
+			l.Report(n, "name", "CUSTOM", "custom rule for %s", n.Name)
+		}
+	}
+
+	issues := entx.LintGraph(lintGraph(t, LintUser{}), entx.WithLintRules(rule))
+	require.Len(t, issues, 1)
+	assert.Equal(t, "LintUser.name: CUSTOM: custom rule for LintUser", issues[0].String())
+}
+
+func TestLintGraphCascade(t *testing.T) {
+	issues := entx.LintGraph(lintGraph(t, invalidCascade{}, invalidChild{}))
+	require.NotEmpty(t, issues)
+	assert.Equal(t, entx.CascadeAnnotationName, issues[0].Annotation)
+}
+
+func TestLintGraphExportable(t *testing.T) {
+	issues := entx.LintGraph(lintGraph(t, invalidExport{}))
+	require.Len(t, issues, 1)
+	assert.Equal(t, `invalidExport: Exportable: invalidExport has no field "missing"`, issues[0].String())
+}
+
+func TestAnnotationLintHook(t *testing.T) {
+	generated := false
+	next := gen.GenerateFunc(func(*gen.Graph) error {
+		generated = true
+		return nil
+	})
+
+	graph := lintGraph(t, LintTask{}, LintUser{})
+
+	ext, err := entx.NewExtension(entx.WithAnnotationLint(false))
+	require.NoError(t, err)
+	require.Len(t, ext.Hooks(), 1)
+
+	require.NoError(t, ext.Hooks()[0](next).Generate(graph))
+	assert.True(t, generated)
+
+	generated = false
+
+	ext, err = entx.NewExtension(entx.WithAnnotationLint(true))
+	require.NoError(t, err)
+
+	err = ext.Hooks()[0](next).Generate(graph)
+
+	var lintErr *entx.LintError
+
+	require.ErrorAs(t, err, &lintErr)
+	assert.True(t, errors.Is(err, entx.ErrInvalidAnnotations))
+	assert.Len(t, lintErr.Issues, 10)
+	assert.False(t, generated)
+}
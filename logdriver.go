@@ -0,0 +1,336 @@
+package entx
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"entgo.io/ent/dialect"
+	"github.com/XSAM/otelsql"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/theopenlane/utils/contextx"
+	"github.com/theopenlane/utils/ulids"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Span attributes added to the otelsql statement spans by the LogDriver settings
+const (
+	// AttributeTxID is the id of the transaction the statement ran in
+	AttributeTxID = attribute.Key("db.transaction.id")
+	// AttributeSlowQuery is set to true when the statement took longer than the slow query threshold
+	AttributeSlowQuery = attribute.Key("db.statement.slow")
+	// AttributeDuration is the statement duration in milliseconds, set on slow statements
+	AttributeDuration = attribute.Key("db.statement.duration_ms")
+)
+
+var txIDKey = contextx.NewKey[string]()
+
+// TxIDFromContext returns the id the LogDriver assigned to the transaction the context runs in
+func TxIDFromContext(ctx context.Context) (string, bool) {
+	return txIDKey.Get(ctx)
+}
+
+// LogOption configures a LogDriver
+type LogOption func(*LogDriver)
+
+// WithLogger sets the logger the statements are written to, the global logger is used by default
+func WithLogger(logger zerolog.Logger) LogOption {
+	return func(d *LogDriver) {
+		d.logger = logger
+	}
+}
+
+// WithStatementLogging logs every statement at debug level
+func WithStatementLogging(enabled bool) LogOption {
+	return func(d *LogDriver) {
+		d.statements = enabled
+	}
+}
+
+// WithSlowQueryThreshold logs statements taking longer than the threshold at warn level, 0 disables it
+func WithSlowQueryThreshold(threshold time.Duration) LogOption {
+	return func(d *LogDriver) {
+		d.slowThreshold = threshold
+	}
+}
+
+// LogDriver is a dialect.Driver that logs the statements with their duration and redacted arguments;
+// every transaction is assigned an id that is logged with its statements and added to the context
+type LogDriver struct {
+	dialect.Driver
+
+	logger        zerolog.Logger
+	statements    bool
+	slowThreshold time.Duration
+}
+
+var _ dialect.Driver = (*LogDriver)(nil)
+
+// NewLogDriver returns a driver logging the statements run on drv
+func NewLogDriver(drv dialect.Driver, opts ...LogOption) *LogDriver {
+	d := &LogDriver{
+		Driver: drv,
+		logger: log.Logger,
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
+}
+
+// Query runs and logs the query
+func (d *LogDriver) Query(ctx context.Context, query string, args, v any) error {
+	start := time.Now()
+	err := d.Driver.Query(ctx, query, args, v)
+
+	d.log(ctx, "query", query, args, time.Since(start), err)
+
+	return err
+}
+
+// Exec runs and logs the statement
+func (d *LogDriver) Exec(ctx context.Context, query string, args, v any) error {
+	start := time.Now()
+	err := d.Driver.Exec(ctx, query, args, v)
+
+	d.log(ctx, "exec", query, args, time.Since(start), err)
+
+	return err
+}
+
+// Tx starts a transaction with a new id
+func (d *LogDriver) Tx(ctx context.Context) (dialect.Tx, error) {
+	return d.begin(ctx, func(ctx context.Context) (dialect.Tx, error) {
+		return d.Driver.Tx(ctx)
+	})
+}
+
+// BeginTx calls the underlying driver BeginTx command if it is supported and falls back to Tx otherwise
+func (d *LogDriver) BeginTx(ctx context.Context, opts *sql.TxOptions) (dialect.Tx, error) {
+	return d.begin(ctx, func(ctx context.Context) (dialect.Tx, error) {
+		if b, ok := d.Driver.(interface {
+			BeginTx(context.Context, *sql.TxOptions) (dialect.Tx, error)
+		}); ok {
+			return b.BeginTx(ctx, opts)
+		}
+
+		return d.Driver.Tx(ctx)
+	})
+}
+
+// begin starts and logs the transaction
+func (d *LogDriver) begin(ctx context.Context, start func(context.Context) (dialect.Tx, error)) (dialect.Tx, error) {
+	id := ulids.New().String()
+	ctx = txIDKey.Set(ctx, id)
+
+	tx, err := start(ctx)
+	if err != nil {
+		d.logger.Error().Err(err).Str("tx_id", id).Msg("failed starting database transaction")
+
+		return nil, err
+	}
+
+	if d.statements {
+		d.logger.Debug().Str("tx_id", id).Msg("database transaction started")
+	}
+
+	return &logTx{Tx: tx, driver: d, id: id, start: time.Now()}, nil
+}
+
+// log writes the statement to the logger; failed and slow statements are always logged, the
+// others only when statement logging is enabled
+func (d *LogDriver) log(ctx context.Context, method, query string, args any, took time.Duration, err error) {
+	slow := d.slowThreshold > 0 && took >= d.slowThreshold
+
+	var e *zerolog.Event
+
+	switch {
+	case err != nil:
+		e = d.logger.Error().Err(err)
+	case slow:
+		e = d.logger.Warn()
+	case d.statements:
+		e = d.logger.Debug()
+	default:
+		return
+	}
+
+	if id, ok := txIDKey.Get(ctx); ok {
+		e = e.Str("tx_id", id)
+	}
+
+	e = e.Str("method", method).
+		Str("query", query).
+		Strs("args", RedactArgs(args)).
+		Dur("duration", took)
+
+	if slow {
+		e = e.Bool("slow", true)
+	}
+
+	e.Msg("database statement")
+}
+
+// logTx is a transaction logging its statements with the transaction id
+type logTx struct {
+	dialect.Tx
+
+	driver *LogDriver
+	id     string
+	start  time.Time
+}
+
+// Query runs and logs the query in the transaction
+func (tx *logTx) Query(ctx context.Context, query string, args, v any) error {
+	ctx = txIDKey.Set(ctx, tx.id)
+
+	start := time.Now()
+	err := tx.Tx.Query(ctx, query, args, v)
+
+	tx.driver.log(ctx, "query", query, args, time.Since(start), err)
+
+	return err
+}
+
+// Exec runs and logs the statement in the transaction
+func (tx *logTx) Exec(ctx context.Context, query string, args, v any) error {
+	ctx = txIDKey.Set(ctx, tx.id)
+
+	start := time.Now()
+	err := tx.Tx.Exec(ctx, query, args, v)
+
+	tx.driver.log(ctx, "exec", query, args, time.Since(start), err)
+
+	return err
+}
+
+// Commit commits and logs the transaction
+func (tx *logTx) Commit() error {
+	err := tx.Tx.Commit()
+
+	tx.end("commit", err)
+
+	return err
+}
+
+// Rollback rolls back and logs the transaction
+func (tx *logTx) Rollback() error {
+	err := tx.Tx.Rollback()
+
+	tx.end("rollback", err)
+
+	return err
+}
+
+// end logs the end of the transaction
+func (tx *logTx) end(method string, err error) {
+	if err != nil {
+		tx.driver.logger.Error().Err(err).Str("tx_id", tx.id).Str("method", method).Msg("database transaction failed")
+
+		return
+	}
+
+	if tx.driver.statements {
+		tx.driver.logger.Debug().Str("tx_id", tx.id).Str("method", method).Dur("duration", time.Since(tx.start)).Msg("database transaction ended")
+	}
+}
+
+// RedactArgs returns the types of the statement arguments in place of their values, with the length of
+// strings and bytes, so statements can be logged without leaking the data written
+func RedactArgs(args any) []string {
+	list, ok := args.([]any)
+	if !ok {
+		if args == nil {
+			return nil
+		}
+
+		list = []any{args}
+	}
+
+	redacted := make([]string, 0, len(list))
+
+	for _, arg := range list {
+		switch v := arg.(type) {
+		case nil:
+			redacted = append(redacted, "NULL")
+		case string:
+			redacted = append(redacted, fmt.Sprintf("string(%d)", len(v)))
+		case []byte:
+			redacted = append(redacted, fmt.Sprintf("[]byte(%d)", len(v)))
+		default:
+			redacted = append(redacted, fmt.Sprintf("%T", v))
+		}
+	}
+
+	return redacted
+}
+
+// statementTracerProvider wraps the otelsql tracer provider so the statement spans get the transaction id
+// of the LogDriver and are flagged when they are slower than the threshold
+type statementTracerProvider struct {
+	trace.TracerProvider
+
+	threshold time.Duration
+}
+
+// Tracer returns the wrapped tracer
+func (p statementTracerProvider) Tracer(name string, opts ...trace.TracerOption) trace.Tracer {
+	return statementTracer{Tracer: p.TracerProvider.Tracer(name, opts...), threshold: p.threshold}
+}
+
+// statementTracer adds the statement attributes to the spans it starts
+type statementTracer struct {
+	trace.Tracer
+
+	threshold time.Duration
+}
+
+// Start starts the span with the transaction id of the context
+func (t statementTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if id, ok := txIDKey.Get(ctx); ok {
+		opts = append(opts, trace.WithAttributes(AttributeTxID.String(id)))
+	}
+
+	ctx, span := t.Tracer.Start(ctx, name, opts...)
+
+	if t.threshold <= 0 || !isStatementSpan(name) {
+		return ctx, span
+	}
+
+	span = &statementSpan{Span: span, start: time.Now(), threshold: t.threshold}
+
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+// statementSpan flags the span as slow when it ends after the threshold
+type statementSpan struct {
+	trace.Span
+
+	start     time.Time
+	threshold time.Duration
+}
+
+// End sets the slow query attributes before ending the span
+func (s *statementSpan) End(opts ...trace.SpanEndOption) {
+	if took := time.Since(s.start); took >= s.threshold {
+		s.SetAttributes(AttributeSlowQuery.Bool(true), AttributeDuration.Int64(took.Milliseconds()))
+	}
+
+	s.Span.End(opts...)
+}
+
+// isStatementSpan reports whether the otelsql span name is a statement, rows and transaction
+// spans include time spent by the caller
+func isStatementSpan(name string) bool {
+	switch otelsql.Method(name) {
+	case otelsql.MethodConnExec, otelsql.MethodConnQuery, otelsql.MethodStmtExec, otelsql.MethodStmtQuery:
+		return true
+	default:
+		return false
+	}
+}
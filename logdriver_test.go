@@ -0,0 +1,218 @@
+package entx_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/theopenlane/entx"
+)
+
+// logLines decodes the json log lines written to the buffer
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+
+	var lines []map[string]any
+
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+
+		entry := map[string]any{}
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+
+		lines = append(lines, entry)
+	}
+
+	return lines
+}
+
+func TestLogDriver(t *testing.T) {
+	ctx := context.Background()
+	_, drv := newCacheTestDB(t)
+
+	var buf bytes.Buffer
+
+	logDrv := entx.NewLogDriver(drv, entx.WithLogger(zerolog.New(&buf).Level(zerolog.DebugLevel)), entx.WithStatementLogging(true))
+
+	assert.Equal(t, "funk", queryUserName(t, ctx, logDrv, 1))
+
+	tx, err := logDrv.Tx(ctx)
+	require.NoError(t, err)
+	require.NoError(t, tx.Exec(ctx, "UPDATE `users` SET `name` = ? WHERE `id` = ?", []any{"secret", 1}, nil))
+	require.NoError(t, tx.Commit())
+
+	assert.NotContains(t, buf.String(), "secret")
+
+	lines := logLines(t, &buf)
+	require.Len(t, lines, 4)
+
+	assert.Equal(t, "debug", lines[0]["level"])
+	assert.Equal(t, "query", lines[0]["method"])
+	assert.Equal(t, []any{"int"}, lines[0]["args"])
+	assert.NotContains(t, lines[0], "tx_id")
+	assert.Contains(t, lines[0], "duration")
+
+	txID := lines[1]["tx_id"]
+	assert.NotEmpty(t, txID)
+
+	assert.Equal(t, "exec", lines[2]["method"])
+	assert.Equal(t, []any{"string(6)", "int"}, lines[2]["args"])
+	assert.Equal(t, txID, lines[2]["tx_id"])
+
+	assert.Equal(t, "commit", lines[3]["method"])
+	assert.Equal(t, txID, lines[3]["tx_id"])
+}
+
+func TestLogDriverSlowQuery(t *testing.T) {
+	ctx := context.Background()
+	_, drv := newCacheTestDB(t)
+
+	var buf bytes.Buffer
+
+	logger := zerolog.New(&buf).Level(zerolog.DebugLevel)
+
+	// statements below the threshold are not logged unless statement logging is enabled
+	logDrv := entx.NewLogDriver(drv, entx.WithLogger(logger), entx.WithSlowQueryThreshold(time.Hour))
+	queryUserName(t, ctx, logDrv, 1)
+	assert.Empty(t, buf.String())
+
+	logDrv = entx.NewLogDriver(drv, entx.WithLogger(logger), entx.WithSlowQueryThreshold(time.Nanosecond))
+	queryUserName(t, ctx, logDrv, 1)
+
+	lines := logLines(t, &buf)
+	require.Len(t, lines, 1)
+	assert.Equal(t, "warn", lines[0]["level"])
+	assert.Equal(t, true, lines[0]["slow"])
+}
+
+func TestRedactArgs(t *testing.T) {
+	assert.Equal(t, []string{"string(4)", "[]byte(2)", "NULL", "int", "time.Time"},
+		entx.RedactArgs([]any{"meow", []byte("{}"), nil, 1, time.Time{}}))
+	assert.Nil(t, entx.RedactArgs(nil))
+}
+
+// recordingTracerProvider records the spans started by otelsql
+type recordingTracerProvider struct {
+	embedded.TracerProvider
+
+	mu    sync.Mutex
+	spans []*recordingSpan
+}
+
+func (p *recordingTracerProvider) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return recordingTracer{provider: p}
+}
+
+type recordingTracer struct {
+	noop.Tracer
+
+	provider *recordingTracerProvider
+}
+
+func (r recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	cfg := trace.NewSpanStartConfig(opts...)
+	span := &recordingSpan{name: name, attrs: cfg.Attributes()}
+
+	r.provider.mu.Lock()
+	r.provider.spans = append(r.provider.spans, span)
+	r.provider.mu.Unlock()
+
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+// find returns the attributes of the ended spans with the name
+func (p *recordingTracerProvider) find(name string) []map[attribute.Key]attribute.Value {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var found []map[attribute.Key]attribute.Value
+
+	for _, s := range p.spans {
+		if s.name != name || !s.ended {
+			continue
+		}
+
+		attrs := map[attribute.Key]attribute.Value{}
+		for _, kv := range s.attrs {
+			attrs[kv.Key] = kv.Value
+		}
+
+		found = append(found, attrs)
+	}
+
+	return found
+}
+
+type recordingSpan struct {
+	noop.Span
+
+	name  string
+	attrs []attribute.KeyValue
+	ended bool
+}
+
+func (s *recordingSpan) SetAttributes(kv ...attribute.KeyValue) {
+	s.attrs = append(s.attrs, kv...)
+}
+
+func (s *recordingSpan) End(...trace.SpanEndOption) {
+	s.ended = true
+}
+
+func TestSlowQuerySpans(t *testing.T) {
+	ctx := context.Background()
+
+	provider := &recordingTracerProvider{}
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	ec, err := entx.NewDBConfig(entx.Config{
+		DriverName:         entx.DriverSQLite3,
+		PrimaryDBSource:    filepath.Join(t.TempDir(), "slow.db"),
+		SlowQueryThreshold: time.Nanosecond,
+	})
+	require.NoError(t, err)
+
+	drv := ec.GetDriver()
+	t.Cleanup(func() { drv.Close() })
+
+	require.IsType(t, &entx.LogDriver{}, drv)
+
+	require.NoError(t, drv.Exec(ctx, "CREATE TABLE users (id integer PRIMARY KEY)", []any{}, nil))
+
+	tx, err := drv.Tx(ctx)
+	require.NoError(t, err)
+	require.NoError(t, tx.Exec(ctx, "INSERT INTO users (id) VALUES (?)", []any{1}, nil))
+	require.NoError(t, tx.Commit())
+
+	spans := provider.find("sql.conn.exec")
+	require.Len(t, spans, 2)
+
+	for _, attrs := range spans {
+		assert.True(t, attrs[entx.AttributeSlowQuery].AsBool())
+		assert.Contains(t, attrs, entx.AttributeDuration)
+	}
+
+	// only the statement run in the transaction has a transaction id
+	assert.NotContains(t, spans[0], entx.AttributeTxID)
+	assert.NotEmpty(t, spans[1][entx.AttributeTxID].AsString())
+}
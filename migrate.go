@@ -0,0 +1,558 @@
+package entx
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"ariga.io/atlas/sql/migrate"
+	"ariga.io/atlas/sql/mysql"
+	"ariga.io/atlas/sql/postgres"
+	"ariga.io/atlas/sql/sqlite"
+	"entgo.io/ent/dialect"
+	"entgo.io/ent/dialect/sql/schema"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// MigrationProviderEnt runs the ent auto migration
+	MigrationProviderEnt = "ent"
+	// MigrationProviderAtlas runs the versioned atlas migrations from the migration directory
+	MigrationProviderAtlas = "atlas"
+
+	// DefaultMigrationDir is the directory the versioned migrations are read from
+	DefaultMigrationDir = "migrations"
+	// DefaultMigrationRevisionTable is the table the applied versioned migrations are recorded in
+	DefaultMigrationRevisionTable = "atlas_schema_revisions"
+	// DefaultMigrationLockKey is the postgres advisory lock key held while migrating
+	DefaultMigrationLockKey int64 = 0x656e7478
+)
+
+// MigrateSchema is the schema migrator generated by ent, e.g. client.Schema
+type MigrateSchema interface {
+	// Create runs the auto migration
+	Create(ctx context.Context, opts ...schema.MigrateOption) error
+	// WriteTo writes the auto migration statements instead of running them
+	WriteTo(ctx context.Context, w io.Writer, opts ...schema.MigrateOption) error
+}
+
+// MigrationOption configures RunMigrations
+type MigrationOption func(*migrationConfig)
+
+// migrationConfig contains the RunMigrations settings
+type migrationConfig struct {
+	dir           string
+	revisionTable string
+	lockKey       int64
+	baseline      string
+	dryRun        io.Writer
+	schemaOpts    []schema.MigrateOption
+}
+
+// WithMigrationDir sets the directory versioned migrations are read from, overriding Config.MigrationDir
+func WithMigrationDir(dir string) MigrationOption {
+	return func(c *migrationConfig) {
+		c.dir = dir
+	}
+}
+
+// WithMigrationRevisionTable sets the table the applied versioned migrations are recorded in
+func WithMigrationRevisionTable(table string) MigrationOption {
+	return func(c *migrationConfig) {
+		c.revisionTable = table
+	}
+}
+
+// WithMigrationLockKey sets the postgres advisory lock key held while migrating
+func WithMigrationLockKey(key int64) MigrationOption {
+	return func(c *migrationConfig) {
+		c.lockKey = key
+	}
+}
+
+// WithMigrationBaseline sets the version of an existing database when versioned migrations are first
+// applied to it; migrations up to and including the version are skipped
+func WithMigrationBaseline(version string) MigrationOption {
+	return func(c *migrationConfig) {
+		c.baseline = version
+	}
+}
+
+// WithMigrationDryRun writes the planned statements to w instead of running them; the dry run
+// does not change the database and runs even when Config.RunMigrations is disabled
+func WithMigrationDryRun(w io.Writer) MigrationOption {
+	return func(c *migrationConfig) {
+		c.dryRun = w
+	}
+}
+
+// WithMigrateOptions sets the ent migrate options used by the ent auto migration
+func WithMigrateOptions(opts ...schema.MigrateOption) MigrationOption {
+	return func(c *migrationConfig) {
+		c.schemaOpts = append(c.schemaOpts, opts...)
+	}
+}
+
+// RunMigrations migrates the database using the Config.MigrationProvider, either the ent auto migration
+// of the schema or the versioned atlas migrations in the migration directory, which are applied to the
+// primary and, when set, the secondary database. Nothing is run when Config.RunMigrations is disabled.
+// On postgres an advisory lock is held while migrating so only one instance migrates at a time
+func RunMigrations(ctx context.Context, ec *EntClientConfig, s MigrateSchema, opts ...MigrationOption) error {
+	cfg := newMigrationConfig(ec, opts...)
+
+	provider := ec.config.MigrationProvider
+	if provider == "" {
+		provider = MigrationProviderAtlas
+	}
+
+	if provider != MigrationProviderEnt && provider != MigrationProviderAtlas {
+		return newMigrationProviderError(provider)
+	}
+
+	if !ec.config.RunMigrations && cfg.dryRun == nil {
+		log.Info().Msg("migrations disabled, skipping")
+
+		return nil
+	}
+
+	if cfg.dryRun == nil {
+		unlock, err := ec.migrationLock(ctx, cfg.lockKey)
+		if err != nil {
+			return err
+		}
+
+		defer unlock()
+	}
+
+	if provider == MigrationProviderEnt {
+		if cfg.dryRun != nil {
+			return s.WriteTo(ctx, cfg.dryRun, cfg.schemaOpts...)
+		}
+
+		log.Info().Msg("running ent auto migration")
+
+		return s.Create(ctx, cfg.schemaOpts...)
+	}
+
+	for _, db := range ec.writeDBs() {
+		if err := ec.runAtlasMigrations(ctx, db, cfg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newMigrationConfig returns the migration settings of the config with the options applied
+func newMigrationConfig(ec *EntClientConfig, opts ...MigrationOption) *migrationConfig {
+	cfg := &migrationConfig{
+		dir:           ec.config.MigrationDir,
+		revisionTable: DefaultMigrationRevisionTable,
+		lockKey:       DefaultMigrationLockKey,
+	}
+
+	if cfg.dir == "" {
+		cfg.dir = DefaultMigrationDir
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return cfg
+}
+
+// writeDBs returns the databases that are written to, the primary and the secondary when set
+func (c *EntClientConfig) writeDBs() []*sql.DB {
+	dbs := []*sql.DB{c.primaryDB.DB()}
+
+	if c.secondaryDB != nil {
+		dbs = append(dbs, c.secondaryDB.DB())
+	}
+
+	return dbs
+}
+
+// migrationLock takes the postgres advisory lock on a dedicated connection of the primary database,
+// blocking until it is acquired; other dialects, and CockroachDB which does not support advisory
+// locks, are not locked
+func (c *EntClientConfig) migrationLock(ctx context.Context, key int64) (func(), error) {
+	entDialect, err := CheckEntDialect(c.config.DriverName)
+	if err != nil {
+		return nil, err
+	}
+
+	if entDialect != dialect.Postgres || c.config.DriverName == DriverCockroachDB {
+		return func() {}, nil
+	}
+
+	conn, err := c.primaryDB.DB().Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed acquiring migration lock connection: %w", err)
+	}
+
+	log.Debug().Int64("key", key).Msg("waiting for migration lock")
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", key); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed acquiring migration lock: %w", err), conn.Close())
+	}
+
+	return func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", key); err != nil {
+			log.Error().Err(err).Msg("failed releasing migration lock")
+		}
+
+		conn.Close()
+	}, nil
+}
+
+// runAtlasMigrations applies, or with a dry run prints, the pending versioned migrations on the database
+func (c *EntClientConfig) runAtlasMigrations(ctx context.Context, db *sql.DB, cfg *migrationConfig) error {
+	ex, revisions, err := c.atlasExecutor(db, cfg)
+	if err != nil {
+		return err
+	}
+
+	if cfg.dryRun != nil {
+		return writePendingMigrations(ctx, ex, cfg.dryRun)
+	}
+
+	if err := revisions.create(ctx); err != nil {
+		return err
+	}
+
+	log.Info().Str("dir", cfg.dir).Msg("running atlas migrations")
+
+	if err := ex.ExecuteN(ctx, 0); err != nil && !errors.Is(err, migrate.ErrNoPendingFiles) {
+		return fmt.Errorf("failed running migrations: %w", err)
+	}
+
+	return nil
+}
+
+// atlasExecutor returns the atlas executor for the migration directory and the revision table of the database
+func (c *EntClientConfig) atlasExecutor(db *sql.DB, cfg *migrationConfig) (*migrate.Executor, *revisionTable, error) {
+	entDialect, err := CheckEntDialect(c.config.DriverName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	drv, err := atlasDriver(entDialect, db)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dir, err := migrate.NewLocalDir(cfg.dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed opening migration directory: %w", err)
+	}
+
+	revisions := &revisionTable{db: db, dialect: entDialect, table: cfg.revisionTable}
+
+	var execOpts []migrate.ExecutorOption
+	if cfg.baseline != "" {
+		execOpts = append(execOpts, migrate.WithBaselineVersion(cfg.baseline))
+	}
+
+	ex, err := migrate.NewExecutor(drv, dir, revisions, execOpts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ex, revisions, nil
+}
+
+// MigrationStatus reports the versioned migrations applied to a database
+type MigrationStatus struct {
+	// Current is the version of the last applied migration
+	Current string `json:"current,omitempty"`
+	// Applied is the number of applied migrations
+	Applied int `json:"applied"`
+	// Pending are the migration files not applied yet
+	Pending []string `json:"pending,omitempty"`
+}
+
+// GetMigrationStatus returns the status of the versioned atlas migrations on the primary database without
+// changing it; the ent auto migration does not track its state, so it is not supported
+func GetMigrationStatus(ctx context.Context, ec *EntClientConfig, opts ...MigrationOption) (*MigrationStatus, error) {
+	cfg := newMigrationConfig(ec, opts...)
+
+	if provider := ec.config.MigrationProvider; provider != "" && provider != MigrationProviderAtlas {
+		return nil, newMigrationProviderError(provider)
+	}
+
+	ex, revisions, err := ec.atlasExecutor(ec.primaryDB.DB(), cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	revs, err := revisions.ReadRevisions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &MigrationStatus{Applied: len(revs)}
+	if len(revs) > 0 {
+		status.Current = revs[len(revs)-1].Version
+	}
+
+	files, err := ex.Pending(ctx)
+	if err != nil && !errors.Is(err, migrate.ErrNoPendingFiles) {
+		return nil, err
+	}
+
+	for _, f := range files {
+		status.Pending = append(status.Pending, f.Name())
+	}
+
+	return status, nil
+}
+
+// writePendingMigrations writes the statements of the pending migration files
+func writePendingMigrations(ctx context.Context, ex *migrate.Executor, w io.Writer) error {
+	files, err := ex.Pending(ctx)
+	if err != nil {
+		if errors.Is(err, migrate.ErrNoPendingFiles) {
+			return nil
+		}
+
+		return err
+	}
+
+	for _, f := range files {
+		stmts, err := f.Stmts()
+		if err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintf(w, "-- %s\n", f.Name()); err != nil {
+			return err
+		}
+
+		for _, stmt := range stmts {
+			if _, err := fmt.Fprintln(w, stmt); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// atlasDriver returns the atlas migrate driver for the ent dialect
+func atlasDriver(entDialect string, db *sql.DB) (migrate.Driver, error) {
+	switch entDialect {
+	case dialect.Postgres:
+		return postgres.Open(db)
+	case dialect.SQLite:
+		return sqlite.Open(db)
+	case dialect.MySQL:
+		return mysql.Open(db)
+	default:
+		return nil, newDialectError(entDialect)
+	}
+}
+
+// revisionTable is a migrate.RevisionReadWriter storing the applied migrations in a database table
+type revisionTable struct {
+	db      *sql.DB
+	dialect string
+	table   string
+}
+
+var _ migrate.RevisionReadWriter = (*revisionTable)(nil)
+
+const revisionColumns = "version, description, type, applied, total, executed_at, execution_time, error, error_stmt, hash, partial_hashes, operator_version"
+
+// create creates the revision table if it does not exist
+func (r *revisionTable) create(ctx context.Context) error {
+	_, err := r.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+r.table+` (
+		version varchar(255) NOT NULL PRIMARY KEY,
+		description text NOT NULL,
+		type bigint NOT NULL DEFAULT 2,
+		applied bigint NOT NULL DEFAULT 0,
+		total bigint NOT NULL DEFAULT 0,
+		executed_at timestamp NOT NULL,
+		execution_time bigint NOT NULL,
+		error text,
+		error_stmt text,
+		hash text NOT NULL,
+		partial_hashes text,
+		operator_version text NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed creating migration revision table: %w", err)
+	}
+
+	return nil
+}
+
+// Ident returns the revision table so it is ignored when checking the database is clean
+func (r *revisionTable) Ident() *migrate.TableIdent {
+	return &migrate.TableIdent{Name: r.table}
+}
+
+// ReadRevisions returns the applied revisions, none if the table was not created yet
+func (r *revisionTable) ReadRevisions(ctx context.Context) ([]*migrate.Revision, error) {
+	exists, err := r.exists(ctx)
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, "SELECT "+revisionColumns+" FROM "+r.table+" ORDER BY version")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var revs []*migrate.Revision
+
+	for rows.Next() {
+		rev, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		revs = append(revs, rev)
+	}
+
+	return revs, rows.Err()
+}
+
+// ReadRevision returns the revision of the version
+func (r *revisionTable) ReadRevision(ctx context.Context, version string) (*migrate.Revision, error) {
+	exists, err := r.exists(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, migrate.ErrRevisionNotExist
+	}
+
+	rev, err := scanRevision(r.db.QueryRowContext(ctx,
+		r.rebind("SELECT "+revisionColumns+" FROM "+r.table+" WHERE version = ?"), version))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, migrate.ErrRevisionNotExist
+	}
+
+	return rev, err
+}
+
+// WriteRevision inserts or replaces the revision
+func (r *revisionTable) WriteRevision(ctx context.Context, rev *migrate.Revision) error {
+	partial, err := json.Marshal(rev.PartialHashes)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, r.rebind("DELETE FROM "+r.table+" WHERE version = ?"), rev.Version); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		r.rebind("INSERT INTO "+r.table+" ("+revisionColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"),
+		rev.Version, rev.Description, int64(rev.Type), rev.Applied, rev.Total, rev.ExecutedAt.UTC(),
+		int64(rev.ExecutionTime), rev.Error, rev.ErrorStmt, rev.Hash, string(partial), rev.OperatorVersion,
+	); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	return tx.Commit()
+}
+
+// DeleteRevision deletes the revision of the version
+func (r *revisionTable) DeleteRevision(ctx context.Context, version string) error {
+	_, err := r.db.ExecContext(ctx, r.rebind("DELETE FROM "+r.table+" WHERE version = ?"), version)
+
+	return err
+}
+
+// exists reports whether the revision table was created
+func (r *revisionTable) exists(ctx context.Context) (bool, error) {
+	var query string
+
+	switch r.dialect {
+	case dialect.Postgres:
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = $1"
+	case dialect.MySQL:
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?"
+	default:
+		query = "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+	}
+
+	var n int
+	if err := r.db.QueryRowContext(ctx, query, r.table).Scan(&n); err != nil {
+		return false, fmt.Errorf("failed checking migration revision table: %w", err)
+	}
+
+	return n > 0, nil
+}
+
+// rebind replaces the ? placeholders with the postgres $n placeholders when needed
+func (r *revisionTable) rebind(query string) string {
+	if r.dialect != dialect.Postgres {
+		return query
+	}
+
+	var (
+		b strings.Builder
+		n int
+	)
+
+	for _, c := range query {
+		if c == '?' {
+			n++
+
+			b.WriteString("$" + strconv.Itoa(n))
+
+			continue
+		}
+
+		b.WriteRune(c)
+	}
+
+	return b.String()
+}
+
+// scanRevision scans a revision row
+func scanRevision(row interface{ Scan(...any) error }) (*migrate.Revision, error) {
+	var (
+		rev           migrate.Revision
+		revType       int64
+		executionTime int64
+		errMsg        sql.NullString
+		errStmt       sql.NullString
+		partial       sql.NullString
+	)
+
+	if err := row.Scan(&rev.Version, &rev.Description, &revType, &rev.Applied, &rev.Total, &rev.ExecutedAt,
+		&executionTime, &errMsg, &errStmt, &rev.Hash, &partial, &rev.OperatorVersion); err != nil {
+		return nil, err
+	}
+
+	rev.Type = migrate.RevisionType(revType) //nolint:gosec
+	rev.ExecutionTime = time.Duration(executionTime)
+	rev.Error = errMsg.String
+	rev.ErrorStmt = errStmt.String
+
+	if partial.Valid && partial.String != "" {
+		if err := json.Unmarshal([]byte(partial.String), &rev.PartialHashes); err != nil {
+			return nil, err
+		}
+	}
+
+	return &rev, nil
+}
@@ -0,0 +1,155 @@
+package entx_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ariga.io/atlas/sql/migrate"
+	"entgo.io/ent/dialect/sql/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"modernc.org/sqlite"
+
+	"github.com/theopenlane/entx"
+)
+
+func init() {
+	// the pure go driver stands in for the cgo sqlite3 driver in tests
+	sql.Register("sqlite3", &sqlite.Driver{})
+}
+
+// recordingSchema is a MigrateSchema that records the auto migration calls
+type recordingSchema struct {
+	created int
+	written int
+}
+
+func (s *recordingSchema) Create(_ context.Context, _ ...schema.MigrateOption) error {
+	s.created++
+	return nil
+}
+
+func (s *recordingSchema) WriteTo(_ context.Context, w io.Writer, _ ...schema.MigrateOption) error {
+	s.written++
+	_, err := io.WriteString(w, "CREATE TABLE `users` (`id` integer NOT NULL);\n")
+
+	return err
+}
+
+// newMigrationDir writes the migration files and their atlas.sum to a new directory
+func newMigrationDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	path := t.TempDir()
+
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(path, name), []byte(content), 0o600))
+	}
+
+	dir, err := migrate.NewLocalDir(path)
+	require.NoError(t, err)
+
+	sum, err := dir.Checksum()
+	require.NoError(t, err)
+	require.NoError(t, migrate.WriteSumFile(dir, sum))
+
+	return path
+}
+
+func newMigrationClient(t *testing.T, provider string, run bool) *entx.EntClientConfig {
+	t.Helper()
+
+	ec, err := entx.NewDBConfig(entx.Config{
+		DriverName:        "sqlite3",
+		PrimaryDBSource:   filepath.Join(t.TempDir(), "migrate.db"),
+		RunMigrations:     run,
+		MigrationProvider: provider,
+	})
+	require.NoError(t, err)
+
+	t.Cleanup(func() { ec.GetPrimaryDB().Close() })
+
+	return ec
+}
+
+func TestRunMigrationsEnt(t *testing.T) {
+	ctx := context.Background()
+	ec := newMigrationClient(t, entx.MigrationProviderEnt, true)
+	s := &recordingSchema{}
+
+	var out bytes.Buffer
+
+	require.NoError(t, entx.RunMigrations(ctx, ec, s, entx.WithMigrationDryRun(&out)))
+	assert.Contains(t, out.String(), "CREATE TABLE `users`")
+	assert.Equal(t, 0, s.created)
+
+	require.NoError(t, entx.RunMigrations(ctx, ec, s))
+	assert.Equal(t, 1, s.created)
+	assert.Equal(t, 1, s.written)
+}
+
+func TestRunMigrationsDisabled(t *testing.T) {
+	ec := newMigrationClient(t, entx.MigrationProviderEnt, false)
+	s := &recordingSchema{}
+
+	require.NoError(t, entx.RunMigrations(context.Background(), ec, s))
+	assert.Equal(t, 0, s.created)
+}
+
+func TestRunMigrationsUnsupportedProvider(t *testing.T) {
+	ec := newMigrationClient(t, "goose", true)
+
+	err := entx.RunMigrations(context.Background(), ec, &recordingSchema{})
+	assert.ErrorIs(t, err, entx.ErrUnsupportedMigrationProvider)
+}
+
+func TestRunMigrationsAtlas(t *testing.T) {
+	ctx := context.Background()
+	ec := newMigrationClient(t, entx.MigrationProviderAtlas, true)
+
+	dir := newMigrationDir(t, map[string]string{
+		"20240101000000_users.sql":  "CREATE TABLE users (id integer PRIMARY KEY, name text);\n",
+		"20240102000000_groups.sql": "CREATE TABLE groups (id integer PRIMARY KEY);\nINSERT INTO groups (id) VALUES (1);\n",
+	})
+
+	db := ec.GetPrimaryDB().DB()
+
+	// the dry run prints the pending statements without changing the database
+	var out bytes.Buffer
+
+	require.NoError(t, entx.RunMigrations(ctx, ec, nil, entx.WithMigrationDir(dir), entx.WithMigrationDryRun(&out)))
+	assert.Equal(t, "-- 20240101000000_users.sql\n"+
+		"CREATE TABLE users (id integer PRIMARY KEY, name text);\n"+
+		"-- 20240102000000_groups.sql\n"+
+		"CREATE TABLE groups (id integer PRIMARY KEY);\n"+
+		"INSERT INTO groups (id) VALUES (1);\n", out.String())
+
+	var tables int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table'").Scan(&tables))
+	assert.Zero(t, tables)
+
+	require.NoError(t, entx.RunMigrations(ctx, ec, nil, entx.WithMigrationDir(dir)))
+
+	var groups int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM groups").Scan(&groups))
+	assert.Equal(t, 1, groups)
+
+	var revisions int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM "+entx.DefaultMigrationRevisionTable).Scan(&revisions))
+	assert.Equal(t, 2, revisions)
+
+	// applied migrations are not run again
+	require.NoError(t, entx.RunMigrations(ctx, ec, nil, entx.WithMigrationDir(dir)))
+
+	out.Reset()
+	require.NoError(t, entx.RunMigrations(ctx, ec, nil, entx.WithMigrationDir(dir), entx.WithMigrationDryRun(&out)))
+	assert.Empty(t, out.String())
+
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM groups").Scan(&groups))
+	assert.Equal(t, 1, groups)
+}
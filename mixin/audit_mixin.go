@@ -10,13 +10,141 @@ import (
 	"entgo.io/ent/schema/mixin"
 
 	"github.com/theopenlane/iam/auth"
+	"github.com/theopenlane/utils/contextx"
 
 	"github.com/theopenlane/entx"
 )
 
+const (
+	// DefaultSystemActor is recorded when a mutation runs without an actor
+	DefaultSystemActor = "unknown"
+	// DefaultServiceActorLabel prefixes the name of the service recorded for the mutations run by a service
+	DefaultServiceActorLabel = "service"
+)
+
+var (
+	preserveAuditKey = contextx.NewKey[bool]()
+	serviceActorKey  = contextx.NewKey[string]()
+)
+
+// PreserveAuditFields returns a new context that keeps the created_at, created_by, updated_at and updated_by values
+// set by the caller, e.g. by imports, migrations and backfills keeping the original timestamps and authors; the
+// fields the caller did not set are still populated
+func PreserveAuditFields(parent context.Context) context.Context {
+	return preserveAuditKey.Set(parent, true)
+}
+
+// CheckPreserveAuditFields checks whether keeping the audit fields set by the caller was requested
+func CheckPreserveAuditFields(ctx context.Context) bool {
+	preserve, _ := preserveAuditKey.Get(ctx)
+	return preserve
+}
+
+// WithServiceActor returns a new context whose mutations are recorded as made by the service, e.g. a scheduler or a
+// webhook consumer, rather than by the authenticated subject
+func WithServiceActor(parent context.Context, service string) context.Context {
+	return serviceActorKey.Set(parent, service)
+}
+
+// ServiceActorFromContext returns the service the mutations of the context are made by
+func ServiceActorFromContext(ctx context.Context) (string, bool) {
+	service, ok := serviceActorKey.Get(ctx)
+	return service, ok && service != ""
+}
+
+// ActorResolver returns the id of the actor making the mutations of the context
+type ActorResolver func(ctx context.Context) (string, error)
+
+// auditConfig is the configuration of the audit hook
+type auditConfig struct {
+	resolver     ActorResolver
+	systemActor  string
+	serviceLabel string
+	now          func() time.Time
+}
+
+// AuditOption configures the AuditMixin and its hook
+type AuditOption func(*auditConfig)
+
+// WithActorResolver sets the resolver of the actor recorded in created_by and updated_by, the subject of the
+// authenticated user by default
+func WithActorResolver(resolver ActorResolver) AuditOption {
+	return func(c *auditConfig) {
+		if resolver != nil {
+			c.resolver = resolver
+		}
+	}
+}
+
+// WithSystemActor sets the actor recorded when the resolver returns no actor, DefaultSystemActor by default
+func WithSystemActor(label string) AuditOption {
+	return func(c *auditConfig) {
+		c.systemActor = label
+	}
+}
+
+// WithServiceActorLabel sets the label prefixing the service recorded for the mutations run with WithServiceActor,
+// e.g. service:scheduler, DefaultServiceActorLabel by default
+func WithServiceActorLabel(label string) AuditOption {
+	return func(c *auditConfig) {
+		c.serviceLabel = label
+	}
+}
+
+// WithAuditClock sets the clock the created_at and updated_at values are read from, time.Now by default
+func WithAuditClock(now func() time.Time) AuditOption {
+	return func(c *auditConfig) {
+		if now != nil {
+			c.now = now
+		}
+	}
+}
+
+// newAuditConfig returns the audit configuration with the options applied
+func newAuditConfig(opts ...AuditOption) auditConfig {
+	c := auditConfig{
+		resolver:     auth.GetSubjectIDFromContext,
+		systemActor:  DefaultSystemActor,
+		serviceLabel: DefaultServiceActorLabel,
+		now:          time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	return c
+}
+
+// actor returns the actor recorded for the mutations of the context
+func (c auditConfig) actor(ctx context.Context) string {
+	if service, ok := ServiceActorFromContext(ctx); ok {
+		if c.serviceLabel == "" {
+			return service
+		}
+
+		return c.serviceLabel + ":" + service
+	}
+
+	actor, err := c.resolver(ctx)
+	if err != nil || actor == "" {
+		return c.systemActor
+	}
+
+	return actor
+}
+
 // AuditMixin provides auditing for all records where enabled. The created_at, created_by, updated_at, and updated_by records are automatically populated when this mixin is enabled.
+// The zero value records the authenticated subject, use NewAuditMixin to configure it
 type AuditMixin struct {
 	mixin.Schema
+
+	opts []AuditOption
+}
+
+// NewAuditMixin returns an AuditMixin configured with the options
+func NewAuditMixin(opts ...AuditOption) AuditMixin {
+	return AuditMixin{opts: opts}
 }
 
 // Fields of the AuditMixin
@@ -65,14 +193,20 @@ func (AuditMixin) Fields() []ent.Field {
 }
 
 // Hooks of the AuditMixin
-func (AuditMixin) Hooks() []ent.Hook {
+func (a AuditMixin) Hooks() []ent.Hook {
 	return []ent.Hook{
-		AuditHook,
+		NewAuditHook(a.opts...),
 	}
 }
 
 // AuditHook sets and returns the created_at, updated_at, etc., fields
 func AuditHook(next ent.Mutator) ent.Mutator {
+	return NewAuditHook()(next)
+}
+
+// NewAuditHook returns a hook setting the created_at, updated_at, etc., fields with the options. Creates set updated_at
+// to the created_at time, both read from the clock, so a new record is not shown as updated after it was created
+func NewAuditHook(opts ...AuditOption) ent.Hook {
 	type AuditLogger interface {
 		SetCreatedAt(time.Time)
 		CreatedAt() (v time.Time, exists bool) // exists if present before this hook
@@ -84,28 +218,49 @@ func AuditHook(next ent.Mutator) ent.Mutator {
 		UpdatedBy() (id string, exists bool)
 	}
 
-	return ent.MutateFunc(func(ctx context.Context, m ent.Mutation) (ent.Value, error) {
-		ml, ok := m.(AuditLogger)
-		if !ok {
-			return nil, newUnexpectedAuditError(m)
-		}
+	cfg := newAuditConfig(opts...)
 
-		actor, err := auth.GetSubjectIDFromContext(ctx)
-		if err != nil {
-			actor = "unknown"
-		}
+	return func(next ent.Mutator) ent.Mutator {
+		return ent.MutateFunc(func(ctx context.Context, m ent.Mutation) (ent.Value, error) {
+			ml, ok := m.(AuditLogger)
+			if !ok {
+				return nil, newUnexpectedAuditError(m)
+			}
 
-		switch op := m.Op(); {
-		case op.Is(ent.OpCreate):
-			ml.SetCreatedAt(time.Now())
-			ml.SetCreatedBy(actor)
-			ml.SetUpdatedBy(actor)
+			op := m.Op()
+			if !op.Is(ent.OpCreate | ent.OpUpdateOne | ent.OpUpdate) {
+				return next.Mutate(ctx, m)
+			}
 
-		case op.Is(ent.OpUpdateOne | ent.OpUpdate):
-			ml.SetUpdatedAt(time.Now())
-			ml.SetUpdatedBy(actor)
-		}
+			actor := cfg.actor(ctx)
+			now := cfg.now()
+			preserve := CheckPreserveAuditFields(ctx)
+
+			// the values set by the caller are kept when preserving, the defaults of the fields are set by ent before
+			// the hooks run and are kept as well
+			set := func(get func() (time.Time, bool), setter func(time.Time)) {
+				if _, exists := get(); !preserve || !exists {
+					setter(now)
+				}
+			}
 
-		return next.Mutate(ctx, m)
-	})
+			setBy := func(get func() (string, bool), setter func(string)) {
+				if v, exists := get(); !preserve || !exists || v == "" {
+					setter(actor)
+				}
+			}
+
+			if op.Is(ent.OpCreate) {
+				set(ml.CreatedAt, ml.SetCreatedAt)
+				set(ml.UpdatedAt, ml.SetUpdatedAt)
+				setBy(ml.CreatedBy, ml.SetCreatedBy)
+				setBy(ml.UpdatedBy, ml.SetUpdatedBy)
+			} else {
+				set(ml.UpdatedAt, ml.SetUpdatedAt)
+				setBy(ml.UpdatedBy, ml.SetUpdatedBy)
+			}
+
+			return next.Mutate(ctx, m)
+		})
+	}
 }
@@ -0,0 +1,201 @@
+package mixin_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"entgo.io/ent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theopenlane/entx/mixin"
+)
+
+// auditMutation is a mutation of an audited schema, the nil fields are not set
+type auditMutation struct {
+	ent.Mutation
+
+	op        ent.Op
+	createdAt *time.Time
+	updatedAt *time.Time
+	createdBy *string
+	updatedBy *string
+}
+
+func (m *auditMutation) Op() ent.Op                   { return m.op }
+func (m *auditMutation) SetCreatedAt(t time.Time)     { m.createdAt = &t }
+func (m *auditMutation) SetUpdatedAt(t time.Time)     { m.updatedAt = &t }
+func (m *auditMutation) SetCreatedBy(s string)        { m.createdBy = &s }
+func (m *auditMutation) SetUpdatedBy(s string)        { m.updatedBy = &s }
+func (m *auditMutation) CreatedAt() (time.Time, bool) { return get(m.createdAt) }
+func (m *auditMutation) UpdatedAt() (time.Time, bool) { return get(m.updatedAt) }
+func (m *auditMutation) CreatedBy() (string, bool)    { return get(m.createdBy) }
+func (m *auditMutation) UpdatedBy() (string, bool)    { return get(m.updatedBy) }
+
+// get returns the value and whether it is set
+func get[T any](v *T) (T, bool) {
+	if v == nil {
+		var zero T
+		return zero, false
+	}
+
+	return *v, true
+}
+
+func TestAuditHook(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	earlier := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	ptr := func(s string) *string { return &s }
+
+	resolver := mixin.WithActorResolver(func(context.Context) (string, error) {
+		return "u1", nil
+	})
+	clock := mixin.WithAuditClock(func() time.Time { return now })
+
+	tests := []struct {
+		name     string
+		opts     []mixin.AuditOption
+		ctx      context.Context
+		mutation *auditMutation
+		want     *auditMutation
+	}{
+		{
+			name:     "create",
+			opts:     []mixin.AuditOption{resolver, clock},
+			mutation: &auditMutation{op: ent.OpCreate},
+			want:     &auditMutation{op: ent.OpCreate, createdAt: &now, updatedAt: &now, createdBy: ptr("u1"), updatedBy: ptr("u1")},
+		},
+		{
+			name:     "update one",
+			opts:     []mixin.AuditOption{resolver, clock},
+			mutation: &auditMutation{op: ent.OpUpdateOne},
+			want:     &auditMutation{op: ent.OpUpdateOne, updatedAt: &now, updatedBy: ptr("u1")},
+		},
+		{
+			name:     "bulk update",
+			opts:     []mixin.AuditOption{resolver, clock},
+			mutation: &auditMutation{op: ent.OpUpdate},
+			want:     &auditMutation{op: ent.OpUpdate, updatedAt: &now, updatedBy: ptr("u1")},
+		},
+		{
+			name:     "delete",
+			opts:     []mixin.AuditOption{resolver, clock},
+			mutation: &auditMutation{op: ent.OpDeleteOne},
+			want:     &auditMutation{op: ent.OpDeleteOne},
+		},
+		{
+			name:     "service actor before the resolver",
+			opts:     []mixin.AuditOption{resolver, clock},
+			ctx:      mixin.WithServiceActor(context.Background(), "scheduler"),
+			mutation: &auditMutation{op: ent.OpUpdateOne},
+			want:     &auditMutation{op: ent.OpUpdateOne, updatedAt: &now, updatedBy: ptr("service:scheduler")},
+		},
+		{
+			name:     "service actor label",
+			opts:     []mixin.AuditOption{resolver, clock, mixin.WithServiceActorLabel("svc")},
+			ctx:      mixin.WithServiceActor(context.Background(), "scheduler"),
+			mutation: &auditMutation{op: ent.OpUpdateOne},
+			want:     &auditMutation{op: ent.OpUpdateOne, updatedAt: &now, updatedBy: ptr("svc:scheduler")},
+		},
+		{
+			name:     "service actor without a label",
+			opts:     []mixin.AuditOption{resolver, clock, mixin.WithServiceActorLabel("")},
+			ctx:      mixin.WithServiceActor(context.Background(), "scheduler"),
+			mutation: &auditMutation{op: ent.OpUpdateOne},
+			want:     &auditMutation{op: ent.OpUpdateOne, updatedAt: &now, updatedBy: ptr("scheduler")},
+		},
+		{
+			name:     "empty service actor",
+			opts:     []mixin.AuditOption{resolver, clock},
+			ctx:      mixin.WithServiceActor(context.Background(), ""),
+			mutation: &auditMutation{op: ent.OpUpdateOne},
+			want:     &auditMutation{op: ent.OpUpdateOne, updatedAt: &now, updatedBy: ptr("u1")},
+		},
+		{
+			name: "system actor when the resolver fails",
+			opts: []mixin.AuditOption{clock, mixin.WithActorResolver(func(context.Context) (string, error) {
+				return "u1", errors.New("no subject")
+			})},
+			mutation: &auditMutation{op: ent.OpUpdateOne},
+			want:     &auditMutation{op: ent.OpUpdateOne, updatedAt: &now, updatedBy: ptr(mixin.DefaultSystemActor)},
+		},
+		{
+			name: "system actor label when the resolver returns no actor",
+			opts: []mixin.AuditOption{clock, mixin.WithSystemActor("system"), mixin.WithActorResolver(func(context.Context) (string, error) {
+				return "", nil
+			})},
+			mutation: &auditMutation{op: ent.OpUpdateOne},
+			want:     &auditMutation{op: ent.OpUpdateOne, updatedAt: &now, updatedBy: ptr("system")},
+		},
+		{
+			name:     "values set by the caller are overwritten",
+			opts:     []mixin.AuditOption{resolver, clock},
+			mutation: &auditMutation{op: ent.OpCreate, createdAt: &earlier, updatedAt: &earlier, createdBy: ptr("importer"), updatedBy: ptr("importer")},
+			want:     &auditMutation{op: ent.OpCreate, createdAt: &now, updatedAt: &now, createdBy: ptr("u1"), updatedBy: ptr("u1")},
+		},
+		{
+			name:     "values set by the caller are preserved on create",
+			opts:     []mixin.AuditOption{resolver, clock},
+			ctx:      mixin.PreserveAuditFields(context.Background()),
+			mutation: &auditMutation{op: ent.OpCreate, createdAt: &earlier, createdBy: ptr("importer"), updatedBy: ptr("")},
+			want:     &auditMutation{op: ent.OpCreate, createdAt: &earlier, updatedAt: &now, createdBy: ptr("importer"), updatedBy: ptr("u1")},
+		},
+		{
+			name:     "values set by the caller are preserved on update",
+			opts:     []mixin.AuditOption{resolver, clock},
+			ctx:      mixin.PreserveAuditFields(context.Background()),
+			mutation: &auditMutation{op: ent.OpUpdateOne, updatedAt: &earlier, updatedBy: ptr("importer")},
+			want:     &auditMutation{op: ent.OpUpdateOne, updatedAt: &earlier, updatedBy: ptr("importer")},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := tc.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+
+			called := false
+
+			next := ent.MutateFunc(func(context.Context, ent.Mutation) (ent.Value, error) {
+				called = true
+				return nil, nil
+			})
+
+			_, err := mixin.NewAuditHook(tc.opts...)(next).Mutate(ctx, tc.mutation)
+			require.NoError(t, err)
+
+			assert.True(t, called)
+			assert.Equal(t, tc.want, tc.mutation)
+		})
+	}
+}
+
+func TestAuditHookDefaults(t *testing.T) {
+	m := &auditMutation{op: ent.OpCreate}
+
+	start := time.Now()
+
+	// the nil resolver and clock keep the defaults, without an authenticated subject the system actor is recorded
+	hook := mixin.NewAuditHook(mixin.WithActorResolver(nil), mixin.WithAuditClock(nil))
+
+	_, err := hook(ent.MutateFunc(func(context.Context, ent.Mutation) (ent.Value, error) {
+		return nil, nil
+	})).Mutate(context.Background(), m)
+	require.NoError(t, err)
+
+	assert.Equal(t, mixin.DefaultSystemActor, *m.createdBy)
+	assert.Equal(t, mixin.DefaultSystemActor, *m.updatedBy)
+	assert.WithinRange(t, *m.createdAt, start, time.Now())
+	assert.Equal(t, *m.createdAt, *m.updatedAt)
+
+	_, err = mixin.AuditHook(nil).Mutate(context.Background(), plainMutation{})
+
+	var unexpected *mixin.UnexpectedAuditError
+
+	assert.ErrorAs(t, err, &unexpected)
+}
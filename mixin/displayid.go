@@ -0,0 +1,328 @@
+package mixin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+
+	"entgo.io/ent"
+	"entgo.io/ent/dialect"
+	"entgo.io/ent/dialect/sql"
+	"entgo.io/ent/dialect/sql/sqlgraph"
+)
+
+const (
+	// Base32Alphabet is the alphabet of the hashed display ids by default
+	Base32Alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567"
+	// CrockfordAlphabet is the Crockford base32 alphabet, without the I, L, O and U letters that are confused with
+	// digits or make words
+	CrockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	// DefaultDisplayIDMaxAttempts is the number of display ids tried when the display id is already used
+	DefaultDisplayIDMaxAttempts = 3
+	// DefaultDisplayIDSequenceTable is the table of the SQLSequence counters
+	DefaultDisplayIDSequenceTable = "display_id_sequences"
+)
+
+// DisplayIDRequest is the record a display id is generated for
+type DisplayIDRequest struct {
+	// Mutation creating the record
+	Mutation ent.Mutation
+	// Schema of the record
+	Schema string
+	// ID of the record
+	ID string
+	// Owner is the value of the field the display id is unique with, empty when the display id is unique on its own
+	Owner string
+	// Attempt is 0 for the first display id and incremented each time the previous one was already used
+	Attempt int
+}
+
+// DisplayIDStrategy generates the display ids, without their prefix, of the IDMixin
+type DisplayIDStrategy interface {
+	// Generate returns the display id of the record, without its prefix
+	Generate(ctx context.Context, req DisplayIDRequest) (string, error)
+}
+
+// DisplayIDNormalizer is implemented by the strategies whose display ids are typed by users, it normalizes a display
+// id, without its prefix, before it is looked up
+type DisplayIDNormalizer interface {
+	Normalize(id string) string
+}
+
+// DisplayIDStrategyFunc is a function implementing DisplayIDStrategy
+type DisplayIDStrategyFunc func(ctx context.Context, req DisplayIDRequest) (string, error)
+
+// Generate calls the function
+func (f DisplayIDStrategyFunc) Generate(ctx context.Context, req DisplayIDRequest) (string, error) {
+	return f(ctx, req)
+}
+
+// hashDisplayID hashes the id of the record into the alphabet
+type hashDisplayID struct {
+	length   int
+	alphabet string
+}
+
+// HashDisplayID returns a strategy hashing the id of the record into a display id of the length written with the
+// alphabet, Base32Alphabet when empty. The retries hash the id with the attempt so each one returns another display id
+func HashDisplayID(length int, alphabet string) DisplayIDStrategy {
+	if alphabet == "" {
+		alphabet = Base32Alphabet
+	}
+
+	return hashDisplayID{length: length, alphabet: alphabet}
+}
+
+// CrockfordDisplayID returns a strategy hashing the id of the record into a display id of the length written with
+// the Crockford alphabet, the display ids looked up are normalized so confusable characters are matched
+func CrockfordDisplayID(length int) DisplayIDStrategy {
+	return crockfordDisplayID{hashDisplayID{length: length, alphabet: CrockfordAlphabet}}
+}
+
+// Generate returns the hash of the id
+func (h hashDisplayID) Generate(_ context.Context, req DisplayIDRequest) (string, error) {
+	length := h.length
+	if length <= 0 {
+		length = 6
+	}
+
+	value := req.ID
+	if req.Attempt > 0 {
+		value += "/" + strconv.Itoa(req.Attempt)
+	}
+
+	hash := sha256.Sum256([]byte(value))
+
+	var encoded string
+
+	if len(h.alphabet) == len(Base32Alphabet) {
+		encoded = base32.NewEncoding(h.alphabet).WithPadding(base32.NoPadding).EncodeToString(hash[:])
+	} else {
+		encoded = encodeAlphabet(hash[:], h.alphabet)
+	}
+
+	if length > len(encoded) {
+		return "", fmt.Errorf("%w: display id length %d is longer than the hash", ErrInvalidDisplayID, length)
+	}
+
+	return encoded[:length], nil
+}
+
+// Normalize upper cases the display id when the alphabet has no lower case letters
+func (h hashDisplayID) Normalize(id string) string {
+	if h.alphabet == strings.ToUpper(h.alphabet) {
+		return strings.ToUpper(id)
+	}
+
+	return id
+}
+
+// encodeAlphabet writes the bytes as a number in the base of the alphabet
+func encodeAlphabet(b []byte, alphabet string) string {
+	n := new(big.Int).SetBytes(b)
+	base := big.NewInt(int64(len(alphabet)))
+	mod := new(big.Int)
+
+	var out []byte
+
+	for n.Sign() > 0 {
+		n.DivMod(n, base, mod)
+		out = append(out, alphabet[mod.Int64()])
+	}
+
+	return string(out)
+}
+
+// crockfordDisplayID is a hashDisplayID with the Crockford alphabet
+type crockfordDisplayID struct {
+	hashDisplayID
+}
+
+// Normalize upper cases the display id and replaces the letters confused with digits
+func (crockfordDisplayID) Normalize(id string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case 'O':
+			return '0'
+		case 'I', 'L':
+			return '1'
+		case '-':
+			return -1
+		}
+
+		return r
+	}, strings.ToUpper(id))
+}
+
+// SequenceSource returns the next value of the sequence of the schema and owner, the values must be increasing
+type SequenceSource interface {
+	Next(ctx context.Context, schema, owner string) (int64, error)
+}
+
+// SequenceSourceFunc is a function implementing SequenceSource, e.g. to use a SQLSequence created once the database
+// is opened with a schema declared before
+type SequenceSourceFunc func(ctx context.Context, schema, owner string) (int64, error)
+
+// Next calls the function
+func (f SequenceSourceFunc) Next(ctx context.Context, schema, owner string) (int64, error) {
+	return f(ctx, schema, owner)
+}
+
+// sequenceDisplayID numbers the records of each owner
+type sequenceDisplayID struct {
+	source SequenceSource
+	width  int
+}
+
+// SequenceDisplayID returns a strategy numbering the records of each owner with the sequence source, zero padded to
+// the width, e.g. TSK-0042 with a width of 4
+func SequenceDisplayID(source SequenceSource, width int) DisplayIDStrategy {
+	return sequenceDisplayID{source: source, width: width}
+}
+
+// Generate returns the next value of the sequence of the owner, a retry takes the following value
+func (s sequenceDisplayID) Generate(ctx context.Context, req DisplayIDRequest) (string, error) {
+	n, err := s.source.Next(ctx, req.Schema, req.Owner)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%0*d", s.width, n), nil
+}
+
+// Normalize upper cases the display id
+func (s sequenceDisplayID) Normalize(id string) string {
+	return strings.ToUpper(id)
+}
+
+// MemorySequence is a SequenceSource held in memory, e.g. for tests
+type MemorySequence struct {
+	mu     sync.Mutex
+	values map[[2]string]int64
+}
+
+// NewMemorySequence returns an empty MemorySequence
+func NewMemorySequence() *MemorySequence {
+	return &MemorySequence{values: map[[2]string]int64{}}
+}
+
+// Next increments the sequence of the schema and owner
+func (s *MemorySequence) Next(_ context.Context, schema, owner string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := [2]string{schema, owner}
+	s.values[key]++
+
+	return s.values[key], nil
+}
+
+// SQLSequence is a SequenceSource keeping a counter per schema and owner in a table, incremented with an upsert so
+// concurrent creates get distinct values. The counters are incremented outside of the transaction of the mutation,
+// the values of the rolled back creates are not reused
+type SQLSequence struct {
+	driver dialect.Driver
+	table  string
+}
+
+// NewSQLSequence returns a SQLSequence on the driver, which must be a Postgres or SQLite driver, keeping the counters
+// in the table, DefaultDisplayIDSequenceTable when empty
+func NewSQLSequence(driver dialect.Driver, table string) (*SQLSequence, error) {
+	switch driver.Dialect() {
+	case dialect.Postgres, dialect.SQLite:
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedSequenceDialect, driver.Dialect())
+	}
+
+	if table == "" {
+		table = DefaultDisplayIDSequenceTable
+	}
+
+	return &SQLSequence{driver: driver, table: table}, nil
+}
+
+// CreateTable creates the table of the counters when it does not exist
+func (s *SQLSequence) CreateTable(ctx context.Context) error {
+	query := sql.Dialect(s.driver.Dialect()).String(func(b *sql.Builder) {
+		b.WriteString("CREATE TABLE IF NOT EXISTS ").Ident(s.table).WriteString(" (").
+			Ident("schema_name").WriteString(" varchar(255) NOT NULL, ").
+			Ident("owner_id").WriteString(" varchar(255) NOT NULL, ").
+			Ident("value").WriteString(" bigint NOT NULL, ").
+			WriteString("PRIMARY KEY (").Ident("schema_name").Comma().Ident("owner_id").WriteString("))")
+	})
+
+	return s.driver.Exec(ctx, query, []any{}, nil)
+}
+
+// Next increments the counter of the schema and owner
+func (s *SQLSequence) Next(ctx context.Context, schema, owner string) (int64, error) {
+	query, args := sql.Dialect(s.driver.Dialect()).
+		Insert(s.table).
+		Columns("schema_name", "owner_id", "value").
+		Values(schema, owner, 1).
+		OnConflict(
+			sql.ConflictColumns("schema_name", "owner_id"),
+			sql.ResolveWith(func(u *sql.UpdateSet) {
+				u.Add("value", 1)
+			}),
+		).
+		Returning("value").
+		Query()
+
+	rows := &sql.Rows{}
+	if err := s.driver.Query(ctx, query, args, rows); err != nil {
+		return 0, err
+	}
+
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+
+		return 0, fmt.Errorf("%w: no value returned for %s", ErrInvalidDisplayID, schema)
+	}
+
+	var n int64
+	if err := rows.Scan(&n); err != nil {
+		return 0, err
+	}
+
+	return n, rows.Close()
+}
+
+// isDisplayIDConflict reports whether the error is a unique constraint violation of the display id
+func isDisplayIDConflict(err error) bool {
+	return sqlgraph.IsUniqueConstraintError(err) && strings.Contains(err.Error(), humanIDFieldName)
+}
+
+// DisplayIDQuery is implemented by the generated query builders
+type DisplayIDQuery[T any] interface {
+	Only(ctx context.Context) (T, error)
+}
+
+// LookupDisplayID resolves the display id of the IDMixin to its record with the query of the schema, e.g.
+// LookupDisplayID(ctx, mixin.NewIDMixinWithPrefixedID("TSK"), client.Task.Query(), "tsk-0042", orgID). The display
+// id is normalized with the strategy of the mixin; the owner is left out of the lookup when it is empty or the display
+// id is unique on its own
+func LookupDisplayID[T any](ctx context.Context, i IDMixin, query DisplayIDQuery[T], displayID, ownerID string) (T, error) {
+	var zero T
+
+	ps := []func(*sql.Selector){sql.FieldEQ(humanIDFieldName, i.NormalizeDisplayID(displayID))}
+
+	if ownerID != "" && !i.SingleFieldIndex {
+		ps = append(ps, sql.FieldEQ(i.ownerField(), ownerID))
+	}
+
+	if !whereP(query, ps...) {
+		return zero, fmt.Errorf("%w: %T", ErrInvalidDisplayID, query)
+	}
+
+	return query.Only(ctx)
+}
@@ -0,0 +1,329 @@
+package mixin_test
+
+import (
+	"context"
+	stdsql "database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"entgo.io/ent"
+	"entgo.io/ent/dialect"
+	"entgo.io/ent/dialect/sql"
+	"entgo.io/ent/dialect/sql/sqlgraph"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+
+	"github.com/theopenlane/entx/mixin"
+)
+
+// openTasks returns a sqlite driver with a tasks table whose display ids are unique per owner
+func openTasks(t *testing.T) *sql.Driver {
+	t.Helper()
+
+	db, err := stdsql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "tasks.db")+"?_pragma=busy_timeout(5000)")
+	require.NoError(t, err)
+
+	drv := sql.OpenDB(dialect.SQLite, db)
+	t.Cleanup(func() { drv.Close() })
+
+	err = drv.Exec(context.Background(), "CREATE TABLE tasks (id text PRIMARY KEY, display_id text NOT NULL, owner_id text NOT NULL, name text UNIQUE, UNIQUE (display_id, owner_id))", []any{}, nil)
+	require.NoError(t, err)
+
+	return drv
+}
+
+// insertTask inserts the task of the mutation, named after its id unless the name is set
+func insertTask(drv *sql.Driver, name string) ent.Mutator {
+	return ent.MutateFunc(func(ctx context.Context, m ent.Mutation) (ent.Value, error) {
+		mut := m.(*displayIDMutation)
+
+		if name == "" {
+			name = mut.id
+		}
+
+		err := drv.Exec(ctx, "INSERT INTO tasks (id, display_id, owner_id, name) VALUES (?, ?, ?, ?)", []any{mut.id, mut.displayID, mut.owner, name}, nil)
+
+		return mut.displayID, err
+	})
+}
+
+// displayIDMutation is a mutation creating a task with a display id
+type displayIDMutation struct {
+	ent.Mutation
+
+	op        ent.Op
+	id        string
+	owner     string
+	displayID string
+}
+
+func (m *displayIDMutation) Op() ent.Op            { return m.op }
+func (m *displayIDMutation) Type() string          { return "Task" }
+func (m *displayIDMutation) SetDisplayID(s string) { m.displayID = s }
+
+func (m *displayIDMutation) ID() (string, bool) {
+	return m.id, m.id != ""
+}
+
+func (m *displayIDMutation) Field(name string) (ent.Value, bool) {
+	if name != mixin.OwnerIDField || m.owner == "" {
+		return nil, false
+	}
+
+	return m.owner, true
+}
+
+// recordingStrategy numbers the tasks with a memory sequence and records the requests
+type recordingStrategy struct {
+	mixin.DisplayIDStrategy
+
+	requests []mixin.DisplayIDRequest
+}
+
+func newRecordingStrategy() *recordingStrategy {
+	return &recordingStrategy{DisplayIDStrategy: mixin.SequenceDisplayID(mixin.NewMemorySequence(), 4)}
+}
+
+func (s *recordingStrategy) Generate(ctx context.Context, req mixin.DisplayIDRequest) (string, error) {
+	req.Mutation = nil
+	s.requests = append(s.requests, req)
+
+	return s.DisplayIDStrategy.Generate(ctx, req)
+}
+
+func TestDisplayIDHookRetry(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		mixin      mixin.IDMixin
+		existing   []string
+		taskName   string
+		want       string
+		wantErr    bool
+		wantOwners []string
+	}{
+		{
+			name:       "first display id",
+			mixin:      mixin.IDMixin{HumanIdentifierPrefix: "TSK"},
+			want:       "TSK-0001",
+			wantOwners: []string{"o1"},
+		},
+		{
+			name:       "display ids used by other records are skipped",
+			mixin:      mixin.IDMixin{HumanIdentifierPrefix: "TSK"},
+			existing:   []string{"TSK-0001", "TSK-0002"},
+			want:       "TSK-0003",
+			wantOwners: []string{"o1", "o1", "o1"},
+		},
+		{
+			name:       "attempts exhausted",
+			mixin:      mixin.IDMixin{HumanIdentifierPrefix: "TSK", DisplayIDMaxAttempts: 2},
+			existing:   []string{"TSK-0001", "TSK-0002"},
+			wantErr:    true,
+			wantOwners: []string{"o1", "o1"},
+		},
+		{
+			name:       "other unique fields are not retried",
+			mixin:      mixin.IDMixin{HumanIdentifierPrefix: "TSK"},
+			existing:   []string{"TSK-0009"},
+			taskName:   "existing-0",
+			wantErr:    true,
+			wantOwners: []string{"o1"},
+		},
+		{
+			name:       "unique display ids are generated without the owner",
+			mixin:      mixin.IDMixin{HumanIdentifierPrefix: "TSK", SingleFieldIndex: true},
+			want:       "TSK-0001",
+			wantOwners: []string{""},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			drv := openTasks(t)
+
+			for i, displayID := range tc.existing {
+				err := drv.Exec(ctx, "INSERT INTO tasks (id, display_id, owner_id, name) VALUES (?, ?, ?, ?)", []any{fmt.Sprintf("existing-%d", i), displayID, "o1", fmt.Sprintf("existing-%d", i)}, nil)
+				require.NoError(t, err)
+			}
+
+			strategy := newRecordingStrategy()
+			tc.mixin.DisplayIDStrategy = strategy
+
+			m := &displayIDMutation{op: ent.OpCreate, id: "t1", owner: "o1"}
+
+			v, err := tc.mixin.Hooks()[0](insertTask(drv, tc.taskName)).Mutate(ctx, m)
+
+			owners := []string{}
+			for i, req := range strategy.requests {
+				assert.Equal(t, mixin.DisplayIDRequest{Schema: "Task", ID: "t1", Owner: req.Owner, Attempt: i}, req)
+				owners = append(owners, req.Owner)
+			}
+
+			assert.Equal(t, tc.wantOwners, owners)
+
+			if tc.wantErr {
+				assert.True(t, sqlgraph.IsUniqueConstraintError(err))
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, v)
+		})
+	}
+}
+
+func TestDisplayIDHookPassThrough(t *testing.T) {
+	strategy := newRecordingStrategy()
+	hook := mixin.IDMixin{HumanIdentifierPrefix: "TSK", DisplayIDStrategy: strategy}.Hooks()[0]
+
+	next := ent.MutateFunc(func(context.Context, ent.Mutation) (ent.Value, error) {
+		return nil, nil
+	})
+
+	// updates and creates without an id keep their display id
+	for _, m := range []*displayIDMutation{{op: ent.OpUpdateOne, id: "t1"}, {op: ent.OpCreate}} {
+		_, err := hook(next).Mutate(context.Background(), m)
+		require.NoError(t, err)
+		assert.Empty(t, m.displayID)
+	}
+
+	assert.Empty(t, strategy.requests)
+	assert.Empty(t, mixin.IDMixin{}.Hooks())
+}
+
+func TestSQLSequence(t *testing.T) {
+	ctx := context.Background()
+	drv := openTasks(t)
+
+	seq, err := mixin.NewSQLSequence(drv, "")
+	require.NoError(t, err)
+	require.NoError(t, seq.CreateTable(ctx))
+	require.NoError(t, seq.CreateTable(ctx))
+
+	next := func(schema, owner string) int64 {
+		n, err := seq.Next(ctx, schema, owner)
+		require.NoError(t, err)
+
+		return n
+	}
+
+	assert.Equal(t, int64(1), next("Task", "o1"))
+	assert.Equal(t, int64(2), next("Task", "o1"))
+	assert.Equal(t, int64(1), next("Task", "o2"))
+	assert.Equal(t, int64(1), next("Risk", "o1"))
+
+	// concurrent creates get distinct values
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		values = map[int64]bool{}
+	)
+
+	for range 20 {
+		wg.Go(func() {
+			n, err := seq.Next(ctx, "Control", "o1")
+			assert.NoError(t, err)
+
+			mu.Lock()
+			values[n] = true
+			mu.Unlock()
+		})
+	}
+
+	wg.Wait()
+
+	assert.Len(t, values, 20)
+	assert.Equal(t, int64(21), next("Control", "o1"))
+
+	_, err = mixin.NewSQLSequence(sql.OpenDB(dialect.MySQL, nil), "")
+	assert.ErrorIs(t, err, mixin.ErrUnsupportedSequenceDialect)
+}
+
+// taskQuery is a query of the tasks table returning the id of the task found
+type taskQuery struct {
+	drv        *sql.Driver
+	predicates []func(*sql.Selector)
+}
+
+func (q *taskQuery) WhereP(ps ...func(*sql.Selector)) {
+	q.predicates = append(q.predicates, ps...)
+}
+
+func (q *taskQuery) Only(ctx context.Context) (string, error) {
+	s := sql.Dialect(dialect.SQLite).Select("id").From(sql.Table("tasks"))
+	for _, p := range q.predicates {
+		p(s)
+	}
+
+	query, args := s.Query()
+
+	rows := &sql.Rows{}
+	if err := q.drv.Query(ctx, query, args, rows); err != nil {
+		return "", err
+	}
+
+	defer rows.Close()
+
+	var ids []string
+	if err := sql.ScanSlice(rows, &ids); err != nil {
+		return "", err
+	}
+
+	if len(ids) != 1 {
+		return "", fmt.Errorf("%d tasks found", len(ids))
+	}
+
+	return ids[0], nil
+}
+
+func TestLookupDisplayID(t *testing.T) {
+	ctx := context.Background()
+	drv := openTasks(t)
+
+	for _, task := range [][]any{{"t1", "TSK-0042", "o1", "t1"}, {"t2", "TSK-0042", "o2", "t2"}, {"t3", "TSK-0043", "o1", "t3"}} {
+		require.NoError(t, drv.Exec(ctx, "INSERT INTO tasks (id, display_id, owner_id, name) VALUES (?, ?, ?, ?)", task, nil))
+	}
+
+	seq := mixin.NewIDMixinWithDisplayIDStrategy("TSK", mixin.SequenceDisplayID(mixin.NewMemorySequence(), 4))
+
+	lookup := func(i mixin.IDMixin, displayID, ownerID string) (string, error) {
+		return mixin.LookupDisplayID(ctx, i, mixin.DisplayIDQuery[string](&taskQuery{drv: drv}), displayID, ownerID)
+	}
+
+	// the typed display id is normalized and looked up in the organization
+	id, err := lookup(seq, " tsk-0042", "o2")
+	require.NoError(t, err)
+	assert.Equal(t, "t2", id)
+
+	id, err = lookup(seq, "TSK-0043", "o1")
+	require.NoError(t, err)
+	assert.Equal(t, "t3", id)
+
+	_, err = lookup(seq, "TSK-0043", "o2")
+	assert.Error(t, err)
+
+	// the display id is ambiguous without the owner
+	_, err = lookup(seq, "TSK-0042", "")
+	assert.Error(t, err)
+
+	// the owner is left out when the display id is unique on its own
+	unique := seq
+	unique.SingleFieldIndex = true
+
+	id, err = lookup(unique, "tsk-0043", "o2")
+	require.NoError(t, err)
+	assert.Equal(t, "t3", id)
+
+	_, err = mixin.LookupDisplayID(ctx, seq, onlyQuery{}, "TSK-0042", "o1")
+	assert.ErrorIs(t, err, mixin.ErrInvalidDisplayID)
+}
+
+// onlyQuery is a query without predicates
+type onlyQuery struct{}
+
+func (onlyQuery) Only(context.Context) (string, error) { return "", nil }
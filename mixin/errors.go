@@ -1,11 +1,26 @@
 package mixin
 
 import (
+	"errors"
 	"fmt"
 
 	"entgo.io/ent"
 )
 
+var (
+	// ErrInvalidDisplayID is returned when a display ID cannot be generated or looked up
+	ErrInvalidDisplayID = errors.New("invalid display id")
+	// ErrUnsupportedSequenceDialect is returned when a SQLSequence is created on a dialect without upserts returning
+	// the value
+	ErrUnsupportedSequenceDialect = errors.New("unsupported display id sequence dialect")
+	// ErrTagNotAllowed is returned when a tag is not in the vocabulary of the schema
+	ErrTagNotAllowed = errors.New("tag not allowed")
+	// ErrVersionRequired is returned when a versioned record is updated without the version expected by the caller
+	ErrVersionRequired = errors.New("the version of the record is required to update it")
+	// ErrVersionConflict is matched by the VersionConflictError
+	ErrVersionConflict = errors.New("version conflict")
+)
+
 // UnexpectedAuditError is returned when an unexpected audit log call is received
 type UnexpectedAuditError struct {
 	MutationType ent.Mutation
@@ -21,3 +36,57 @@ func newUnexpectedAuditError(arg ent.Mutation) *UnexpectedAuditError {
 		MutationType: arg,
 	}
 }
+
+// UnexpectedSoftDeleteError is returned when the soft delete hook or interceptor receives a mutation or query
+// that does not support soft deletes
+type UnexpectedSoftDeleteError struct {
+	Type any
+}
+
+// Error returns the UnexpectedSoftDeleteError in string format
+func (e *UnexpectedSoftDeleteError) Error() string {
+	return fmt.Sprintf("unexpected soft delete call from type: %T", e.Type)
+}
+
+func newUnexpectedSoftDeleteError(arg any) *UnexpectedSoftDeleteError {
+	return &UnexpectedSoftDeleteError{
+		Type: arg,
+	}
+}
+
+// UnexpectedVersionError is returned when the version hook receives a mutation without a version field
+type UnexpectedVersionError struct {
+	MutationType ent.Mutation
+}
+
+// Error returns the UnexpectedVersionError in string format
+func (e *UnexpectedVersionError) Error() string {
+	return fmt.Sprintf("unexpected version call from mutation type: %T", e.MutationType)
+}
+
+func newUnexpectedVersionError(arg ent.Mutation) *UnexpectedVersionError {
+	return &UnexpectedVersionError{
+		MutationType: arg,
+	}
+}
+
+// VersionConflictError is returned when a record is updated with a version it no longer has, it was updated or
+// deleted since the caller read it
+type VersionConflictError struct {
+	// Type of the record
+	Type string
+	// ID of the record, nil when it could not be read from the mutation
+	ID any
+	// Version expected by the caller
+	Version int
+}
+
+// Error returns the VersionConflictError in string format
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("%s: %s %v is no longer at version %d", ErrVersionConflict, e.Type, e.ID, e.Version)
+}
+
+// Is matches ErrVersionConflict
+func (e *VersionConflictError) Is(target error) bool {
+	return target == ErrVersionConflict
+}
@@ -2,8 +2,6 @@ package mixin
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/base32"
 	"fmt"
 	"strings"
 
@@ -35,6 +33,13 @@ type IDMixin struct {
 	OverrideDisplayID string
 	// DisplayIDLength is the length of the display ID without the prefix, defaults to 6
 	DisplayIDLength int
+	// DisplayIDStrategy generates the display ID without the prefix, defaults to the HashDisplayID of the ULID with
+	// the DisplayIDLength
+	DisplayIDStrategy DisplayIDStrategy
+	// DisplayIDMaxAttempts is the number of display IDs tried when the display ID is already used, defaults to
+	// DefaultDisplayIDMaxAttempts; on Postgres the retries only run outside of transactions, which are aborted by the
+	// violation
+	DisplayIDMaxAttempts int
 }
 
 const humanIDFieldName = "display_id"
@@ -44,6 +49,12 @@ func NewIDMixinWithPrefixedID(prefix string) IDMixin {
 	return IDMixin{HumanIdentifierPrefix: prefix}
 }
 
+// NewIDMixinWithDisplayIDStrategy creates a new IDMixin with a prefixed ID generated with the strategy, e.g.
+// NewIDMixinWithDisplayIDStrategy("TSK", SequenceDisplayID(sequence, 4)) for TSK-0042
+func NewIDMixinWithDisplayIDStrategy(prefix string, strategy DisplayIDStrategy) IDMixin {
+	return IDMixin{HumanIdentifierPrefix: prefix, DisplayIDStrategy: strategy}
+}
+
 // NewIDMixinWithMappingID creates a new IDMixin and includes an additional mapping ID
 func NewIDMixinWithMappingID() IDMixin {
 	return IDMixin{IncludeMappingID: true}
@@ -123,43 +134,98 @@ func (i IDMixin) Hooks() []ent.Hook {
 type HookFunc func(i IDMixin) ent.Hook
 
 var setIdentifierHook HookFunc = func(i IDMixin) ent.Hook {
+	strategy := i.displayIDStrategy()
+
+	attempts := DefaultDisplayIDMaxAttempts
+	if i.DisplayIDMaxAttempts > 0 {
+		attempts = i.DisplayIDMaxAttempts
+	}
+
 	return func(next ent.Mutator) ent.Mutator {
 		return ent.MutateFunc(func(ctx context.Context, m ent.Mutation) (ent.Value, error) {
 			mut, ok := m.(mutationWithDisplayID)
-			if ok {
-				if id, exists := mut.ID(); exists {
-					// default the length to 6 if not set
-					length := 6
-					if i.DisplayIDLength > 0 {
-						length = i.DisplayIDLength
-					}
+			if !ok || !m.Op().Is(ent.OpCreate) {
+				return next.Mutate(ctx, m)
+			}
+
+			id, exists := mut.ID()
+			if !exists {
+				return next.Mutate(ctx, m)
+			}
 
-					out := generateShortCharID(id, length)
+			req := DisplayIDRequest{
+				Mutation: m,
+				Schema:   m.Type(),
+				ID:       id,
+			}
 
-					mut.SetDisplayID(fmt.Sprintf("%s-%s", i.HumanIdentifierPrefix, out))
+			if !i.SingleFieldIndex {
+				if owner, ok := m.Field(i.ownerField()); ok {
+					req.Owner = fmt.Sprint(owner)
 				}
 			}
 
-			return next.Mutate(ctx, m)
+			for {
+				out, err := strategy.Generate(ctx, req)
+				if err != nil {
+					return nil, err
+				}
+
+				mut.SetDisplayID(fmt.Sprintf("%s-%s", i.HumanIdentifierPrefix, out))
+
+				v, err := next.Mutate(ctx, m)
+
+				// another record has the display id, try the next one
+				if err != nil && req.Attempt+1 < attempts && isDisplayIDConflict(err) {
+					req.Attempt++
+					continue
+				}
+
+				return v, err
+			}
 		})
 	}
 }
 
-// generateShortCharID generates a set-length alphanumeric string based on a ULID.
-// Length 6: For up to 10,000 IDs, the collision probability is very low (~0.005%)
-// Length 6: For up to 100,000 IDs, the collision probability is low (~0.5%)
-func generateShortCharID(ulid string, length int) string {
-	// Hash the ULID using SHA256
-	hash := sha256.Sum256([]byte(ulid))
+// displayIDStrategy returns the strategy generating the display IDs
+func (i IDMixin) displayIDStrategy() DisplayIDStrategy {
+	if i.DisplayIDStrategy != nil {
+		return i.DisplayIDStrategy
+	}
+
+	// default the length to 6 if not set
+	length := 6
+	if i.DisplayIDLength > 0 {
+		length = i.DisplayIDLength
+	}
+
+	return HashDisplayID(length, Base32Alphabet)
+}
+
+// ownerField returns the field the display ID is unique with
+func (i IDMixin) ownerField() string {
+	if i.OverrideDefaultIndex != "" {
+		return i.OverrideDefaultIndex
+	}
+
+	return "owner_id"
+}
 
-	// Encode the hash using Base32 to get an alphanumeric string
-	encoded := base32.StdEncoding.EncodeToString(hash[:])
+// NormalizeDisplayID normalizes a display ID typed by a user, the prefix is matched without case and the rest is
+// normalized by the strategy
+func (i IDMixin) NormalizeDisplayID(displayID string) string {
+	displayID = strings.TrimSpace(displayID)
 
-	// Remove padding and make it uppercase
-	encoded = strings.ToUpper(strings.TrimRight(encoded, "="))
+	prefix, rest, ok := strings.Cut(displayID, "-")
+	if !ok || !strings.EqualFold(prefix, i.HumanIdentifierPrefix) {
+		return displayID
+	}
+
+	if n, ok := i.displayIDStrategy().(DisplayIDNormalizer); ok {
+		rest = n.Normalize(rest)
+	}
 
-	// Return the first n characters
-	return encoded[:length]
+	return i.HumanIdentifierPrefix + "-" + rest
 }
 
 // mutationWithDisplayID is an interface that mutations can implement to get the identifier ID
@@ -0,0 +1,45 @@
+package mixin
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+	"entgo.io/ent/schema/mixin"
+
+	"github.com/theopenlane/entx"
+)
+
+// OwnerIDField is the field holding the organization owning the record
+const OwnerIDField = "owner_id"
+
+// OrgOwnedMixin marks the schema as org owned and adds the owner_id field holding the organization owning the records.
+// The interceptors and hooks generated with entx.WithOrgScoping scope the queries and mutations of the schema to the
+// organization of the caller and set the owner_id of the records created
+type OrgOwnedMixin struct {
+	mixin.Schema
+}
+
+// Fields of the OrgOwnedMixin
+func (OrgOwnedMixin) Fields() []ent.Field {
+	return []ent.Field{
+		field.String(OwnerIDField).
+			Comment("the organization id that owns the object").
+			Optional().
+			Immutable(),
+	}
+}
+
+// Indexes of the OrgOwnedMixin
+func (OrgOwnedMixin) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields(OwnerIDField),
+	}
+}
+
+// Annotations of the OrgOwnedMixin
+func (OrgOwnedMixin) Annotations() []schema.Annotation {
+	return []schema.Annotation{
+		entx.OrgOwnedSchema{},
+	}
+}
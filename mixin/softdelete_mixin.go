@@ -0,0 +1,190 @@
+package mixin
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"entgo.io/contrib/entgql"
+	"entgo.io/ent"
+	"entgo.io/ent/dialect/sql"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/mixin"
+
+	"github.com/theopenlane/iam/auth"
+	"github.com/theopenlane/utils/ulids"
+
+	"github.com/theopenlane/entx"
+)
+
+const (
+	// DeletedAtField is the field holding when the record was soft deleted
+	DeletedAtField = "deleted_at"
+	// DeletedByField is the field holding who soft deleted the record
+	DeletedByField = "deleted_by"
+	// DeletedOpIDField is the field holding the id of the soft delete operation, shared by the records soft
+	// deleted by its cascade so they can be restored together
+	DeletedOpIDField = "deleted_op_id"
+)
+
+// SoftDeleteMixin implements the soft delete pattern for schemas. Deletes are turned into updates setting the
+// deleted_at and deleted_by fields, and soft deleted records are hidden from queries, unless the context was
+// created with entx.SkipSoftDelete, in which case records are deleted and returned as usual
+type SoftDeleteMixin struct {
+	mixin.Schema
+}
+
+// Fields of the SoftDeleteMixin
+func (SoftDeleteMixin) Fields() []ent.Field {
+	return []ent.Field{
+		field.Time(DeletedAtField).
+			Optional().
+			Annotations(
+				entgql.Skip(
+					entgql.SkipMutationCreateInput, entgql.SkipMutationUpdateInput,
+				),
+				entx.FieldAdminSearchable(false),
+			),
+		field.String(DeletedByField).
+			Optional().
+			Annotations(
+				entgql.Skip(
+					entgql.SkipMutationCreateInput, entgql.SkipMutationUpdateInput,
+				),
+				entx.FieldAdminSearchable(false),
+			),
+		field.String(DeletedOpIDField).
+			Optional().
+			Annotations(
+				entgql.Skip(
+					entgql.SkipMutationCreateInput, entgql.SkipMutationUpdateInput,
+				),
+				entx.FieldAdminSearchable(false),
+			),
+	}
+}
+
+// Hooks of the SoftDeleteMixin
+func (SoftDeleteMixin) Hooks() []ent.Hook {
+	return []ent.Hook{
+		SoftDeleteHook,
+	}
+}
+
+// Interceptors of the SoftDeleteMixin
+func (SoftDeleteMixin) Interceptors() []ent.Interceptor {
+	return []ent.Interceptor{
+		SoftDeleteInterceptor(),
+	}
+}
+
+// SoftDeleteHook turns deletes into updates setting the deleted_at and deleted_by fields, the update is run with
+// entx.IsSoftDelete set in the context so other hooks can tell it apart from a regular update. The deletes run by the
+// cascade of the delete share its operation id, which is recorded in the deleted_op_id field
+func SoftDeleteHook(next ent.Mutator) ent.Mutator {
+	type SoftDeleter interface {
+		SetOp(ent.Op)
+		SetDeletedAt(time.Time)
+		SetDeletedBy(string)
+		SetDeletedOpID(string)
+		WhereP(...func(*sql.Selector))
+	}
+
+	return ent.MutateFunc(func(ctx context.Context, m ent.Mutation) (ent.Value, error) {
+		if !m.Op().Is(ent.OpDeleteOne|ent.OpDelete) || entx.CheckSkipSoftDelete(ctx) {
+			return next.Mutate(ctx, m)
+		}
+
+		sd, ok := m.(SoftDeleter)
+		if !ok {
+			return nil, newUnexpectedSoftDeleteError(m)
+		}
+
+		client, ok := mutationClient(m)
+		if !ok {
+			return nil, newUnexpectedSoftDeleteError(m)
+		}
+
+		actor, err := auth.GetSubjectIDFromContext(ctx)
+		if err != nil {
+			actor = "unknown"
+		}
+
+		opID, ok := entx.SoftDeleteOpIDFromContext(ctx)
+		if !ok {
+			opID = ulids.New().String()
+			ctx = entx.WithSoftDeleteOpID(ctx, opID)
+		}
+
+		// records deleted before keep their original deletion
+		sd.WhereP(sql.FieldIsNull(DeletedAtField))
+		sd.SetOp(ent.OpUpdate)
+		sd.SetDeletedAt(time.Now())
+		sd.SetDeletedBy(actor)
+		sd.SetDeletedOpID(opID)
+
+		return client.Mutate(entx.IsSoftDelete(ctx, m.Type()), m)
+	})
+}
+
+// SoftDeleteInterceptor hides soft deleted records from queries unless the context was created with entx.SkipSoftDelete
+func SoftDeleteInterceptor() ent.Interceptor {
+	return ent.TraverseFunc(func(ctx context.Context, q ent.Query) error {
+		if entx.CheckSkipSoftDelete(ctx) {
+			return nil
+		}
+
+		if !whereP(q, sql.FieldIsNull(DeletedAtField)) {
+			return newUnexpectedSoftDeleteError(q)
+		}
+
+		return nil
+	})
+}
+
+// mutateClient is implemented by the generated ent client
+type mutateClient interface {
+	Mutate(context.Context, ent.Mutation) (ent.Value, error)
+}
+
+// mutationClient returns the generated client of the mutation, which runs the mutation with the
+// builder of its op; the client type is generated per project so it is looked up by reflection
+func mutationClient(m ent.Mutation) (mutateClient, bool) {
+	method := reflect.ValueOf(m).MethodByName("Client")
+	if !method.IsValid() || method.Type().NumIn() != 0 || method.Type().NumOut() != 1 {
+		return nil, false
+	}
+
+	client, ok := method.Call(nil)[0].Interface().(mutateClient)
+
+	return client, ok
+}
+
+// whereP adds the storage predicates to the query; generated query builders take predicates of the
+// generated predicate type, which is a func(*sql.Selector), so they are converted by reflection
+func whereP(q any, ps ...func(*sql.Selector)) bool {
+	if w, ok := q.(interface{ WhereP(...func(*sql.Selector)) }); ok {
+		w.WhereP(ps...)
+
+		return true
+	}
+
+	method := reflect.ValueOf(q).MethodByName("Where")
+	if !method.IsValid() || !method.Type().IsVariadic() || method.Type().NumIn() != 1 {
+		return false
+	}
+
+	predicate := method.Type().In(0).Elem()
+	if !reflect.TypeOf(ps[0]).ConvertibleTo(predicate) {
+		return false
+	}
+
+	args := make([]reflect.Value, 0, len(ps))
+	for _, p := range ps {
+		args = append(args, reflect.ValueOf(p).Convert(predicate))
+	}
+
+	method.Call(args)
+
+	return true
+}
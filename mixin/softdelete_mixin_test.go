@@ -0,0 +1,220 @@
+package mixin_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"entgo.io/ent"
+	"entgo.io/ent/dialect/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theopenlane/entx"
+	"github.com/theopenlane/entx/mixin"
+)
+
+// mutateRecorder is the client of the soft delete mutations, it records the mutation it runs
+type mutateRecorder struct {
+	ctx      context.Context
+	mutation ent.Mutation
+}
+
+func (c *mutateRecorder) Mutate(ctx context.Context, m ent.Mutation) (ent.Value, error) {
+	c.ctx, c.mutation = ctx, m
+
+	return nil, nil
+}
+
+// softDeleteMutation is a mutation of a soft deletable schema
+type softDeleteMutation struct {
+	ent.Mutation
+
+	op          ent.Op
+	deletedAt   time.Time
+	deletedBy   string
+	deletedOpID string
+	predicates  []func(*sql.Selector)
+	client      *mutateRecorder
+}
+
+func (m *softDeleteMutation) Op() ent.Op               { return m.op }
+func (m *softDeleteMutation) SetOp(op ent.Op)          { m.op = op }
+func (m *softDeleteMutation) Type() string             { return "Task" }
+func (m *softDeleteMutation) SetDeletedAt(t time.Time) { m.deletedAt = t }
+func (m *softDeleteMutation) SetDeletedBy(s string)    { m.deletedBy = s }
+func (m *softDeleteMutation) SetDeletedOpID(s string)  { m.deletedOpID = s }
+func (m *softDeleteMutation) Client() *mutateRecorder  { return m.client }
+func (m *softDeleteMutation) WhereP(ps ...func(*sql.Selector)) {
+	m.predicates = append(m.predicates, ps...)
+}
+
+// where returns the where clause of the predicates added to the mutation
+func (m *softDeleteMutation) where() string {
+	s := sql.Select("*").From(sql.Table("tasks"))
+	for _, p := range m.predicates {
+		p(s)
+	}
+
+	query, _ := s.Query()
+
+	return query
+}
+
+// plainMutation is a mutation of a schema without the soft delete fields
+type plainMutation struct {
+	ent.Mutation
+}
+
+func (plainMutation) Op() ent.Op { return ent.OpDeleteOne }
+
+func TestSoftDeleteHook(t *testing.T) {
+	for _, op := range []ent.Op{ent.OpDeleteOne, ent.OpDelete} {
+		t.Run(op.String(), func(t *testing.T) {
+			m := &softDeleteMutation{op: op, client: &mutateRecorder{}}
+
+			next := ent.MutateFunc(func(context.Context, ent.Mutation) (ent.Value, error) {
+				t.Fatal("the delete should be run as an update by the client")
+				return nil, nil
+			})
+
+			start := time.Now()
+
+			_, err := mixin.SoftDeleteHook(next).Mutate(context.Background(), m)
+			require.NoError(t, err)
+
+			// the delete is rerun by the client as an update of the records not deleted yet
+			assert.Same(t, m, m.client.mutation)
+			assert.Equal(t, ent.OpUpdate, m.op)
+			assert.Equal(t, "SELECT * FROM `tasks` WHERE `tasks`.`deleted_at` IS NULL", m.where())
+			assert.True(t, entx.CheckIsSoftDeleteType(m.client.ctx, "Task"))
+
+			assert.WithinRange(t, m.deletedAt, start, time.Now())
+			assert.Equal(t, "unknown", m.deletedBy)
+			assert.NotEmpty(t, m.deletedOpID)
+
+			// the cascade of the delete shares its operation id
+			opID, ok := entx.SoftDeleteOpIDFromContext(m.client.ctx)
+			assert.True(t, ok)
+			assert.Equal(t, m.deletedOpID, opID)
+		})
+	}
+}
+
+func TestSoftDeleteHookCascade(t *testing.T) {
+	m := &softDeleteMutation{op: ent.OpDelete, client: &mutateRecorder{}}
+
+	ctx := entx.WithSoftDeleteOpID(context.Background(), "op1")
+
+	_, err := mixin.SoftDeleteHook(nil).Mutate(ctx, m)
+	require.NoError(t, err)
+
+	assert.Equal(t, "op1", m.deletedOpID)
+}
+
+func TestSoftDeleteHookPassThrough(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+		op   ent.Op
+	}{
+		{
+			name: "skip soft delete",
+			ctx:  entx.SkipSoftDelete(context.Background()),
+			op:   ent.OpDeleteOne,
+		},
+		{
+			name: "update",
+			ctx:  context.Background(),
+			op:   ent.OpUpdateOne,
+		},
+		{
+			name: "create",
+			ctx:  context.Background(),
+			op:   ent.OpCreate,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &softDeleteMutation{op: tc.op, client: &mutateRecorder{}}
+			called := false
+
+			next := ent.MutateFunc(func(context.Context, ent.Mutation) (ent.Value, error) {
+				called = true
+				return nil, nil
+			})
+
+			_, err := mixin.SoftDeleteHook(next).Mutate(tc.ctx, m)
+			require.NoError(t, err)
+
+			assert.True(t, called)
+			assert.Equal(t, tc.op, m.op)
+			assert.Empty(t, m.deletedBy)
+			assert.Empty(t, m.predicates)
+			assert.Nil(t, m.client.mutation)
+		})
+	}
+}
+
+func TestSoftDeleteHookUnexpectedMutation(t *testing.T) {
+	_, err := mixin.SoftDeleteHook(nil).Mutate(context.Background(), plainMutation{})
+
+	var unexpected *mixin.UnexpectedSoftDeleteError
+
+	assert.ErrorAs(t, err, &unexpected)
+}
+
+// softDeleteQuery is a query taking storage predicates
+type softDeleteQuery struct {
+	predicates []func(*sql.Selector)
+}
+
+func (q *softDeleteQuery) WhereP(ps ...func(*sql.Selector)) {
+	q.predicates = append(q.predicates, ps...)
+}
+
+// taskPredicate is the predicate type generated for the schema
+type taskPredicate func(*sql.Selector)
+
+// generatedQuery is a query taking the generated predicates only
+type generatedQuery struct {
+	predicates []taskPredicate
+}
+
+func (q *generatedQuery) Where(ps ...taskPredicate) { q.predicates = append(q.predicates, ps...) }
+
+func TestSoftDeleteInterceptor(t *testing.T) {
+	traverser, ok := mixin.SoftDeleteInterceptor().(ent.Traverser)
+	require.True(t, ok)
+
+	where := func(ps ...func(*sql.Selector)) string {
+		s := sql.Select("*").From(sql.Table("tasks"))
+		for _, p := range ps {
+			p(s)
+		}
+
+		query, _ := s.Query()
+
+		return query
+	}
+
+	q := &softDeleteQuery{}
+	require.NoError(t, traverser.Traverse(context.Background(), q))
+	assert.Equal(t, "SELECT * FROM `tasks` WHERE `tasks`.`deleted_at` IS NULL", where(q.predicates...))
+
+	// the predicates are converted to the generated predicate type
+	g := &generatedQuery{}
+	require.NoError(t, traverser.Traverse(context.Background(), g))
+	require.Len(t, g.predicates, 1)
+	assert.Equal(t, "SELECT * FROM `tasks` WHERE `tasks`.`deleted_at` IS NULL", where(g.predicates[0]))
+
+	// the soft deleted records are returned when skipped
+	q = &softDeleteQuery{}
+	require.NoError(t, traverser.Traverse(entx.SkipSoftDelete(context.Background()), q))
+	assert.Empty(t, q.predicates)
+
+	var unexpected *mixin.UnexpectedSoftDeleteError
+
+	assert.ErrorAs(t, traverser.Traverse(context.Background(), struct{}{}), &unexpected)
+}
@@ -1,22 +1,56 @@
 package mixin
 
 import (
+	"context"
+	"fmt"
+	"slices"
+
 	"entgo.io/ent"
+	"entgo.io/ent/schema"
 	"entgo.io/ent/schema/field"
 	"entgo.io/ent/schema/mixin"
 
 	"github.com/theopenlane/entx"
 )
 
-// TagMixin holds the schema definition for the tags
+// tagsFieldName is the field holding the tags
+const tagsFieldName = "tags"
+
+// TagMixin holds the schema definition for the tags. The tags are normalized on write, lower cased with their
+// whitespace collapsed and without duplicates, and restricted to the vocabulary when one is set with NewTagMixin
 type TagMixin struct {
 	mixin.Schema
+
+	vocabulary []string
+}
+
+// TagOption configures the TagMixin
+type TagOption func(*TagMixin)
+
+// WithTagVocabulary restricts the tags of the schema to the vocabulary, the tags are normalized before being compared
+func WithTagVocabulary(tags ...string) TagOption {
+	return func(t *TagMixin) {
+		t.vocabulary = append(t.vocabulary, tags...)
+	}
+}
+
+// NewTagMixin returns a TagMixin configured with the options
+func NewTagMixin(opts ...TagOption) TagMixin {
+	t := TagMixin{}
+
+	for _, opt := range opts {
+		opt(&t)
+	}
+
+	t.vocabulary = entx.NormalizeTags(t.vocabulary)
+
+	return t
 }
 
 // Fields of the TagMixin.
 func (t TagMixin) Fields() []ent.Field {
 	return []ent.Field{
-		field.Strings("tags").
+		field.Strings(tagsFieldName).
 			Comment("tags associated with the object").
 			Default([]string{}).
 			Annotations(
@@ -25,3 +59,95 @@ func (t TagMixin) Fields() []ent.Field {
 			Optional(),
 	}
 }
+
+// Hooks of the TagMixin
+func (t TagMixin) Hooks() []ent.Hook {
+	return []ent.Hook{
+		NewTagHook(t.vocabulary...),
+	}
+}
+
+// Annotations of the TagMixin
+func (t TagMixin) Annotations() []schema.Annotation {
+	return []schema.Annotation{
+		entx.TagsAnnotation{
+			Field:      tagsFieldName,
+			Vocabulary: t.vocabulary,
+		},
+	}
+}
+
+// NewTagHook returns a hook normalizing the tags set and appended by the mutations, the tags outside of the
+// vocabulary are rejected when one is given
+func NewTagHook(vocabulary ...string) ent.Hook {
+	type TagMutation interface {
+		Tags() ([]string, bool)
+		SetTags([]string)
+		AppendedTags() ([]string, bool)
+		AppendTags([]string)
+		ResetTags()
+	}
+
+	vocabulary = entx.NormalizeTags(vocabulary)
+
+	allowed := func(tags []string) error {
+		if len(vocabulary) == 0 {
+			return nil
+		}
+
+		for _, tag := range tags {
+			if !slices.Contains(vocabulary, tag) {
+				return fmt.Errorf("%w: %q", ErrTagNotAllowed, tag)
+			}
+		}
+
+		return nil
+	}
+
+	return func(next ent.Mutator) ent.Mutator {
+		return ent.MutateFunc(func(ctx context.Context, m ent.Mutation) (ent.Value, error) {
+			tm, ok := m.(TagMutation)
+			if !ok || !m.Op().Is(ent.OpCreate|ent.OpUpdateOne|ent.OpUpdate) {
+				return next.Mutate(ctx, m)
+			}
+
+			tags, set := tm.Tags()
+			appended, appends := tm.AppendedTags()
+			cleared := m.FieldCleared(tagsFieldName)
+
+			if !set && !appends {
+				return next.Mutate(ctx, m)
+			}
+
+			tags, appended = entx.NormalizeTags(tags), entx.NormalizeTags(appended)
+
+			if err := allowed(tags); err != nil {
+				return nil, err
+			}
+
+			if err := allowed(appended); err != nil {
+				return nil, err
+			}
+
+			// setting the tags drops the appended ones, the mutation is reset and both are set again; the appended tags
+			// are added to the stored ones in SQL, those already stored are not deduplicated
+			tm.ResetTags()
+
+			if set {
+				tm.SetTags(tags)
+			}
+
+			if appends {
+				tm.AppendTags(appended)
+			}
+
+			if cleared {
+				if err := m.ClearField(tagsFieldName); err != nil {
+					return nil, err
+				}
+			}
+
+			return next.Mutate(ctx, m)
+		})
+	}
+}
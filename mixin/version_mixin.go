@@ -0,0 +1,131 @@
+package mixin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"entgo.io/contrib/entgql"
+	"entgo.io/ent"
+	"entgo.io/ent/dialect/sql"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/mixin"
+
+	"github.com/theopenlane/entx"
+)
+
+// VersionField is the field holding the version of the record
+const VersionField = "version"
+
+// VersionMixin implements optimistic concurrency for schemas. The version of the record is incremented by each update,
+// and single record updates must set the version the caller read, exposed on the GraphQL update inputs; the update
+// is rejected with a VersionConflictError when the record was updated since
+type VersionMixin struct {
+	mixin.Schema
+}
+
+// Fields of the VersionMixin
+func (VersionMixin) Fields() []ent.Field {
+	return []ent.Field{
+		field.Int(VersionField).
+			Comment("the version of the record, incremented by each update and required to update the record").
+			Default(1).
+			NonNegative().
+			Annotations(
+				entgql.Skip(entgql.SkipMutationCreateInput),
+				entx.FieldAdminSearchable(false),
+			),
+	}
+}
+
+// Hooks of the VersionMixin
+func (VersionMixin) Hooks() []ent.Hook {
+	return []ent.Hook{
+		VersionHook,
+	}
+}
+
+// VersionHook increments the version of the updated records in the update statement. The version set on the
+// mutation is the version expected by the caller, the update only matches the records still at that version; it is
+// required on single record updates unless the context was created with entx.SkipVersionCheck. A single record update
+// matching no record fails with the *NotFoundError of the generated package, which is returned as a
+// VersionConflictError; the error is matched by its type name, see isNotFound
+func VersionHook(next ent.Mutator) ent.Mutator {
+	type Versioned interface {
+		Version() (int, bool)
+		ResetVersion()
+		AddVersion(int)
+		WhereP(...func(*sql.Selector))
+	}
+
+	return ent.MutateFunc(func(ctx context.Context, m ent.Mutation) (ent.Value, error) {
+		if !m.Op().Is(ent.OpUpdateOne | ent.OpUpdate) {
+			return next.Mutate(ctx, m)
+		}
+
+		vm, ok := m.(Versioned)
+		if !ok {
+			return nil, newUnexpectedVersionError(m)
+		}
+
+		expected, ok := vm.Version()
+
+		switch {
+		case ok:
+			vm.WhereP(sql.FieldEQ(VersionField, expected))
+		case m.Op().Is(ent.OpUpdateOne) && !entx.CheckSkipVersionCheck(ctx):
+			return nil, fmt.Errorf("%w: %s", ErrVersionRequired, m.Type())
+		}
+
+		// the version is incremented by the statement so concurrent updates cannot both match the expected version
+		vm.ResetVersion()
+		vm.AddVersion(1)
+
+		v, err := next.Mutate(ctx, m)
+		if err != nil && ok && m.Op().Is(ent.OpUpdateOne) && isNotFound(err) {
+			return nil, &VersionConflictError{
+				Type:    m.Type(),
+				ID:      mutationID(m),
+				Version: expected,
+			}
+		}
+
+		return v, err
+	})
+}
+
+// mutationID returns the id of the record updated by the mutation, the id type is generated per schema so the id is
+// read by reflection
+func mutationID(m ent.Mutation) any {
+	method := reflect.ValueOf(m).MethodByName("ID")
+	if !method.IsValid() || method.Type().NumIn() != 0 || method.Type().NumOut() != 2 {
+		return nil
+	}
+
+	out := method.Call(nil)
+	if !out[1].Bool() {
+		return nil
+	}
+
+	return out[0].Interface()
+}
+
+// isNotFound reports whether the error is the not found error of the generated package, returned when no record
+// matches the update. ent generates a NotFoundError type in each project package, which cannot be imported here, so
+// any error in the chain whose type is named NotFoundError matches; the mutators wrapping the hook must keep that
+// error in the chain of the errors they return
+func isNotFound(err error) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		t := reflect.TypeOf(err)
+		if t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+
+		if t.Name() == "NotFoundError" {
+			return true
+		}
+	}
+
+	return false
+}
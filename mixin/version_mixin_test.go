@@ -0,0 +1,192 @@
+package mixin_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"entgo.io/ent"
+	"entgo.io/ent/dialect/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theopenlane/entx"
+	"github.com/theopenlane/entx/mixin"
+)
+
+// NotFoundError mimics the not found error generated by ent
+type NotFoundError struct{}
+
+func (*NotFoundError) Error() string {
+	return "task not found"
+}
+
+var errTaskNotFound = &NotFoundError{}
+
+// versionMutation is a mutation of a versioned schema
+type versionMutation struct {
+	ent.Mutation
+
+	op         ent.Op
+	id         string
+	version    *int
+	added      int
+	predicates []func(*sql.Selector)
+}
+
+func (m *versionMutation) Op() ent.Op       { return m.op }
+func (m *versionMutation) Type() string     { return "Task" }
+func (m *versionMutation) ResetVersion()    { m.version, m.added = nil, 0 }
+func (m *versionMutation) AddVersion(i int) { m.added += i }
+
+func (m *versionMutation) ID() (string, bool) {
+	return m.id, m.id != ""
+}
+
+func (m *versionMutation) Version() (int, bool) {
+	if m.version == nil {
+		return 0, false
+	}
+
+	return *m.version, true
+}
+
+func (m *versionMutation) WhereP(ps ...func(*sql.Selector)) {
+	m.predicates = append(m.predicates, ps...)
+}
+
+// where returns the where clause of the predicates added to the mutation
+func (m *versionMutation) where() (string, []any) {
+	s := sql.Select("*").From(sql.Table("tasks"))
+	for _, p := range m.predicates {
+		p(s)
+	}
+
+	return s.Query()
+}
+
+func TestVersionHook(t *testing.T) {
+	version := func(v int) *int { return &v }
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		mutation   *versionMutation
+		err        error
+		wantErr    error
+		wantWhere  string
+		wantArgs   []any
+		wantCalled bool
+	}{
+		{
+			name:       "single record update with the version",
+			mutation:   &versionMutation{op: ent.OpUpdateOne, id: "t1", version: version(3)},
+			wantWhere:  "SELECT * FROM `tasks` WHERE `tasks`.`version` = ?",
+			wantArgs:   []any{3},
+			wantCalled: true,
+		},
+		{
+			name:     "single record update without the version",
+			mutation: &versionMutation{op: ent.OpUpdateOne, id: "t1"},
+			wantErr:  mixin.ErrVersionRequired,
+		},
+		{
+			name:       "single record update skipping the version check",
+			ctx:        entx.SkipVersionCheck(context.Background()),
+			mutation:   &versionMutation{op: ent.OpUpdateOne, id: "t1"},
+			wantWhere:  "SELECT * FROM `tasks`",
+			wantCalled: true,
+		},
+		{
+			name:       "bulk update without the version",
+			mutation:   &versionMutation{op: ent.OpUpdate},
+			wantWhere:  "SELECT * FROM `tasks`",
+			wantCalled: true,
+		},
+		{
+			name:       "bulk update with the version",
+			mutation:   &versionMutation{op: ent.OpUpdate, version: version(2)},
+			wantWhere:  "SELECT * FROM `tasks` WHERE `tasks`.`version` = ?",
+			wantArgs:   []any{2},
+			wantCalled: true,
+		},
+		{
+			name:       "single record updated since it was read",
+			mutation:   &versionMutation{op: ent.OpUpdateOne, id: "t1", version: version(3)},
+			err:        fmt.Errorf("updating task: %w", errTaskNotFound),
+			wantErr:    mixin.ErrVersionConflict,
+			wantCalled: true,
+		},
+		{
+			name:       "single record not found without the version",
+			ctx:        entx.SkipVersionCheck(context.Background()),
+			mutation:   &versionMutation{op: ent.OpUpdateOne, id: "t1"},
+			err:        errTaskNotFound,
+			wantErr:    errTaskNotFound,
+			wantCalled: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := tc.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+
+			called := false
+
+			next := ent.MutateFunc(func(_ context.Context, m ent.Mutation) (ent.Value, error) {
+				called = true
+
+				// the version is incremented by the statement instead of set
+				_, ok := m.(*versionMutation).Version()
+				assert.False(t, ok)
+				assert.Equal(t, 1, m.(*versionMutation).added)
+
+				return nil, tc.err
+			})
+
+			_, err := mixin.VersionHook(next).Mutate(ctx, tc.mutation)
+			assert.Equal(t, tc.wantCalled, called)
+
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			where, args := tc.mutation.where()
+			assert.Equal(t, tc.wantWhere, where)
+			assert.Equal(t, tc.wantArgs, args)
+		})
+	}
+}
+
+func TestVersionHookConflictError(t *testing.T) {
+	next := ent.MutateFunc(func(context.Context, ent.Mutation) (ent.Value, error) {
+		return nil, errTaskNotFound
+	})
+
+	v := 1
+	_, err := mixin.VersionHook(next).Mutate(context.Background(), &versionMutation{op: ent.OpUpdateOne, id: "t1", version: &v})
+
+	var conflict *mixin.VersionConflictError
+
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, &mixin.VersionConflictError{Type: "Task", ID: "t1", Version: 1}, conflict)
+	assert.EqualError(t, err, "version conflict: Task t1 is no longer at version 1")
+
+	// the other operations are not versioned
+	called := false
+	next = ent.MutateFunc(func(context.Context, ent.Mutation) (ent.Value, error) {
+		called = true
+		return nil, nil
+	})
+
+	_, err = mixin.VersionHook(next).Mutate(context.Background(), &versionMutation{op: ent.OpCreate})
+	require.NoError(t, err)
+	assert.True(t, called)
+}
@@ -3,62 +3,377 @@ package entx
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"entgo.io/ent/dialect"
+	entsql "entgo.io/ent/dialect/sql"
 )
 
+// DivergenceStage is the point at which a write reached the primary but not the secondary
+type DivergenceStage string
+
+const (
+	// DivergenceStageCommit is a secondary commit failing after the primary committed
+	DivergenceStageCommit DivergenceStage = "commit"
+	// DivergenceStageOutbox is a committed write that could not be recorded in the async outbox
+	DivergenceStageOutbox DivergenceStage = "outbox"
+)
+
+// DivergenceEvent describes a write that was committed to the primary but not the secondary
+type DivergenceEvent struct {
+	// Stage is where the secondary fell behind
+	Stage DivergenceStage
+	// Queries are the statements that were committed to the primary but not the secondary
+	Queries []string
+	// Err is the error returned by the secondary
+	Err error
+}
+
 // MultiWriteDriver allows you to write to a primary and secondary database
 type MultiWriteDriver struct {
 	// Wp (write-primary), Ws (write-secondary) Drivers
 	Wp, Ws dialect.Driver
+	// OnDivergence is called when a write is committed to the primary but not the secondary
+	OnDivergence func(context.Context, DivergenceEvent)
+	// Async records secondary writes in an outbox and replays them in the background instead of
+	// writing to Ws synchronously
+	Async *AsyncReplicator
+
+	divergences atomic.Int64
+	// lastDivergence is the unix time in nanoseconds of the last divergence
+	lastDivergence atomic.Int64
+
+	// replay serves the results of the write statements sent through Query once their transaction is committed
+	replayOnce sync.Once
+	replay     *sql.DB
 }
 
 var _ dialect.Driver = (*MultiWriteDriver)(nil)
 
-// Query will query the primary write database
+// Query will query the primary write database. Write statements, such as the ent inserts and upserts
+// returning the created ids, are run in a transaction on both write drivers, or recorded for replay in
+// async mode, like Exec; their result is read before the transaction is committed and then served to the caller
 func (d *MultiWriteDriver) Query(ctx context.Context, query string, args, v any) error {
-	return d.Wp.Query(ctx, query, args, v)
+	if !isWriteQuery(query) {
+		return d.Wp.Query(ctx, query, args, v)
+	}
+
+	tx, err := d.Tx(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Query(ctx, query, args, v); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	rows, ok := v.(*entsql.Rows)
+	if !ok {
+		return tx.Commit()
+	}
+
+	entry, err := readRows(rows)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	d.replayOnce.Do(func() {
+		d.replay = sql.OpenDB(cacheReplayConnector{})
+	})
+
+	return replayRows(ctx, d.replay, entry, rows)
 }
 
-// Exec logs its params and calls the underlying driver Exec method for both write drivers
+// Exec runs the statement in a transaction on both write drivers so it is either applied to both or neither;
+// in async mode the statement is recorded for replay once the primary commits
 func (d *MultiWriteDriver) Exec(ctx context.Context, query string, args, v any) error {
-	err := d.Ws.Exec(ctx, query, args, v)
+	tx, err := d.Tx(ctx)
 	if err != nil {
 		return err
 	}
 
-	return d.Wp.Exec(ctx, query, args, v)
+	if err := tx.Exec(ctx, query, args, v); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	return tx.Commit()
 }
 
-// Tx wraps the Exec and Query operations in transaction.
+// Tx starts a transaction on both write drivers; every Exec is mirrored and both are committed or rolled back together
 func (d *MultiWriteDriver) Tx(ctx context.Context) (dialect.Tx, error) {
-	return d.Wp.Tx(ctx)
+	return d.begin(ctx, func(drv dialect.Driver) (dialect.Tx, error) {
+		return drv.Tx(ctx)
+	})
 }
 
-// BeginTx adds an log-id for the transaction and calls the underlying driver BeginTx command if it is supported.
+// BeginTx calls the underlying drivers BeginTx command if it is supported and falls back to Tx otherwise
 func (d *MultiWriteDriver) BeginTx(ctx context.Context, opts *sql.TxOptions) (dialect.Tx, error) {
-	return d.Wp.(interface {
-		BeginTx(context.Context, *sql.TxOptions) (dialect.Tx, error)
-	}).BeginTx(ctx, opts)
+	return d.begin(ctx, func(drv dialect.Driver) (dialect.Tx, error) {
+		if b, ok := drv.(interface {
+			BeginTx(context.Context, *sql.TxOptions) (dialect.Tx, error)
+		}); ok {
+			return b.BeginTx(ctx, opts)
+		}
+
+		return drv.Tx(ctx)
+	})
 }
 
-// Close the underlying connections
+// Close stops the async replay, if enabled, and closes the underlying connections
 func (d *MultiWriteDriver) Close() error {
-	wserr := d.Ws.Close()
-
-	wperr := d.Wp.Close()
-	if wperr != nil {
-		return wserr
+	var asyncErr error
+	if d.Async != nil {
+		asyncErr = d.Async.Close()
 	}
 
-	if wserr != nil {
-		return wserr
+	var replayErr error
+	if d.replay != nil {
+		replayErr = d.replay.Close()
 	}
 
-	return nil
+	return errors.Join(asyncErr, replayErr, d.Ws.Close(), d.Wp.Close())
 }
 
 // Dialect returns the dialect name of the primary driver
 func (d *MultiWriteDriver) Dialect() string {
 	return d.Wp.Dialect()
 }
+
+// Divergences returns the number of writes committed to the primary but not the secondary
+func (d *MultiWriteDriver) Divergences() int64 {
+	return d.divergences.Load()
+}
+
+// LastDivergence returns when the last write was committed to the primary but not the secondary, the zero time if none was
+func (d *MultiWriteDriver) LastDivergence() time.Time {
+	last := d.lastDivergence.Load()
+	if last == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, last)
+}
+
+// begin starts a transaction on the primary and then the secondary driver
+func (d *MultiWriteDriver) begin(ctx context.Context, start func(dialect.Driver) (dialect.Tx, error)) (dialect.Tx, error) {
+	primary, err := start(d.Wp)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.Async != nil {
+		return &MultiWriteTx{
+			ctx:     ctx,
+			driver:  d,
+			primary: primary,
+		}, nil
+	}
+
+	secondary, err := start(d.Ws)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("%w: %w", ErrSecondaryWriteFailed, err), primary.Rollback())
+	}
+
+	return &MultiWriteTx{
+		ctx:       ctx,
+		driver:    d,
+		primary:   primary,
+		secondary: secondary,
+	}, nil
+}
+
+// diverged records and reports a write that reached the primary but not the secondary
+func (d *MultiWriteDriver) diverged(ctx context.Context, event DivergenceEvent) {
+	d.divergences.Add(1)
+	d.lastDivergence.Store(time.Now().UnixNano())
+
+	if d.OnDivergence != nil {
+		d.OnDivergence(ctx, event)
+	}
+}
+
+// MultiWriteTx is a transaction spanning the primary and secondary write drivers; in async mode
+// there is no secondary transaction and the statements are recorded once the primary commits
+type MultiWriteTx struct {
+	ctx       context.Context
+	driver    *MultiWriteDriver
+	primary   dialect.Tx
+	secondary dialect.Tx
+	queries   []string
+	pending   []OutboxEntry
+}
+
+var _ dialect.Tx = (*MultiWriteTx)(nil)
+
+// Query will query the primary transaction; write statements are mirrored to the secondary
+// transaction, or recorded for the outbox in async mode, like Exec. The rows of the primary are returned to the caller
+func (tx *MultiWriteTx) Query(ctx context.Context, query string, args, v any) error {
+	if !isWriteQuery(query) {
+		return tx.primary.Query(ctx, query, args, v)
+	}
+
+	if tx.secondary == nil {
+		return tx.writeAsync(ctx, tx.primary.Query, query, args, v)
+	}
+
+	if err := tx.primary.Query(ctx, query, args, v); err != nil {
+		return err
+	}
+
+	rows := scratchValue(v)
+	if err := tx.secondary.Query(ctx, query, args, rows); err != nil {
+		return fmt.Errorf("%w: %w", ErrSecondaryWriteFailed, err)
+	}
+
+	if err := discardRows(rows); err != nil {
+		return fmt.Errorf("%w: %w", ErrSecondaryWriteFailed, err)
+	}
+
+	tx.queries = append(tx.queries, query)
+
+	return nil
+}
+
+// Exec runs the statement on the primary and then mirrors it to the secondary transaction;
+// the result of the primary is scanned into v
+func (tx *MultiWriteTx) Exec(ctx context.Context, query string, args, v any) error {
+	if tx.secondary == nil {
+		return tx.writeAsync(ctx, tx.primary.Exec, query, args, v)
+	}
+
+	if err := tx.primary.Exec(ctx, query, args, v); err != nil {
+		return err
+	}
+
+	if err := tx.secondary.Exec(ctx, query, args, scratchValue(v)); err != nil {
+		return fmt.Errorf("%w: %w", ErrSecondaryWriteFailed, err)
+	}
+
+	tx.queries = append(tx.queries, query)
+
+	return nil
+}
+
+// Commit commits the primary and then the secondary transaction. If the primary fails, the secondary
+// is rolled back. If only the secondary fails the primary data is kept, so the divergence is reported
+// to the driver instead of returning an error that would make callers retry a committed write
+func (tx *MultiWriteTx) Commit() error {
+	if tx.secondary == nil {
+		return tx.commitAsync()
+	}
+
+	if err := tx.primary.Commit(); err != nil {
+		return errors.Join(err, tx.secondary.Rollback())
+	}
+
+	if err := tx.secondary.Commit(); err != nil {
+		tx.driver.diverged(tx.ctx, DivergenceEvent{
+			Stage:   DivergenceStageCommit,
+			Queries: tx.queries,
+			Err:     err,
+		})
+	}
+
+	return nil
+}
+
+// Rollback rolls back both transactions
+func (tx *MultiWriteTx) Rollback() error {
+	if tx.secondary == nil {
+		return tx.primary.Rollback()
+	}
+
+	return errors.Join(tx.primary.Rollback(), tx.secondary.Rollback())
+}
+
+// writeAsync runs the statement on the primary with Exec or Query and holds it for the outbox until commit
+func (tx *MultiWriteTx) writeAsync(ctx context.Context, run func(context.Context, string, any, any) error, query string, args, v any) error {
+	list, ok := args.([]any)
+	if !ok && args != nil {
+		return fmt.Errorf("%w: %T", ErrOutboxArgument, args)
+	}
+
+	// surface arguments that cannot be recorded before they are written to the primary
+	if _, err := encodeOutboxArgs(list); err != nil {
+		return err
+	}
+
+	if err := run(ctx, query, args, v); err != nil {
+		return err
+	}
+
+	tx.queries = append(tx.queries, query)
+	tx.pending = append(tx.pending, OutboxEntry{Query: query, Args: list})
+
+	return nil
+}
+
+// commitAsync commits the primary and records its statements in the outbox for replay; the commits
+// of the other transactions wait for the append so the transactions are replayed in commit order
+func (tx *MultiWriteTx) commitAsync() error {
+	if len(tx.pending) == 0 {
+		return tx.primary.Commit()
+	}
+
+	tx.driver.Async.commitMu.Lock()
+	defer tx.driver.Async.commitMu.Unlock()
+
+	if err := tx.primary.Commit(); err != nil {
+		return err
+	}
+
+	if err := tx.driver.Async.Enqueue(tx.ctx, tx.pending...); err != nil {
+		tx.driver.diverged(tx.ctx, DivergenceEvent{
+			Stage:   DivergenceStageOutbox,
+			Queries: tx.queries,
+			Err:     err,
+		})
+	}
+
+	return nil
+}
+
+// scratchValue returns a new value of the same type as v so the secondary result does not
+// overwrite the primary result that is returned to the caller
+func scratchValue(v any) any {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() || rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return v
+	}
+
+	return reflect.New(rv.Type().Elem()).Interface()
+}
+
+// writeStatements are the statements that write data; ent sends inserts and upserts returning the
+// created ids through Query instead of Exec
+var writeStatements = []string{"insert", "update", "delete", "replace"}
+
+// isWriteQuery reports whether the statement writes data
+func isWriteQuery(query string) bool {
+	fields := strings.Fields(query)
+
+	return len(fields) > 0 && containsFold(writeStatements, fields[0])
+}
+
+// discardRows reads the rows of a statement mirrored to the secondary to the end and closes them
+func discardRows(v any) error {
+	rows, ok := v.(*entsql.Rows)
+	if !ok || rows.ColumnScanner == nil {
+		return nil
+	}
+
+	for rows.Next() {
+	}
+
+	return errors.Join(rows.Err(), rows.Close())
+}
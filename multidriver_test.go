@@ -0,0 +1,133 @@
+package entx_test
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+
+	"entgo.io/ent/entc/gen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theopenlane/entx"
+)
+
+var errTestDriver = errors.New("driver failure")
+
+func TestMultiWriteDriverExec(t *testing.T) {
+	primary := &recordingDriver{name: "primary"}
+	secondary := &recordingDriver{name: "secondary"}
+
+	drv := &entx.MultiWriteDriver{Wp: primary, Ws: secondary}
+
+	require.NoError(t, drv.Exec(context.Background(), "INSERT", []any{}, nil))
+
+	assert.Equal(t, []string{"INSERT"}, primary.execs)
+	assert.Equal(t, []string{"INSERT"}, secondary.execs)
+	assert.Equal(t, 1, primary.commits)
+	assert.Equal(t, 1, secondary.commits)
+}
+
+func TestMultiWriteDriverExecPrimaryFailure(t *testing.T) {
+	primary := &recordingDriver{name: "primary", err: errTestDriver}
+	secondary := &recordingDriver{name: "secondary"}
+
+	drv := &entx.MultiWriteDriver{Wp: primary, Ws: secondary}
+
+	err := drv.Exec(context.Background(), "INSERT", []any{}, nil)
+	require.ErrorIs(t, err, errTestDriver)
+
+	// the secondary never sees a write the primary rejected
+	assert.Empty(t, secondary.execs)
+	assert.Equal(t, 1, primary.rollbacks)
+	assert.Equal(t, 1, secondary.rollbacks)
+	assert.Zero(t, secondary.commits)
+}
+
+func TestMultiWriteTxSecondaryFailure(t *testing.T) {
+	primary := &recordingDriver{name: "primary"}
+	secondary := &recordingDriver{name: "secondary", err: errTestDriver}
+
+	drv := &entx.MultiWriteDriver{Wp: primary, Ws: secondary}
+	ctx := context.Background()
+
+	tx, err := drv.Tx(ctx)
+	require.NoError(t, err)
+
+	err = tx.Exec(ctx, "UPDATE", []any{}, nil)
+	require.ErrorIs(t, err, entx.ErrSecondaryWriteFailed)
+	require.ErrorIs(t, err, errTestDriver)
+
+	require.NoError(t, tx.Rollback())
+	assert.Equal(t, 1, primary.rollbacks)
+	assert.Equal(t, 1, secondary.rollbacks)
+	assert.Zero(t, primary.commits)
+}
+
+func TestMultiWriteTxCommitDivergence(t *testing.T) {
+	primary := &recordingDriver{name: "primary"}
+	secondary := &recordingDriver{name: "secondary", commitErr: errTestDriver}
+
+	var events []entx.DivergenceEvent
+
+	drv := &entx.MultiWriteDriver{
+		Wp: primary,
+		Ws: secondary,
+		OnDivergence: func(_ context.Context, e entx.DivergenceEvent) {
+			events = append(events, e)
+		},
+	}
+	ctx := context.Background()
+
+	tx, err := drv.Tx(ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, tx.Exec(ctx, "INSERT", []any{}, nil))
+	require.NoError(t, tx.Query(ctx, "SELECT", []any{}, nil))
+
+	// the primary committed so the commit succeeds and the divergence is reported instead
+	require.NoError(t, tx.Commit())
+
+	assert.Equal(t, []string{"SELECT"}, primary.queries)
+	assert.Empty(t, secondary.queries)
+	assert.Equal(t, int64(1), drv.Divergences())
+	assert.WithinDuration(t, time.Now(), drv.LastDivergence(), time.Minute)
+	require.Len(t, events, 1)
+	assert.Equal(t, entx.DivergenceStageCommit, events[0].Stage)
+	assert.Equal(t, []string{"INSERT"}, events[0].Queries)
+	assert.ErrorIs(t, events[0].Err, errTestDriver)
+}
+
+func TestMultiWriteTxPrimaryCommitFailure(t *testing.T) {
+	primary := &recordingDriver{name: "primary", commitErr: errTestDriver}
+	secondary := &recordingDriver{name: "secondary"}
+
+	drv := &entx.MultiWriteDriver{Wp: primary, Ws: secondary}
+	ctx := context.Background()
+
+	tx, err := drv.Tx(ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, tx.Exec(ctx, "INSERT", []any{}, nil))
+	require.ErrorIs(t, tx.Commit(), errTestDriver)
+
+	assert.Zero(t, secondary.commits)
+	assert.Equal(t, 1, secondary.rollbacks)
+	assert.Zero(t, drv.Divergences())
+	assert.True(t, drv.LastDivergence().IsZero())
+}
+
+// TestMultiWriteDriverGeneratedClient generates the client of the testdata/multiwrite schema and runs the tests of
+// the testdata/multiwrite package, writing through the driver to two sqlite databases with it, directly and through the outbox
+func TestMultiWriteDriverGeneratedClient(t *testing.T) {
+	if testing.Short() {
+		t.Skip("generates and builds a client")
+	}
+
+	generateClient(t, "multiwrite", []gen.Feature{gen.FeatureUpsert})
+
+	out, err := exec.CommandContext(t.Context(), "go", "test", "./testdata/multiwrite/").CombinedOutput()
+	require.NoError(t, err, string(out))
+}
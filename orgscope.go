@@ -0,0 +1,194 @@
+package entx
+
+import (
+	"context"
+	"fmt"
+
+	"entgo.io/ent/entc/gen"
+	"entgo.io/ent/schema/field"
+	"github.com/rs/zerolog/log"
+	"github.com/theopenlane/iam/auth"
+	"github.com/theopenlane/utils/contextx"
+)
+
+// orgScopeOwnerField is the field holding the organization owning the records of the org owned schemas
+const orgScopeOwnerField = "owner_id"
+
+var orgScopeBypassKey = contextx.NewKey[string]()
+
+// BypassOrgScope returns a new context whose queries and mutations are not scoped to the organization of the caller,
+// e.g. for system jobs working across organizations. The reason is recorded by the auditor of the OrgScope each time
+// the scope is bypassed
+func BypassOrgScope(parent context.Context, reason string) context.Context {
+	return orgScopeBypassKey.Set(parent, reason)
+}
+
+// OrgScopeBypassFromContext returns the reason the org scope of the context is bypassed for
+func OrgScopeBypassFromContext(ctx context.Context) (string, bool) {
+	return orgScopeBypassKey.Get(ctx)
+}
+
+// OrgResolver returns the id of the organization of the caller
+type OrgResolver func(ctx context.Context) (string, error)
+
+// OrgScopeBypass is an operation run without the org scope
+type OrgScopeBypass struct {
+	// Schema of the records
+	Schema string
+	// Operation is the mutation op, or query for the queries
+	Operation string
+	// Reason given to BypassOrgScope
+	Reason string
+}
+
+// OrgScopeAuditor records the operations run without the org scope
+type OrgScopeAuditor func(ctx context.Context, bypass OrgScopeBypass)
+
+// OrgScopeOption configures the OrgScope
+type OrgScopeOption func(*OrgScope)
+
+// WithOrgResolver sets the resolver of the organization of the caller, the organization of the authenticated user by
+// default
+func WithOrgResolver(resolver OrgResolver) OrgScopeOption {
+	return func(s *OrgScope) {
+		if resolver != nil {
+			s.resolver = resolver
+		}
+	}
+}
+
+// WithOrgScopeAuditor sets the auditor of the operations run without the org scope, they are logged by default
+func WithOrgScopeAuditor(auditor OrgScopeAuditor) OrgScopeOption {
+	return func(s *OrgScope) {
+		if auditor != nil {
+			s.auditor = auditor
+		}
+	}
+}
+
+// OrgScope scopes the queries and mutations of the org owned schemas to the organization of the caller, it is
+// registered on the client with the UseOrgScoping method generated with WithOrgScoping
+type OrgScope struct {
+	resolver OrgResolver
+	auditor  OrgScopeAuditor
+}
+
+// NewOrgScope returns an OrgScope configured with the options
+func NewOrgScope(opts ...OrgScopeOption) *OrgScope {
+	s := &OrgScope{
+		resolver: auth.GetOrganizationIDFromContext,
+		auditor:  logOrgScopeBypass,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Organization returns the organization the operation on the schema is scoped to, or reports the scope is bypassed
+// after auditing the bypass
+func (s *OrgScope) Organization(ctx context.Context, schema, operation string) (string, bool, error) {
+	if reason, ok := OrgScopeBypassFromContext(ctx); ok {
+		s.auditor(ctx, OrgScopeBypass{Schema: schema, Operation: operation, Reason: reason})
+
+		return "", true, nil
+	}
+
+	orgID, err := s.resolver(ctx)
+	if err != nil {
+		return "", false, fmt.Errorf("%w: %s %s: %w", ErrMissingOrganization, operation, schema, err)
+	}
+
+	if orgID == "" {
+		return "", false, fmt.Errorf("%w: %s %s", ErrMissingOrganization, operation, schema)
+	}
+
+	return orgID, false, nil
+}
+
+// logOrgScopeBypass is the default OrgScopeAuditor
+func logOrgScopeBypass(_ context.Context, bypass OrgScopeBypass) {
+	log.Info().Str("schema", bypass.Schema).Str("operation", bypass.Operation).Str("reason", bypass.Reason).
+		Msg("org scope bypassed")
+}
+
+// orgScopedNode is an org owned schema
+type orgScopedNode struct {
+	*gen.Type
+
+	// OwnerField holds the organization owning the records
+	OwnerField *gen.Field
+	// SystemOwnedField is set on the schemas with the SystemOwnedSchema annotation, their system owned records are read
+	// by every organization
+	SystemOwnedField *gen.Field
+	// Edges are the edges to other org owned schemas, the records attached must belong to the organization
+	Edges []orgScopedEdge
+}
+
+// orgScopedEdge is an edge between org owned schemas
+type orgScopedEdge struct {
+	*gen.Edge
+
+	// Target is the org owned schema of the edge
+	Target orgScopedNode
+}
+
+// orgScopedNodes returns the org owned schemas with the edges to other org owned schemas
+func orgScopedNodes(nodes []*gen.Type) ([]orgScopedNode, error) {
+	var out []orgScopedNode
+
+	for _, n := range nodes {
+		if !HasAnnotation[OrgOwnedSchema](n) {
+			continue
+		}
+
+		node, err := newOrgScopedNode(n)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range n.Edges {
+			if !HasAnnotation[OrgOwnedSchema](e.Type) || (e.Field() != nil && e.Field().Name == orgScopeOwnerField) {
+				continue
+			}
+
+			target, err := newOrgScopedNode(e.Type)
+			if err != nil {
+				return nil, err
+			}
+
+			node.Edges = append(node.Edges, orgScopedEdge{Edge: e, Target: target})
+		}
+
+		out = append(out, node)
+	}
+
+	return out, nil
+}
+
+// newOrgScopedNode returns the org owned schema, or an error when it has no owner field
+func newOrgScopedNode(n *gen.Type) (orgScopedNode, error) {
+	node := orgScopedNode{Type: n}
+
+	for _, f := range n.Fields {
+		switch f.Name {
+		case orgScopeOwnerField:
+			node.OwnerField = f
+		case exportSystemOwnedField:
+			if f.Type.Type == field.TypeBool && HasAnnotation[SystemOwnedSchema](n) {
+				node.SystemOwnedField = f
+			}
+		}
+	}
+
+	if node.OwnerField == nil || node.OwnerField.Type.Type != field.TypeString {
+		return node, fmt.Errorf("%w: %s is org owned but has no %s string field", ErrInvalidOrgScope, n.Name, orgScopeOwnerField)
+	}
+
+	return node, nil
+}
+
+// OrgScopeTemplate generates the interceptors and hooks scoping the org owned schemas to the organization of the caller
+var OrgScopeTemplate = parseEntxTemplate("org_scope", "templates/org_scope.tmpl")
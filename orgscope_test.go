@@ -0,0 +1,142 @@
+package entx_test
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+
+	"entgo.io/ent"
+	"entgo.io/ent/schema"
+	"entgo.io/ent/schema/edge"
+	"entgo.io/ent/schema/field"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theopenlane/entx"
+	"github.com/theopenlane/entx/mixin"
+)
+
+// Program is org owned and attaches org owned standards
+type Program struct{ ent.Schema }
+
+func (Program) Mixin() []ent.Mixin {
+	return []ent.Mixin{mixin.OrgOwnedMixin{}}
+}
+
+func (Program) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.To("standards", Standard.Type),
+		edge.To("tenant", Tenant.Type).Unique(),
+	}
+}
+
+// Standard is org owned with system owned records
+type Standard struct{ ent.Schema }
+
+func (Standard) Fields() []ent.Field {
+	return []ent.Field{field.Bool("system_owned").Default(false)}
+}
+
+func (Standard) Mixin() []ent.Mixin {
+	return []ent.Mixin{mixin.OrgOwnedMixin{}}
+}
+
+func (Standard) Annotations() []schema.Annotation {
+	return []schema.Annotation{entx.SystemOwnedSchema{}}
+}
+
+// Tenant is not org owned
+type Tenant struct{ ent.Schema }
+
+type unownedOrgOwned struct{ ent.Schema }
+
+func (unownedOrgOwned) Annotations() []schema.Annotation {
+	return []schema.Annotation{entx.OrgOwnedSchema{}}
+}
+
+// orgContextKey holds the organization read by the test resolver
+type orgContextKey struct{}
+
+func TestOrgScopeOrganization(t *testing.T) {
+	var audited []entx.OrgScopeBypass
+
+	s := entx.NewOrgScope(
+		entx.WithOrgResolver(func(ctx context.Context) (string, error) {
+			orgID, _ := ctx.Value(orgContextKey{}).(string)
+			return orgID, nil
+		}),
+		entx.WithOrgScopeAuditor(func(_ context.Context, b entx.OrgScopeBypass) {
+			audited = append(audited, b)
+		}),
+	)
+
+	ctx := context.WithValue(context.Background(), orgContextKey{}, "o1")
+
+	orgID, bypass, err := s.Organization(ctx, "Program", "query")
+	require.NoError(t, err)
+	assert.Equal(t, "o1", orgID)
+	assert.False(t, bypass)
+	assert.Empty(t, audited)
+
+	_, _, err = s.Organization(context.Background(), "Program", "query")
+	assert.ErrorIs(t, err, entx.ErrMissingOrganization)
+
+	ctx = entx.BypassOrgScope(ctx, "nightly sync")
+
+	reason, ok := entx.OrgScopeBypassFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "nightly sync", reason)
+
+	orgID, bypass, err = s.Organization(ctx, "Program", "OpCreate")
+	require.NoError(t, err)
+	assert.Empty(t, orgID)
+	assert.True(t, bypass)
+	assert.Equal(t, []entx.OrgScopeBypass{{Schema: "Program", Operation: "OpCreate", Reason: "nightly sync"}}, audited)
+
+	failing := entx.NewOrgScope(entx.WithOrgResolver(func(context.Context) (string, error) {
+		return "", errors.New("no token")
+	}))
+
+	_, _, err = failing.Organization(context.Background(), "Program", "query")
+	assert.ErrorIs(t, err, entx.ErrMissingOrganization)
+	assert.ErrorContains(t, err, "no token")
+}
+
+func TestOrgScopeTemplate(t *testing.T) {
+	out, err := generateTemplate(t, "org_scope.go", entx.WithOrgScoping(), Program{}, Standard{}, Tenant{})
+	require.NoError(t, err)
+
+	assert.Contains(t, out, `	c.Program.Intercept(InterceptProgramOrgScope(s))
+	c.Program.Use(HookProgramOrgScope(s))
+	c.Standard.Intercept(InterceptStandardOrgScope(s))`)
+	assert.NotContains(t, out, `c.Tenant.`)
+
+	assert.Contains(t, out, `return program.OwnerID(orgID)`)
+	assert.Contains(t, out, `return standard.Or(standard.OwnerID(orgID), standard.SystemOwned(true))`)
+
+	assert.Contains(t, out, `orgID, bypass, err := s.Organization(ctx, "Program", "query")`)
+	assert.Contains(t, out, `mut.SetOwnerID(orgID)`)
+	assert.Contains(t, out, `mut.Where(program.OwnerID(orgID))`)
+
+	// the edges to org owned schemas are checked, the edges to other schemas are not
+	assert.Contains(t, out, `if ids := mut.StandardsIDs(); len(ids) > 0 {`)
+	assert.Contains(t, out, `Where(standard.IDIn(ids...), StandardInOrg(orgID)).`)
+	assert.NotContains(t, out, `mut.TenantIDs()`)
+
+	_, err = generateTemplate(t, "org_scope.go", entx.WithOrgScoping(), unownedOrgOwned{})
+	assert.ErrorIs(t, err, entx.ErrInvalidOrgScope)
+}
+
+// TestOrgScopeGeneratedClient generates the client of the testdata/orgscope schemas and runs the tests of the
+// testdata/orgscope package against it with sqlite, see testdata/orgscope/orgscope_test.go
+func TestOrgScopeGeneratedClient(t *testing.T) {
+	if testing.Short() {
+		t.Skip("generates and builds a client")
+	}
+
+	generateClient(t, "orgscope", nil, entx.WithOrgScoping(), entx.WithTagHelpers())
+
+	out, err := exec.CommandContext(t.Context(), "go", "test", "./testdata/orgscope/").CombinedOutput()
+	require.NoError(t, err, string(out))
+}
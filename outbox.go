@@ -0,0 +1,334 @@
+package entx
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// OutboxEntry is a secondary write recorded for asynchronous replay
+type OutboxEntry struct {
+	// Seq is the monotonically increasing sequence entries are replayed in
+	Seq int64
+	// TxID groups the entries written by a single primary transaction so they are replayed together
+	TxID string
+	// Query is the statement to replay
+	Query string
+	// Args are the statement arguments
+	Args []any
+	// CreatedAt is when the entry was recorded
+	CreatedAt time.Time
+	// Attempts is the number of failed replay attempts
+	Attempts int
+}
+
+// OutboxStats summarizes the entries waiting to be replayed
+type OutboxStats struct {
+	// Pending is the number of entries waiting to be replayed
+	Pending int
+	// Oldest is when the oldest pending entry was recorded, zero when nothing is pending
+	Oldest time.Time
+	// DeadLettered is the number of entries moved out of the replay after failing too many times
+	DeadLettered int
+}
+
+// Outbox durably records secondary writes until they are replayed
+type Outbox interface {
+	// Append records the entries of a single transaction, in order
+	Append(ctx context.Context, entries ...OutboxEntry) error
+	// Peek returns the entries of up to limit of the oldest transactions, in sequence order
+	Peek(ctx context.Context, limit int) ([]OutboxEntry, error)
+	// Ack removes the entries of the transaction after they were replayed
+	Ack(ctx context.Context, txID string) error
+	// MarkFailed records a failed replay attempt for the transaction
+	MarkFailed(ctx context.Context, txID string, cause error) error
+	// DeadLetter moves the entries of the transaction out of the replay after they failed too many times, they are
+	// kept for inspection
+	DeadLetter(ctx context.Context, txID string, cause error) error
+	// Stats returns the pending entry stats
+	Stats(ctx context.Context) (OutboxStats, error)
+}
+
+const sqliteOutboxSchema = `CREATE TABLE IF NOT EXISTS entx_outbox (
+	seq INTEGER PRIMARY KEY AUTOINCREMENT,
+	txid TEXT NOT NULL,
+	query TEXT NOT NULL,
+	args TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT
+)`
+
+const sqliteOutboxDeadLetterSchema = `CREATE TABLE IF NOT EXISTS entx_outbox_dead_letter (
+	seq INTEGER PRIMARY KEY,
+	txid TEXT NOT NULL,
+	query TEXT NOT NULL,
+	args TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	attempts INTEGER NOT NULL,
+	last_error TEXT
+)`
+
+// SQLiteOutbox is an Outbox stored in a local SQLite database, e.g. a file next to the service,
+// so secondary writes survive restarts while the secondary is unavailable
+type SQLiteOutbox struct {
+	db *sql.DB
+	// mu serializes access since SQLite allows a single writer
+	mu sync.Mutex
+}
+
+var _ Outbox = (*SQLiteOutbox)(nil)
+
+// NewSQLiteOutbox creates the outbox and dead letter tables, if needed, in the SQLite database. The caller registers
+// the SQLite driver and owns the database handle
+func NewSQLiteOutbox(ctx context.Context, db *sql.DB) (*SQLiteOutbox, error) {
+	for _, schema := range []string{sqliteOutboxSchema, sqliteOutboxDeadLetterSchema} {
+		if _, err := db.ExecContext(ctx, schema); err != nil {
+			return nil, fmt.Errorf("failed creating outbox table: %w", err)
+		}
+	}
+
+	return &SQLiteOutbox{db: db}, nil
+}
+
+// Append records the entries of a single transaction, in order
+func (o *SQLiteOutbox) Append(ctx context.Context, entries ...OutboxEntry) (err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	tx, err := o.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	for _, e := range entries {
+		args, err := encodeOutboxArgs(e.Args)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO entx_outbox (txid, query, args, created_at) VALUES (?, ?, ?, ?)",
+			e.TxID, e.Query, args, e.CreatedAt.UnixNano(),
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Peek returns the entries of up to limit of the oldest transactions, in sequence order
+func (o *SQLiteOutbox) Peek(ctx context.Context, limit int) ([]OutboxEntry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	rows, err := o.db.QueryContext(ctx, `SELECT seq, txid, query, args, created_at, attempts FROM entx_outbox
+		WHERE txid IN (SELECT txid FROM entx_outbox GROUP BY txid ORDER BY MIN(seq) LIMIT ?)
+		ORDER BY seq`, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var entries []OutboxEntry
+
+	for rows.Next() {
+		var (
+			e         OutboxEntry
+			args      string
+			createdAt int64
+		)
+
+		if err := rows.Scan(&e.Seq, &e.TxID, &e.Query, &args, &createdAt, &e.Attempts); err != nil {
+			return nil, err
+		}
+
+		if e.Args, err = decodeOutboxArgs(args); err != nil {
+			return nil, err
+		}
+
+		e.CreatedAt = time.Unix(0, createdAt)
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// Ack removes the entries of the transaction after they were replayed
+func (o *SQLiteOutbox) Ack(ctx context.Context, txID string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	_, err := o.db.ExecContext(ctx, "DELETE FROM entx_outbox WHERE txid = ?", txID)
+
+	return err
+}
+
+// MarkFailed records a failed replay attempt for the transaction
+func (o *SQLiteOutbox) MarkFailed(ctx context.Context, txID string, cause error) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	_, err := o.db.ExecContext(ctx,
+		"UPDATE entx_outbox SET attempts = attempts + 1, last_error = ? WHERE txid = ?",
+		cause.Error(), txID)
+
+	return err
+}
+
+// DeadLetter moves the entries of the transaction to the dead letter table
+func (o *SQLiteOutbox) DeadLetter(ctx context.Context, txID string, cause error) (err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	tx, err := o.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO entx_outbox_dead_letter (seq, txid, query, args, created_at, attempts, last_error)
+		SELECT seq, txid, query, args, created_at, attempts, ? FROM entx_outbox WHERE txid = ?`,
+		cause.Error(), txID); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM entx_outbox WHERE txid = ?", txID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Stats returns the pending entry stats
+func (o *SQLiteOutbox) Stats(ctx context.Context) (OutboxStats, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var (
+		stats  OutboxStats
+		oldest sql.NullInt64
+	)
+
+	if err := o.db.QueryRowContext(ctx, `SELECT COUNT(*), MIN(created_at),
+		(SELECT COUNT(*) FROM entx_outbox_dead_letter) FROM entx_outbox`).
+		Scan(&stats.Pending, &oldest, &stats.DeadLettered); err != nil {
+		return stats, err
+	}
+
+	if oldest.Valid {
+		stats.Oldest = time.Unix(0, oldest.Int64)
+	}
+
+	return stats, nil
+}
+
+// outboxArg is the type-tagged encoding of a statement argument
+type outboxArg struct {
+	// T is the argument type: n(il), s(tring), i(nt64), f(loat64), b(ool), x (bytes) or t(ime)
+	T string `json:"t"`
+	// V is the string encoded value
+	V string `json:"v,omitempty"`
+}
+
+// encodeOutboxArgs encodes the statement arguments, preserving their driver types
+func encodeOutboxArgs(args []any) (string, error) {
+	encoded := make([]outboxArg, 0, len(args))
+
+	for _, a := range args {
+		v, err := driver.DefaultParameterConverter.ConvertValue(a)
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", ErrOutboxArgument, err)
+		}
+
+		var arg outboxArg
+
+		switch v := v.(type) {
+		case nil:
+			arg = outboxArg{T: "n"}
+		case string:
+			arg = outboxArg{T: "s", V: v}
+		case int64:
+			arg = outboxArg{T: "i", V: strconv.FormatInt(v, 10)}
+		case float64:
+			arg = outboxArg{T: "f", V: strconv.FormatFloat(v, 'g', -1, 64)}
+		case bool:
+			arg = outboxArg{T: "b", V: strconv.FormatBool(v)}
+		case []byte:
+			arg = outboxArg{T: "x", V: base64.StdEncoding.EncodeToString(v)}
+		case time.Time:
+			arg = outboxArg{T: "t", V: v.Format(time.RFC3339Nano)}
+		default:
+			return "", fmt.Errorf("%w: %T", ErrOutboxArgument, v)
+		}
+
+		encoded = append(encoded, arg)
+	}
+
+	out, err := json.Marshal(encoded)
+
+	return string(out), err
+}
+
+// decodeOutboxArgs decodes statement arguments encoded by encodeOutboxArgs
+func decodeOutboxArgs(s string) ([]any, error) {
+	var encoded []outboxArg
+	if err := json.Unmarshal([]byte(s), &encoded); err != nil {
+		return nil, err
+	}
+
+	args := make([]any, 0, len(encoded))
+
+	for _, a := range encoded {
+		var (
+			v   any
+			err error
+		)
+
+		switch a.T {
+		case "n":
+			v = nil
+		case "s":
+			v = a.V
+		case "i":
+			v, err = strconv.ParseInt(a.V, 10, 64)
+		case "f":
+			v, err = strconv.ParseFloat(a.V, 64)
+		case "b":
+			v, err = strconv.ParseBool(a.V)
+		case "x":
+			v, err = base64.StdEncoding.DecodeString(a.V)
+		case "t":
+			v, err = time.Parse(time.RFC3339Nano, a.V)
+		default:
+			err = fmt.Errorf("%w: unknown type %q", ErrOutboxArgument, a.T)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, v)
+	}
+
+	return args, nil
+}
@@ -0,0 +1,195 @@
+package entx
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+
+	"entgo.io/ent/schema"
+)
+
+// AnnotationDecoder decodes the raw value of an annotation into the target, a pointer to the annotation
+type AnnotationDecoder func(raw any, target any) error
+
+// registeredAnnotation is an annotation of the registry
+type registeredAnnotation struct {
+	// typ is the annotation type, never a pointer
+	typ reflect.Type
+	// decode decodes the raw value into a pointer to typ
+	decode AnnotationDecoder
+}
+
+// annotationRegistry holds the annotations GetAnnotation decodes by name
+var annotationRegistry = struct {
+	sync.RWMutex
+
+	annotations map[string]registeredAnnotation
+}{
+	annotations: map[string]registeredAnnotation{},
+}
+
+// the entx annotations, registered once so they are decoded the same way wherever they are read
+var (
+	_ = MustRegisterAnnotation[CascadeAnnotation]()
+	_ = MustRegisterAnnotation[CascadeThroughAnnotation]()
+	_ = MustRegisterAnnotation[RetentionAnnotation]()
+	_ = MustRegisterAnnotation[SchemaGenAnnotation]()
+	_ = MustRegisterAnnotation[QueryGenAnnotation]()
+	_ = MustRegisterAnnotation[SearchFieldAnnotation]()
+	_ = MustRegisterAnnotation[WorkflowEligibleAnnotation]()
+	_ = MustRegisterAnnotation[TaskRuleAnnotation]()
+	_ = MustRegisterAnnotation[WebhookPayloadFieldAnnotation]()
+	_ = MustRegisterAnnotation[CSVReferenceAnnotation]()
+	_ = MustRegisterAnnotation[IntegrationMappingFieldAnnotation]()
+	_ = MustRegisterAnnotation[IntegrationMappingSchemaAnnotation]()
+	_ = MustRegisterAnnotation[FileCategoryAnnotation]()
+	_ = MustRegisterAnnotation[ConsoleRouteAnnotation]()
+	_ = MustRegisterAnnotation[DisplayNameAnnotation]()
+	_ = MustRegisterAnnotation[MentionSourceAnnotation]()
+	_ = MustRegisterAnnotation[ApprovalStatusAnnotation]()
+	_ = MustRegisterAnnotation[ApprovalApproverAnnotation]()
+	_ = MustRegisterAnnotation[EncryptedFieldAnnotation]()
+	_ = MustRegisterAnnotation[TagsAnnotation]()
+	_ = MustRegisterAnnotation[FGACrudAnnotation]()
+	_ = MustRegisterAnnotation[FGAParentCrudAnnotation]()
+	_ = MustRegisterAnnotation[GroupPermissionsEnabled]()
+	_ = MustRegisterAnnotation[OrgOwnedSchema]()
+	_ = MustRegisterAnnotation[SystemOwnedSchema]()
+	_ = MustRegisterAnnotation[Exportable]()
+)
+
+// RegisterAnnotation registers the annotation type under its name so GetAnnotation, HasAnnotation and
+// LookupAnnotation decode it, e.g. RegisterAnnotation[MyAnnotation](). The annotation is decoded with
+// DecodeAnnotation, or with its Decode method when it is a DecodableAnnotation, unless a decoder is given. Registering a name again
+// with the same type replaces the decoder, registering it with another type returns ErrAnnotationRegistered
+func RegisterAnnotation[T schema.Annotation](decoder ...AnnotationDecoder) error {
+	typ := annotationType[T]()
+	name := annotationName[T]()
+
+	decode := defaultAnnotationDecoder(typ)
+	if len(decoder) > 0 && decoder[0] != nil {
+		decode = decoder[0]
+	}
+
+	annotationRegistry.Lock()
+	defer annotationRegistry.Unlock()
+
+	if existing, ok := annotationRegistry.annotations[name]; ok && existing.typ != typ {
+		return fmt.Errorf("%w: %s is registered as %s", ErrAnnotationRegistered, name, existing.typ)
+	}
+
+	annotationRegistry.annotations[name] = registeredAnnotation{typ: typ, decode: decode}
+
+	return nil
+}
+
+// MustRegisterAnnotation registers the annotation like RegisterAnnotation and panics when it cannot be registered,
+// it returns the name of the annotation so it can be used in package variable declarations
+func MustRegisterAnnotation[T schema.Annotation](decoder ...AnnotationDecoder) string {
+	if err := RegisterAnnotation[T](decoder...); err != nil {
+		panic(err)
+	}
+
+	return annotationName[T]()
+}
+
+// RegisteredAnnotations returns the names of the registered annotations, sorted
+func RegisteredAnnotations() []string {
+	annotationRegistry.RLock()
+	defer annotationRegistry.RUnlock()
+
+	names := make([]string, 0, len(annotationRegistry.annotations))
+	for name := range annotationRegistry.annotations {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// DecodeRegisteredAnnotation decodes the raw value of the registered annotation with the name and returns a pointer
+// to the annotation, e.g. a *SearchFieldAnnotation for SearchFieldAnnotationName
+func DecodeRegisteredAnnotation(name string, raw any) (any, error) {
+	annotationRegistry.RLock()
+	entry, ok := annotationRegistry.annotations[name]
+	annotationRegistry.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrAnnotationNotRegistered, name)
+	}
+
+	target := reflect.New(entry.typ)
+	if err := entry.decode(raw, target.Interface()); err != nil {
+		return nil, fmt.Errorf("failed decoding annotation %s: %w", name, err)
+	}
+
+	return target.Interface(), nil
+}
+
+// decodeAnnotationAs decodes the raw value of an annotation into T, which can be the annotation type or a pointer
+// to it. Registered annotations use their registered decoder, the others the default decoder of their type
+func decodeAnnotationAs[T schema.Annotation](name string, raw any) (T, error) {
+	var out T
+
+	// the annotation was not serialized, e.g. a schema annotation read before code generation
+	if v, ok := raw.(T); ok {
+		return v, nil
+	}
+
+	typ := annotationType[T]()
+
+	decode := defaultAnnotationDecoder(typ)
+
+	annotationRegistry.RLock()
+	if entry, ok := annotationRegistry.annotations[name]; ok && entry.typ == typ {
+		decode = entry.decode
+	}
+	annotationRegistry.RUnlock()
+
+	target := reflect.New(typ)
+	if err := decode(raw, target.Interface()); err != nil {
+		return out, err
+	}
+
+	if reflect.TypeFor[T]().Kind() == reflect.Pointer {
+		return target.Interface().(T), nil
+	}
+
+	return target.Elem().Interface().(T), nil
+}
+
+// defaultAnnotationDecoder returns DecodeAnnotation, or the Decode method of the annotation type when it is a
+// DecodableAnnotation
+func defaultAnnotationDecoder(typ reflect.Type) AnnotationDecoder {
+	if !reflect.PointerTo(typ).Implements(reflect.TypeFor[DecodableAnnotation]()) {
+		return DecodeAnnotation
+	}
+
+	return func(raw any, target any) error {
+		return target.(DecodableAnnotation).Decode(raw)
+	}
+}
+
+// annotationType returns the annotation type of T, the element type when T is a pointer
+func annotationType[T schema.Annotation]() reflect.Type {
+	typ := reflect.TypeFor[T]()
+	if typ.Kind() == reflect.Pointer {
+		return typ.Elem()
+	}
+
+	return typ
+}
+
+// annotationName returns the name of the annotation T, allocating it when T is a pointer so methods with a value
+// receiver can be called
+func annotationName[T schema.Annotation]() string {
+	var ant T
+
+	if typ := reflect.TypeFor[T](); typ.Kind() == reflect.Pointer {
+		ant = reflect.New(typ.Elem()).Interface().(T)
+	}
+
+	return ant.Name()
+}
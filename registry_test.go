@@ -0,0 +1,167 @@
+package entx
+
+import (
+	"strings"
+	"testing"
+
+	"entgo.io/ent/entc/gen"
+	"entgo.io/ent/entc/load"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// thirdPartyAnnotation is an annotation registered outside of entx
+type thirdPartyAnnotation struct {
+	Value string
+}
+
+func (thirdPartyAnnotation) Name() string {
+	return "THIRD_PARTY"
+}
+
+// conflictingAnnotation has the name of thirdPartyAnnotation
+type conflictingAnnotation struct{}
+
+func (conflictingAnnotation) Name() string {
+	return "THIRD_PARTY"
+}
+
+// customDecodeAnnotation decodes itself
+type customDecodeAnnotation struct {
+	Value string
+}
+
+func (customDecodeAnnotation) Name() string {
+	return "CUSTOM_DECODE"
+}
+
+func (a *customDecodeAnnotation) Decode(_ any) error {
+	a.Value = "custom"
+	return nil
+}
+
+func TestGetAnnotationMarkers(t *testing.T) {
+	f := &gen.Field{
+		Annotations: gen.Annotations{
+			DisplayNameAnnotationName: map[string]any{},
+		},
+	}
+
+	ant, ok := GetAnnotation[DisplayNameAnnotation](f)
+	assert.True(t, ok)
+	assert.Equal(t, DisplayNameAnnotation{}, ant)
+
+	ptr, ok := GetAnnotation[*DisplayNameAnnotation](f)
+	assert.True(t, ok)
+	assert.Equal(t, &DisplayNameAnnotation{}, ptr)
+
+	assert.True(t, HasAnnotation[*DisplayNameAnnotation](f))
+	assert.False(t, HasAnnotation[MentionSourceAnnotation](f))
+
+	_, ok = GetAnnotation[MentionSourceAnnotation](f)
+	assert.False(t, ok)
+
+	// annotations that were not serialized are returned as is
+	owned, ok := GetAnnotation[OrgOwnedSchema](&load.Schema{Annotations: map[string]any{OrgOwnedSchemaName: OrgOwnedSchema{}}})
+	assert.True(t, ok)
+	assert.Equal(t, OrgOwnedSchema{}, owned)
+}
+
+func TestGetAnnotationHolders(t *testing.T) {
+	raw := map[string]any{SearchFieldAnnotationName: map[string]any{"Searchable": true}}
+	expected := &SearchFieldAnnotation{Searchable: true}
+
+	holders := map[string]any{
+		"gen.Type":    &gen.Type{Annotations: raw},
+		"gen.Field":   &gen.Field{Annotations: raw},
+		"gen.Edge":    &gen.Edge{Annotations: raw},
+		"load.Schema": &load.Schema{Annotations: raw},
+		"load.Field":  &load.Field{Annotations: raw},
+		"load.Edge":   &load.Edge{Annotations: raw},
+		"annotations": gen.Annotations(raw),
+	}
+
+	for name, holder := range holders {
+		t.Run(name, func(t *testing.T) {
+			ant, ok := GetAnnotation[*SearchFieldAnnotation](holder)
+			assert.True(t, ok)
+			assert.Equal(t, expected, ant)
+
+			value, ok := GetAnnotation[SearchFieldAnnotation](holder)
+			assert.True(t, ok)
+			assert.Equal(t, *expected, value)
+		})
+	}
+
+	_, ok := GetAnnotation[*SearchFieldAnnotation]("not a holder")
+	assert.False(t, ok)
+}
+
+func TestLookupAnnotation(t *testing.T) {
+	ants := gen.Annotations{RetentionAnnotationName: map[string]any{"Window": "not a duration"}}
+
+	_, ok, err := LookupAnnotation[*RetentionAnnotation](ants)
+	assert.False(t, ok)
+	assert.Error(t, err)
+
+	_, ok = GetAnnotation[*RetentionAnnotation](ants)
+	assert.False(t, ok)
+
+	_, ok, err = LookupAnnotation[*CascadeAnnotation](ants)
+	assert.False(t, ok)
+	assert.NoError(t, err)
+}
+
+func TestRegisterAnnotation(t *testing.T) {
+	require.NoError(t, RegisterAnnotation[thirdPartyAnnotation]())
+	assert.Contains(t, RegisteredAnnotations(), "THIRD_PARTY")
+	assert.Contains(t, RegisteredAnnotations(), DisplayNameAnnotationName)
+	assert.Contains(t, RegisteredAnnotations(), "Exportable")
+
+	ants := gen.Annotations{"THIRD_PARTY": map[string]any{"Value": "raw"}}
+
+	ant, ok := GetAnnotation[*thirdPartyAnnotation](ants)
+	assert.True(t, ok)
+	assert.Equal(t, &thirdPartyAnnotation{Value: "raw"}, ant)
+
+	decoded, err := DecodeRegisteredAnnotation("THIRD_PARTY", ants["THIRD_PARTY"])
+	require.NoError(t, err)
+	assert.Equal(t, &thirdPartyAnnotation{Value: "raw"}, decoded)
+
+	// registering the type again replaces its decoder
+	require.NoError(t, RegisterAnnotation[*thirdPartyAnnotation](func(raw any, target any) error {
+		if err := DecodeAnnotation(raw, target); err != nil {
+			return err
+		}
+
+		a := target.(*thirdPartyAnnotation)
+		a.Value = strings.ToUpper(a.Value)
+
+		return nil
+	}))
+
+	value, ok := GetAnnotation[thirdPartyAnnotation](ants)
+	assert.True(t, ok)
+	assert.Equal(t, thirdPartyAnnotation{Value: "RAW"}, value)
+
+	err = RegisterAnnotation[conflictingAnnotation]()
+	assert.ErrorIs(t, err, ErrAnnotationRegistered)
+
+	assert.PanicsWithError(t, err.Error(), func() { MustRegisterAnnotation[conflictingAnnotation]() })
+
+	_, err = DecodeRegisteredAnnotation("UNKNOWN", nil)
+	assert.ErrorIs(t, err, ErrAnnotationNotRegistered)
+
+	// the annotations with a Decode method are decoded with it instead of DecodeAnnotation
+	custom := gen.Annotations{"CUSTOM_DECODE": map[string]any{"Value": "raw"}}
+
+	decodable, ok := GetAnnotation[customDecodeAnnotation](custom)
+	assert.True(t, ok)
+	assert.Equal(t, customDecodeAnnotation{Value: "custom"}, decodable)
+
+	require.NoError(t, RegisterAnnotation[customDecodeAnnotation]())
+
+	decoded, err = DecodeRegisteredAnnotation("CUSTOM_DECODE", custom["CUSTOM_DECODE"])
+	require.NoError(t, err)
+	assert.Equal(t, &customDecodeAnnotation{Value: "custom"}, decoded)
+}
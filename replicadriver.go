@@ -0,0 +1,155 @@
+package entx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync/atomic"
+
+	"entgo.io/ent/dialect"
+	"github.com/theopenlane/utils/contextx"
+)
+
+// ReplicaSelection is the strategy used by the ReplicaDriver to pick a replica for reads
+type ReplicaSelection string
+
+const (
+	// ReplicaSelectionRoundRobin cycles through the replicas in order
+	ReplicaSelectionRoundRobin ReplicaSelection = "roundrobin"
+	// ReplicaSelectionLeastLoaded picks the replica with the fewest in-use connections
+	ReplicaSelectionLeastLoaded ReplicaSelection = "leastloaded"
+)
+
+var primaryReadKey = contextx.NewKey[bool]()
+
+// ReadFromPrimary returns a new context that forces the ReplicaDriver to send reads to the primary,
+// e.g. right after a write when replication lag would otherwise return stale results
+func ReadFromPrimary(parent context.Context) context.Context {
+	return primaryReadKey.Set(parent, true)
+}
+
+// CheckReadFromPrimary checks whether reads were forced to the primary
+func CheckReadFromPrimary(ctx context.Context) bool {
+	primary, _ := primaryReadKey.Get(ctx)
+	return primary
+}
+
+// ParseReplicaSelection returns the ReplicaSelection for the given name, defaulting to round robin when empty
+func ParseReplicaSelection(s string) (ReplicaSelection, error) {
+	switch ReplicaSelection(s) {
+	case "", ReplicaSelectionRoundRobin:
+		return ReplicaSelectionRoundRobin, nil
+	case ReplicaSelectionLeastLoaded:
+		return ReplicaSelectionLeastLoaded, nil
+	default:
+		return "", newReplicaSelectionError(s)
+	}
+}
+
+// ReplicaDriver sends writes and transactions to the primary database and spreads reads across replicas
+type ReplicaDriver struct {
+	// Primary handles all Exec calls, transactions, and reads forced to the primary
+	Primary dialect.Driver
+	// Replicas serve Query calls
+	Replicas []dialect.Driver
+	// Selection is the strategy used to pick a replica for each read
+	Selection ReplicaSelection
+
+	next atomic.Uint64
+}
+
+var _ dialect.Driver = (*ReplicaDriver)(nil)
+
+// NewReplicaDriver returns a ReplicaDriver for the primary and replicas using the provided selection strategy
+func NewReplicaDriver(primary dialect.Driver, replicas []dialect.Driver, selection ReplicaSelection) *ReplicaDriver {
+	return &ReplicaDriver{
+		Primary:   primary,
+		Replicas:  replicas,
+		Selection: selection,
+	}
+}
+
+// Query sends the query to a replica, or to the primary when no replicas are configured
+// or the context was created with ReadFromPrimary
+func (d *ReplicaDriver) Query(ctx context.Context, query string, args, v any) error {
+	return d.reader(ctx).Query(ctx, query, args, v)
+}
+
+// Exec calls the underlying primary driver Exec method
+func (d *ReplicaDriver) Exec(ctx context.Context, query string, args, v any) error {
+	return d.Primary.Exec(ctx, query, args, v)
+}
+
+// Tx starts a transaction on the primary; reads inside the transaction are not sent to replicas
+func (d *ReplicaDriver) Tx(ctx context.Context) (dialect.Tx, error) {
+	return d.Primary.Tx(ctx)
+}
+
+// BeginTx calls the underlying primary driver BeginTx command if it is supported and falls back to Tx otherwise
+func (d *ReplicaDriver) BeginTx(ctx context.Context, opts *sql.TxOptions) (dialect.Tx, error) {
+	if b, ok := d.Primary.(interface {
+		BeginTx(context.Context, *sql.TxOptions) (dialect.Tx, error)
+	}); ok {
+		return b.BeginTx(ctx, opts)
+	}
+
+	return d.Primary.Tx(ctx)
+}
+
+// Close the replica and primary connections
+func (d *ReplicaDriver) Close() error {
+	errs := make([]error, 0, len(d.Replicas)+1)
+
+	for _, r := range d.Replicas {
+		errs = append(errs, r.Close())
+	}
+
+	errs = append(errs, d.Primary.Close())
+
+	return errors.Join(errs...)
+}
+
+// Dialect returns the dialect name of the primary driver
+func (d *ReplicaDriver) Dialect() string {
+	return d.Primary.Dialect()
+}
+
+// reader returns the driver that should serve a read for the context
+func (d *ReplicaDriver) reader(ctx context.Context) dialect.Driver {
+	if len(d.Replicas) == 0 || CheckReadFromPrimary(ctx) {
+		return d.Primary
+	}
+
+	if d.Selection == ReplicaSelectionLeastLoaded {
+		if r, ok := d.leastLoaded(); ok {
+			return r
+		}
+	}
+
+	n := d.next.Add(1) - 1
+
+	return d.Replicas[n%uint64(len(d.Replicas))]
+}
+
+// leastLoaded returns the replica with the fewest in-use connections; replicas that do not
+// expose their *sql.DB cannot be compared, so it reports false if any are present
+func (d *ReplicaDriver) leastLoaded() (dialect.Driver, bool) {
+	var (
+		best   dialect.Driver
+		bestIn = -1
+	)
+
+	for _, r := range d.Replicas {
+		db, ok := r.(interface{ DB() *sql.DB })
+		if !ok {
+			return nil, false
+		}
+
+		inUse := db.DB().Stats().InUse
+		if bestIn == -1 || inUse < bestIn {
+			best, bestIn = r, inUse
+		}
+	}
+
+	return best, best != nil
+}
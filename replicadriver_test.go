@@ -0,0 +1,198 @@
+package entx_test
+
+import (
+	"context"
+	"testing"
+
+	"entgo.io/ent/dialect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theopenlane/entx"
+)
+
+// recordingDriver is a dialect.Driver that records the statements it receives
+type recordingDriver struct {
+	name      string
+	queries   []string
+	execs     []string
+	txs       int
+	commits   int
+	rollbacks int
+	closed    bool
+	err       error
+	commitErr error
+}
+
+func (d *recordingDriver) Exec(_ context.Context, query string, _, _ any) error {
+	d.execs = append(d.execs, query)
+	return d.err
+}
+
+func (d *recordingDriver) Query(_ context.Context, query string, _, _ any) error {
+	d.queries = append(d.queries, query)
+	return d.err
+}
+
+func (d *recordingDriver) Tx(_ context.Context) (dialect.Tx, error) {
+	d.txs++
+	return &recordingTx{recordingDriver: d}, nil
+}
+
+func (d *recordingDriver) Close() error {
+	d.closed = true
+	return nil
+}
+
+func (d *recordingDriver) Dialect() string {
+	return dialect.Postgres
+}
+
+// recordingTx is a dialect.Tx that records commits and rollbacks on its driver
+type recordingTx struct {
+	*recordingDriver
+}
+
+func (tx *recordingTx) Commit() error {
+	tx.commits++
+	return tx.commitErr
+}
+
+func (tx *recordingTx) Rollback() error {
+	tx.rollbacks++
+	return nil
+}
+
+func TestReplicaDriverRoundRobin(t *testing.T) {
+	primary := &recordingDriver{name: "primary"}
+	r1 := &recordingDriver{name: "r1"}
+	r2 := &recordingDriver{name: "r2"}
+
+	drv := entx.NewReplicaDriver(primary, []dialect.Driver{r1, r2}, entx.ReplicaSelectionRoundRobin)
+	ctx := context.Background()
+
+	for range 4 {
+		require.NoError(t, drv.Query(ctx, "SELECT 1", []any{}, nil))
+	}
+
+	assert.Len(t, r1.queries, 2)
+	assert.Len(t, r2.queries, 2)
+	assert.Empty(t, primary.queries)
+
+	require.NoError(t, drv.Exec(ctx, "INSERT", []any{}, nil))
+	_, err := drv.Tx(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"INSERT"}, primary.execs)
+	assert.Equal(t, 1, primary.txs)
+	assert.Empty(t, r1.execs)
+	assert.Empty(t, r2.execs)
+	assert.Equal(t, dialect.Postgres, drv.Dialect())
+
+	require.NoError(t, drv.Close())
+	assert.True(t, primary.closed)
+	assert.True(t, r1.closed)
+	assert.True(t, r2.closed)
+}
+
+func TestReplicaDriverReadFromPrimary(t *testing.T) {
+	primary := &recordingDriver{name: "primary"}
+	replica := &recordingDriver{name: "replica"}
+
+	drv := entx.NewReplicaDriver(primary, []dialect.Driver{replica}, entx.ReplicaSelectionRoundRobin)
+
+	ctx := entx.ReadFromPrimary(context.Background())
+	require.NoError(t, drv.Query(ctx, "SELECT 1", []any{}, nil))
+
+	assert.Len(t, primary.queries, 1)
+	assert.Empty(t, replica.queries)
+	assert.True(t, entx.CheckReadFromPrimary(ctx))
+	assert.False(t, entx.CheckReadFromPrimary(context.Background()))
+}
+
+func TestReplicaDriverNoReplicas(t *testing.T) {
+	primary := &recordingDriver{name: "primary"}
+
+	drv := entx.NewReplicaDriver(primary, nil, entx.ReplicaSelectionLeastLoaded)
+	require.NoError(t, drv.Query(context.Background(), "SELECT 1", []any{}, nil))
+
+	assert.Len(t, primary.queries, 1)
+}
+
+func TestReplicaDriverLeastLoadedFallback(t *testing.T) {
+	primary := &recordingDriver{name: "primary"}
+	r1 := &recordingDriver{name: "r1"}
+	r2 := &recordingDriver{name: "r2"}
+
+	// the recording replicas do not expose connection stats, so selection falls back to round robin
+	drv := entx.NewReplicaDriver(primary, []dialect.Driver{r1, r2}, entx.ReplicaSelectionLeastLoaded)
+
+	for range 2 {
+		require.NoError(t, drv.Query(context.Background(), "SELECT 1", []any{}, nil))
+	}
+
+	assert.Len(t, r1.queries, 1)
+	assert.Len(t, r2.queries, 1)
+}
+
+func TestReplicaDriverBeginTx(t *testing.T) {
+	primary := &recordingDriver{name: "primary"}
+	replica := &recordingDriver{name: "replica"}
+
+	drv := entx.NewReplicaDriver(primary, []dialect.Driver{replica}, entx.ReplicaSelectionRoundRobin)
+
+	// the recording primary has no BeginTx, the transaction is started with Tx
+	tx, err := drv.BeginTx(context.Background(), nil)
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+
+	assert.Equal(t, 1, primary.txs)
+	assert.Equal(t, 1, primary.commits)
+	assert.Zero(t, replica.txs)
+}
+
+func TestParseReplicaSelection(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected entx.ReplicaSelection
+		errorMsg string
+	}{
+		{
+			name:     "default",
+			input:    "",
+			expected: entx.ReplicaSelectionRoundRobin,
+		},
+		{
+			name:     "round robin",
+			input:    "roundrobin",
+			expected: entx.ReplicaSelectionRoundRobin,
+		},
+		{
+			name:     "least loaded",
+			input:    "leastloaded",
+			expected: entx.ReplicaSelectionLeastLoaded,
+		},
+		{
+			name:     "unsupported",
+			input:    "random",
+			errorMsg: "unsupported replica selection: random",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			selection, err := entx.ParseReplicaSelection(tc.input)
+
+			if tc.errorMsg != "" {
+				assert.ErrorIs(t, err, entx.ErrUnsupportedReplicaSelection)
+				assert.ErrorContains(t, err, tc.errorMsg)
+
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, selection)
+		})
+	}
+}
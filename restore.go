@@ -0,0 +1,212 @@
+package entx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"entgo.io/ent/entc/gen"
+)
+
+const (
+	// softDeleteByField is the field holding who soft deleted the record, see mixin.SoftDeleteMixin
+	softDeleteByField = "deleted_by"
+	// softDeleteOpField is the field holding the id of the soft delete operation, see mixin.SoftDeleteMixin
+	softDeleteOpField = "deleted_op_id"
+)
+
+// RestoreRecords are the ids of the records restored for a schema
+type RestoreRecords struct {
+	// Schema of the restored records
+	Schema string
+	// IDs of the restored records
+	IDs []any
+}
+
+// RestorePlan collects the records restored with a soft deleted record by the generated Restore methods, the
+// unique conflicts of all records are checked before anything is restored so a restore is never partially applied
+type RestorePlan struct {
+	seen      map[string]bool
+	records   []RestoreRecords
+	conflicts []error
+	steps     []func(context.Context) error
+}
+
+// NewRestorePlan returns an empty restore plan
+func NewRestorePlan() *RestorePlan {
+	return &RestorePlan{
+		seen: map[string]bool{},
+	}
+}
+
+// Visit reports whether the record is not in the plan yet and adds it, so cascades looping back to a restored
+// schema do not restore the same record twice
+func (p *RestorePlan) Visit(schema string, id any) bool {
+	key := fmt.Sprintf("%s:%v", schema, id)
+	if p.seen[key] {
+		return false
+	}
+
+	p.seen[key] = true
+
+	return true
+}
+
+// Conflict records that the restored record conflicts with an active record on the unique fields
+func (p *RestorePlan) Conflict(schema string, id any, fields ...string) {
+	p.conflicts = append(p.conflicts, &RestoreConflictError{Schema: schema, ID: id, Fields: fields})
+}
+
+// Add adds the restore of the records of the schema to the plan, restores run in the order they are added
+func (p *RestorePlan) Add(schema string, ids []any, restore func(context.Context) error) {
+	p.records = append(p.records, RestoreRecords{Schema: schema, IDs: ids})
+	p.steps = append(p.steps, restore)
+}
+
+// Records returns the records restored by the plan, in order
+func (p *RestorePlan) Records() []RestoreRecords {
+	return p.records
+}
+
+// Err returns the conflicts of the plan joined, nil when the plan can be run
+func (p *RestorePlan) Err() error {
+	return errors.Join(p.conflicts...)
+}
+
+// Run restores the records of the plan, nothing is restored when the plan has conflicts
+func (p *RestorePlan) Run(ctx context.Context) error {
+	if err := p.Err(); err != nil {
+		return err
+	}
+
+	for _, step := range p.steps {
+		if err := step(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isRestorable reports whether the schema records the soft delete operation, which the restore needs to find the
+// records soft deleted in the same cascade
+func isRestorable(n *gen.Type) bool {
+	if f := softDeleteFieldOf(n); f == nil || !f.Optional {
+		return false
+	}
+
+	for _, f := range n.Fields {
+		if f.Name == softDeleteOpField {
+			return !f.Nillable
+		}
+	}
+
+	return false
+}
+
+// restoreSteps returns the cascade steps of the schema to the restorable children, which are restored with the schema
+func restoreSteps(n *gen.Type, nodes []*gen.Type) ([]cascadeTemplateStep, error) {
+	steps, err := cascadeSteps(n, nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	restorable := make([]cascadeTemplateStep, 0, len(steps))
+
+	for _, step := range steps {
+		if child := findNode(nodes, step.Child); child != nil && isRestorable(child) {
+			restorable = append(restorable, step)
+		}
+	}
+
+	return restorable, nil
+}
+
+// restoreUniques returns the unique fields and the fields of the unique indexes of the schema, a restored record
+// must not have the same values as an active record for any of them. Indexes on columns that are not fields, such as
+// edge columns, are left to the database
+func restoreUniques(n *gen.Type) [][]*gen.Field {
+	var uniques [][]*gen.Field
+
+	for _, f := range n.Fields {
+		if f.Unique && !isSoftDeleteField(f) {
+			uniques = append(uniques, []*gen.Field{f})
+		}
+	}
+
+	for _, idx := range n.Indexes {
+		if !idx.Unique {
+			continue
+		}
+
+		if fields, ok := indexFields(n, idx); ok && len(fields) > 0 {
+			uniques = append(uniques, fields)
+		}
+	}
+
+	return uniques
+}
+
+// indexFields returns the fields of the index columns, the soft delete fields are left out as they are cleared by
+// the restore; it reports false when a column is not a field
+func indexFields(n *gen.Type, idx *gen.Index) ([]*gen.Field, bool) {
+	fields := make([]*gen.Field, 0, len(idx.Columns))
+
+	for _, column := range idx.Columns {
+		var field *gen.Field
+
+		for _, f := range n.Fields {
+			if f.StorageKey() == column {
+				field = f
+				break
+			}
+		}
+
+		if field == nil {
+			return nil, false
+		}
+
+		if !isSoftDeleteField(field) {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields, true
+}
+
+// softDeleteFieldOf returns the deleted_at field of the schema
+func softDeleteFieldOf(n *gen.Type) *gen.Field {
+	for _, f := range n.Fields {
+		if f.Name == softDeleteField {
+			return f
+		}
+	}
+
+	return nil
+}
+
+// softDeleteFields returns the optional soft delete fields of the schema, which are cleared by the restore
+func softDeleteFields(n *gen.Type) []*gen.Field {
+	var fields []*gen.Field
+
+	for _, f := range n.Fields {
+		if f.Optional && isSoftDeleteField(f) {
+			fields = append(fields, f)
+		}
+	}
+
+	return fields
+}
+
+// isSoftDeleteField reports whether the field is one of the soft delete fields
+func isSoftDeleteField(f *gen.Field) bool {
+	switch f.Name {
+	case softDeleteField, softDeleteByField, softDeleteOpField:
+		return true
+	default:
+		return false
+	}
+}
+
+// SoftDeleteRestoreTemplate generates the Restore methods of the soft deletable schemas
+var SoftDeleteRestoreTemplate = parseEntxTemplate("soft_delete_restore", "templates/soft_delete_restore.tmpl")
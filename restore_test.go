@@ -0,0 +1,80 @@
+package entx_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theopenlane/entx"
+)
+
+func TestSoftDeleteRestoreTemplate(t *testing.T) {
+	out, err := generateTemplate(t, "soft_delete_restore.go", entx.WithSoftDeleteRestore(), Organization{}, Group{}, Invite{}, Membership{})
+	require.NoError(t, err)
+
+	assert.Contains(t, out, "func (c *OrganizationClient) Restore(ctx context.Context, id int) error {")
+	assert.Contains(t, out, "func (c *GroupClient) Restore(ctx context.Context, id int) error {")
+	assert.NotContains(t, out, "func (c *InviteClient) Restore")
+
+	// the unique index is checked without the soft delete fields
+	assert.Contains(t, out, "predicate.Organization(sql.FieldEQ(organization.FieldName, rec.Name)),")
+	assert.Contains(t, out, `plan.Conflict("Organization", rec.ID, "name")`)
+
+	assert.Contains(t, out, `ClearDeletedAt().
+			ClearDeletedBy().
+			ClearDeletedOpID().`)
+
+	// only the soft deletable children of the cascade are restored
+	assert.Contains(t, out, `NewGroupClient(c.config).planRestore(ctx, plan, opID,
+		group.HasOwnerWith(organization.IDIn(ids...)),
+		group.DeletedOpID(opID),
+	)`)
+	assert.NotContains(t, out, "NewInviteClient(c.config).planRestore")
+	assert.NotContains(t, out, "NewMembershipClient(c.config).planRestore")
+}
+
+func TestRestorePlan(t *testing.T) {
+	ctx := context.Background()
+	plan := entx.NewRestorePlan()
+
+	var restored []string
+
+	assert.True(t, plan.Visit("Organization", 1))
+	assert.False(t, plan.Visit("Organization", 1))
+	assert.True(t, plan.Visit("Group", 1))
+
+	plan.Add("Organization", []any{1}, func(context.Context) error {
+		restored = append(restored, "Organization")
+		return nil
+	})
+	plan.Add("Group", []any{1, 2}, func(context.Context) error {
+		restored = append(restored, "Group")
+		return nil
+	})
+
+	assert.Equal(t, []entx.RestoreRecords{
+		{Schema: "Organization", IDs: []any{1}},
+		{Schema: "Group", IDs: []any{1, 2}},
+	}, plan.Records())
+
+	require.NoError(t, plan.Run(ctx))
+	assert.Equal(t, []string{"Organization", "Group"}, restored)
+
+	// nothing is restored when a record conflicts
+	restored = nil
+
+	plan.Conflict("Group", 2, "name")
+
+	err := plan.Run(ctx)
+	require.ErrorIs(t, err, entx.ErrRestoreConflict)
+	assert.Empty(t, restored)
+
+	var conflict *entx.RestoreConflictError
+	require.True(t, errors.As(err, &conflict))
+	assert.Equal(t, "Group", conflict.Schema)
+	assert.Equal(t, []string{"name"}, conflict.Fields)
+	assert.Equal(t, "restore conflicts with an existing record: Group 2 on name", conflict.Error())
+}
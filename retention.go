@@ -0,0 +1,318 @@
+package entx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"entgo.io/ent/entc/gen"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultRetentionBatchSize is the number of records purged per delete
+const DefaultRetentionBatchSize = 500
+
+// RetentionPolicy purges the soft deleted records of a schema once their retention window passed, the policies
+// are generated with WithRetention from the RetentionAnnotation of the schemas
+type RetentionPolicy struct {
+	// Schema the policy applies to
+	Schema string
+	// Window is how long a record is kept after it was soft deleted
+	Window time.Duration
+	// Expired returns the ids of the records soft deleted before the cutoff, at most limit when limit is positive
+	Expired func(ctx context.Context, cutoff time.Time, limit int) ([]any, error)
+	// Purge hard deletes the records soft deleted before the cutoff with the ids and returns the number deleted
+	Purge func(ctx context.Context, cutoff time.Time, ids []any) (int, error)
+}
+
+// RetentionResult is the outcome of a retention policy run
+type RetentionResult struct {
+	// Schema the policy applies to
+	Schema string `json:"schema"`
+	// Window is the retention window of the schema
+	Window time.Duration `json:"window"`
+	// Cutoff is the time records had to be soft deleted before to be purged
+	Cutoff time.Time `json:"cutoff"`
+	// Expired is the number of records past their retention window
+	Expired int `json:"expired"`
+	// Purged is the number of records hard deleted, always 0 on dry runs
+	Purged int `json:"purged"`
+	// Batches is the number of deletes run
+	Batches int `json:"batches"`
+	// IDs are the ids of the expired records, which were purged unless the run is a dry run
+	IDs []any `json:"ids"`
+	// Error is set when the policy failed, the records purged before the failure are still reported
+	Error string `json:"error,omitempty"`
+}
+
+// RetentionReport is the report of a retention run, it lists the records purged, or that would be purged on dry runs,
+// so their removal can be proven
+type RetentionReport struct {
+	// DryRun is set when nothing was deleted
+	DryRun bool `json:"dryrun"`
+	// StartedAt is when the run started, the cutoffs are computed from it
+	StartedAt time.Time `json:"startedat"`
+	// FinishedAt is when the run finished
+	FinishedAt time.Time `json:"finishedat"`
+	// Results of the policies, in the order they ran
+	Results []RetentionResult `json:"results"`
+}
+
+// RetentionOption configures a RetentionRunner
+type RetentionOption func(*RetentionRunner)
+
+// WithRetentionBatchSize sets the number of records purged per delete, DefaultRetentionBatchSize by default
+func WithRetentionBatchSize(size int) RetentionOption {
+	return func(r *RetentionRunner) {
+		if size > 0 {
+			r.batchSize = size
+		}
+	}
+}
+
+// WithRetentionDryRun reports the expired records without deleting them
+func WithRetentionDryRun(dryRun bool) RetentionOption {
+	return func(r *RetentionRunner) {
+		r.dryRun = dryRun
+	}
+}
+
+// WithRetentionClock sets the clock the cutoffs are computed from, time.Now by default
+func WithRetentionClock(now func() time.Time) RetentionOption {
+	return func(r *RetentionRunner) {
+		r.now = now
+	}
+}
+
+// RetentionRunner hard deletes the soft deleted records past the retention window of their schema
+type RetentionRunner struct {
+	policies  []RetentionPolicy
+	batchSize int
+	dryRun    bool
+	now       func() time.Time
+}
+
+// NewRetentionRunner returns a runner for the policies, which run in order; the generated policies are ordered so
+// the records holding a foreign key are purged before the records they reference
+func NewRetentionRunner(policies []RetentionPolicy, opts ...RetentionOption) *RetentionRunner {
+	r := &RetentionRunner{
+		policies:  policies,
+		batchSize: DefaultRetentionBatchSize,
+		now:       time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Run runs the policies, a failing policy does not stop the others; the errors are joined and returned
+// with the report
+func (r *RetentionRunner) Run(ctx context.Context) (*RetentionReport, error) {
+	ctx = SkipSoftDelete(ctx)
+
+	report := &RetentionReport{
+		DryRun:    r.dryRun,
+		StartedAt: r.now(),
+	}
+
+	var errs []error
+
+	for _, p := range r.policies {
+		result := RetentionResult{
+			Schema: p.Schema,
+			Window: p.Window,
+			Cutoff: report.StartedAt.Add(-p.Window),
+			IDs:    []any{},
+		}
+
+		if err := r.run(ctx, p, &result); err != nil {
+			result.Error = err.Error()
+			errs = append(errs, fmt.Errorf("retention of %s: %w", p.Schema, err))
+
+			log.Error().Err(err).Str("schema", p.Schema).Int("purged", result.Purged).Msg("failed purging soft deleted records")
+		} else if result.Expired > 0 {
+			log.Info().Str("schema", p.Schema).Int("expired", result.Expired).Int("purged", result.Purged).
+				Bool("dry_run", r.dryRun).Msg("soft deleted records past their retention window")
+		}
+
+		report.Results = append(report.Results, result)
+	}
+
+	report.FinishedAt = r.now()
+
+	return report, errors.Join(errs...)
+}
+
+// run purges the expired records of the policy in batches
+func (r *RetentionRunner) run(ctx context.Context, p RetentionPolicy, result *RetentionResult) error {
+	if r.dryRun {
+		ids, err := p.Expired(ctx, result.Cutoff, 0)
+		if err != nil {
+			return err
+		}
+
+		result.Expired = len(ids)
+		result.IDs = append(result.IDs, ids...)
+
+		return nil
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		ids, err := p.Expired(ctx, result.Cutoff, r.batchSize)
+		if err != nil {
+			return err
+		}
+
+		if len(ids) == 0 {
+			return nil
+		}
+
+		n, err := p.Purge(ctx, result.Cutoff, ids)
+		if err != nil {
+			return err
+		}
+
+		result.Batches++
+		result.Expired += len(ids)
+		result.Purged += n
+		result.IDs = append(result.IDs, ids...)
+
+		// records that were not deleted, e.g. because of a hook, would be returned again
+		if n < len(ids) || len(ids) < r.batchSize {
+			return nil
+		}
+	}
+}
+
+// retentionWindow returns the retention window of the schema, 0 when the schema has no retention annotation
+func retentionWindow(n *gen.Type) (time.Duration, error) {
+	raw, ok := n.Annotations[RetentionAnnotationName]
+	if !ok {
+		return 0, nil
+	}
+
+	ant := &RetentionAnnotation{}
+	if err := DecodeAnnotation(raw, ant); err != nil {
+		return 0, fmt.Errorf("failed decoding retention annotation of %s: %w", n.Name, err)
+	}
+
+	switch {
+	case ant.Window <= 0:
+		return 0, fmt.Errorf("%w: %s retention window must be positive", ErrInvalidRetention, n.Name)
+	case !isSoftDeletable(n):
+		return 0, fmt.Errorf("%w: %s is not soft deletable", ErrInvalidRetention, n.Name)
+	}
+
+	return ant.Window, nil
+}
+
+// retentionNode is a schema with a retention window
+type retentionNode struct {
+	*gen.Type
+
+	Window time.Duration
+}
+
+// retentionNodes returns the schemas with a retention window in foreign key order: a schema holding a foreign key
+// comes before the schema it references, so its records are purged first
+func retentionNodes(nodes []*gen.Type) ([]retentionNode, error) {
+	var (
+		ordered []retentionNode
+		visit   func(n *gen.Type) error
+	)
+
+	visited := map[string]bool{}
+
+	visit = func(n *gen.Type) error {
+		// schemas referencing each other are purged in name order, the cycle is left to the cascade hooks
+		if visited[n.Name] {
+			return nil
+		}
+
+		visited[n.Name] = true
+
+		for _, ref := range referencingNodes(n, nodes) {
+			if err := visit(ref); err != nil {
+				return err
+			}
+		}
+
+		window, err := retentionWindow(n)
+		if err != nil {
+			return err
+		}
+
+		if window > 0 {
+			ordered = append(ordered, retentionNode{Type: n, Window: window})
+		}
+
+		return nil
+	}
+
+	sorted := make([]*gen.Type, len(nodes))
+	copy(sorted, nodes)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	for _, n := range sorted {
+		if err := visit(n); err != nil {
+			return nil, err
+		}
+	}
+
+	return ordered, nil
+}
+
+// referencingNodes returns the schemas, other than n, holding a foreign key to n, in name order
+func referencingNodes(n *gen.Type, nodes []*gen.Type) []*gen.Type {
+	var refs []*gen.Type
+
+	for _, other := range nodes {
+		if other.Name == n.Name {
+			continue
+		}
+
+		for _, e := range other.Edges {
+			if e.Type.Name == n.Name && e.OwnFK() {
+				refs = append(refs, other)
+				break
+			}
+		}
+	}
+
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Name < refs[j].Name })
+
+	return refs
+}
+
+// durationLiteral returns the go expression of the duration, e.g. 720 * time.Hour
+func durationLiteral(d time.Duration) string {
+	units := []struct {
+		unit time.Duration
+		name string
+	}{
+		{time.Hour, "time.Hour"},
+		{time.Minute, "time.Minute"},
+		{time.Second, "time.Second"},
+		{time.Millisecond, "time.Millisecond"},
+	}
+
+	for _, u := range units {
+		if d%u.unit == 0 {
+			return fmt.Sprintf("%d * %s", d/u.unit, u.name)
+		}
+	}
+
+	return fmt.Sprintf("time.Duration(%d)", d)
+}
+
+// RetentionTemplate generates the retention policies of the schemas from their RetentionAnnotation
+var RetentionTemplate = parseEntxTemplate("retention", "templates/retention.tmpl")
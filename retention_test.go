@@ -0,0 +1,185 @@
+package entx_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"entgo.io/ent"
+	"entgo.io/ent/schema"
+	"entgo.io/ent/schema/edge"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theopenlane/entx"
+	"github.com/theopenlane/entx/mixin"
+)
+
+// memoryRetention is a retention policy over soft deleted records kept in memory
+type memoryRetention struct {
+	deleted map[int]time.Time
+	purges  int
+	err     error
+}
+
+func (m *memoryRetention) policy(schema string, window time.Duration) entx.RetentionPolicy {
+	return entx.RetentionPolicy{
+		Schema: schema,
+		Window: window,
+		Expired: func(_ context.Context, cutoff time.Time, limit int) ([]any, error) {
+			ids := []int{}
+
+			for id, at := range m.deleted {
+				if at.Before(cutoff) {
+					ids = append(ids, id)
+				}
+			}
+
+			slices.Sort(ids)
+
+			if limit > 0 && len(ids) > limit {
+				ids = ids[:limit]
+			}
+
+			expired := []any{}
+			for _, id := range ids {
+				expired = append(expired, id)
+			}
+
+			return expired, nil
+		},
+		Purge: func(_ context.Context, _ time.Time, ids []any) (int, error) {
+			if m.err != nil {
+				return 0, m.err
+			}
+
+			m.purges++
+
+			for _, id := range ids {
+				delete(m.deleted, id.(int))
+			}
+
+			return len(ids), nil
+		},
+	}
+}
+
+func TestRetentionRunner(t *testing.T) {
+	now := time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	records := &memoryRetention{deleted: map[int]time.Time{
+		1: now.Add(-48 * time.Hour),
+		2: now.Add(-72 * time.Hour),
+		3: now.Add(-30 * time.Hour),
+		4: now.Add(-time.Hour),
+	}}
+
+	policies := []entx.RetentionPolicy{records.policy("Group", 24*time.Hour)}
+
+	report, err := entx.NewRetentionRunner(policies, entx.WithRetentionClock(clock), entx.WithRetentionDryRun(true)).Run(context.Background())
+	require.NoError(t, err)
+
+	assert.True(t, report.DryRun)
+	require.Len(t, report.Results, 1)
+	assert.Equal(t, now.Add(-24*time.Hour), report.Results[0].Cutoff)
+	assert.Equal(t, 3, report.Results[0].Expired)
+	assert.Equal(t, []any{1, 2, 3}, report.Results[0].IDs)
+	assert.Zero(t, report.Results[0].Purged)
+	assert.Len(t, records.deleted, 4)
+
+	report, err = entx.NewRetentionRunner(policies, entx.WithRetentionClock(clock), entx.WithRetentionBatchSize(2)).Run(context.Background())
+	require.NoError(t, err)
+
+	assert.False(t, report.DryRun)
+	assert.Equal(t, 3, report.Results[0].Purged)
+	assert.Equal(t, 2, report.Results[0].Batches)
+	assert.Equal(t, []any{1, 2, 3}, report.Results[0].IDs)
+	assert.Equal(t, 2, records.purges)
+
+	// records within their window are kept
+	assert.Len(t, records.deleted, 1)
+	assert.Contains(t, records.deleted, 4)
+}
+
+func TestRetentionRunnerErrors(t *testing.T) {
+	now := time.Now()
+
+	failing := &memoryRetention{deleted: map[int]time.Time{1: now.Add(-time.Hour)}, err: errors.New("foreign key constraint failed")}
+	records := &memoryRetention{deleted: map[int]time.Time{1: now.Add(-time.Hour)}}
+
+	report, err := entx.NewRetentionRunner([]entx.RetentionPolicy{
+		failing.policy("Group", time.Minute),
+		records.policy("Organization", time.Minute),
+	}).Run(context.Background())
+	require.ErrorContains(t, err, "retention of Group: foreign key constraint failed")
+
+	// the failing policy does not stop the others
+	require.Len(t, report.Results, 2)
+	assert.Equal(t, "foreign key constraint failed", report.Results[0].Error)
+	assert.Equal(t, 1, report.Results[1].Purged)
+	assert.Empty(t, report.Results[1].Error)
+}
+
+// Project is purged after its tasks, which reference it
+type Project struct{ ent.Schema }
+
+func (Project) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.To("tasks", Task.Type),
+	}
+}
+
+func (Project) Mixin() []ent.Mixin {
+	return []ent.Mixin{mixin.SoftDeleteMixin{}}
+}
+
+func (Project) Annotations() []schema.Annotation {
+	return []schema.Annotation{entx.RetentionWindow(90 * 24 * time.Hour)}
+}
+
+type Task struct{ ent.Schema }
+
+func (Task) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.From("project", Project.Type).Ref("tasks").Unique(),
+	}
+}
+
+func (Task) Mixin() []ent.Mixin {
+	return []ent.Mixin{mixin.SoftDeleteMixin{}}
+}
+
+func (Task) Annotations() []schema.Annotation {
+	return []schema.Annotation{entx.RetentionWindow(90 * time.Minute)}
+}
+
+type retainedInvite struct{ ent.Schema }
+
+func (retainedInvite) Annotations() []schema.Annotation {
+	return []schema.Annotation{entx.RetentionWindow(time.Hour)}
+}
+
+func TestRetentionTemplate(t *testing.T) {
+	out, err := generateTemplate(t, "retention.go", entx.WithRetention(), Project{}, Task{}, Invite{}, Organization{}, Group{}, Membership{})
+	require.NoError(t, err)
+
+	// tasks hold the foreign key so they are purged first
+	tasks := "Schema: \"Task\",\n\t\t\tWindow: 90 * time.Minute,"
+	projects := "Schema: \"Project\",\n\t\t\tWindow: 2160 * time.Hour,"
+
+	assert.Contains(t, out, tasks)
+	assert.Contains(t, out, projects)
+	assert.Less(t, strings.Index(out, tasks), strings.Index(out, projects))
+
+	assert.Contains(t, out, "Where(task.DeletedAtLT(cutoff)).")
+	assert.Contains(t, out, "Where(project.IDIn(typed...), project.DeletedAtLT(cutoff)).")
+	assert.NotContains(t, out, `Schema: "Organization"`)
+
+	// the schema must be soft deletable
+	_, err = generateTemplate(t, "retention.go", entx.WithRetention(), retainedInvite{})
+	assert.ErrorIs(t, err, entx.ErrInvalidRetention)
+}
@@ -8,6 +8,7 @@ import (
 
 var (
 	softDeleteSkipKey = contextx.NewKey[bool]()
+	softDeleteOpKey   = contextx.NewKey[string]()
 	// SoftDeleteTypeKey carries the schema type of an in-progress soft delete
 	SoftDeleteTypeKey = contextx.NewKey[string]()
 )
@@ -41,3 +42,14 @@ func CheckIsSoftDelete(ctx context.Context) bool {
 	_, ok := SoftDeleteTypeKey.Get(ctx)
 	return ok
 }
+
+// WithSoftDeleteOpID returns a new context carrying the id of the soft delete operation, the records soft deleted
+// by the cascade of a delete share the id of that delete so they can be restored together
+func WithSoftDeleteOpID(parent context.Context, id string) context.Context {
+	return softDeleteOpKey.Set(parent, id)
+}
+
+// SoftDeleteOpIDFromContext returns the id of the soft delete operation the context runs in
+func SoftDeleteOpIDFromContext(ctx context.Context) (string, bool) {
+	return softDeleteOpKey.Get(ctx)
+}
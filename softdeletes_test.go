@@ -40,3 +40,14 @@ func TestCheckIsSoftDeleteType(t *testing.T) {
 	assert.False(t, CheckIsSoftDeleteType(ctx, "AnotherObject"))
 	assert.False(t, CheckIsSoftDeleteType(context.Background(), "TestObject"))
 }
+
+func TestSoftDeleteOpID(t *testing.T) {
+	ctx := WithSoftDeleteOpID(context.Background(), "op")
+
+	id, ok := SoftDeleteOpIDFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "op", id)
+
+	_, ok = SoftDeleteOpIDFromContext(context.Background())
+	assert.False(t, ok)
+}
@@ -0,0 +1,285 @@
+package entx
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"entgo.io/ent/dialect"
+	"entgo.io/ent/dialect/sql"
+	"entgo.io/ent/dialect/sql/sqljson"
+	"entgo.io/ent/entc/gen"
+	"entgo.io/ent/schema/field"
+)
+
+// DefaultTagBatchSize is the number of records read per batch when renaming or merging tags
+const DefaultTagBatchSize = 500
+
+// TagCount is a tag in use with the number of records having it
+type TagCount struct {
+	// Tag is the normalized tag
+	Tag string `json:"tag"`
+	// Count is the number of records having the tag
+	Count int `json:"count"`
+}
+
+// NormalizeTag lower cases the tag, trims it and collapses its inner whitespace
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.Join(strings.Fields(tag), " "))
+}
+
+// NormalizeTags normalizes the tags and removes the empty and duplicate ones, the first occurrence is kept in place
+func NormalizeTags(tags []string) []string {
+	if tags == nil {
+		return nil
+	}
+
+	out := make([]string, 0, len(tags))
+
+	for _, t := range tags {
+		if t = NormalizeTag(t); t != "" && !slices.Contains(out, t) {
+			out = append(out, t)
+		}
+	}
+
+	return out
+}
+
+// MergeTags replaces the tags to merge by the tag merged into, which is kept at the place of the first tag replaced,
+// and reports whether the tags changed
+func MergeTags(tags []string, into string, merged ...string) ([]string, bool) {
+	into = NormalizeTag(into)
+	merged = NormalizeTags(merged)
+
+	out := make([]string, 0, len(tags))
+	changed := false
+
+	for _, t := range tags {
+		if slices.Contains(merged, t) && t != into {
+			t, changed = into, true
+		}
+
+		if into != "" || t != "" {
+			out = append(out, t)
+		}
+	}
+
+	if !changed {
+		return tags, false
+	}
+
+	return NormalizeTags(out), true
+}
+
+// TagsAnyOf returns a predicate matching the records with any of the tags in the column, none when no tags are given
+func TagsAnyOf(column string, tags ...string) func(*sql.Selector) {
+	tags = NormalizeTags(tags)
+
+	return func(s *sql.Selector) {
+		if len(tags) == 0 {
+			s.Where(sql.False())
+			return
+		}
+
+		ps := make([]*sql.Predicate, 0, len(tags))
+		for _, t := range tags {
+			ps = append(ps, sqljson.ValueContains(s.C(column), t))
+		}
+
+		s.Where(sql.Or(ps...))
+	}
+}
+
+// TagsAllOf returns a predicate matching the records with all the tags in the column, all the records when no tags are
+// given
+func TagsAllOf(column string, tags ...string) func(*sql.Selector) {
+	tags = NormalizeTags(tags)
+
+	return func(s *sql.Selector) {
+		if len(tags) == 0 {
+			return
+		}
+
+		ps := make([]*sql.Predicate, 0, len(tags))
+		for _, t := range tags {
+			ps = append(ps, sqljson.ValueContains(s.C(column), t))
+		}
+
+		s.Where(sql.And(ps...))
+	}
+}
+
+// TagTable is the table of a tagged schema
+type TagTable struct {
+	// Table of the schema
+	Table string
+	// Column holding the tags
+	Column string
+	// OwnerColumn holding the owner the tags are counted for, the tags of all the records are counted when empty
+	OwnerColumn string
+	// DeletedAtColumn of the soft deleted schemas, the soft deleted records are left out of the counts
+	DeletedAtColumn string
+	// Records selects the records counted instead of the table, aliased as the table, e.g. the query of a generated
+	// client once its interceptors ran so the counts are scoped like its queries
+	Records *sql.Selector
+}
+
+// CountsQuery returns the query listing the distinct tags of the owner with the number of records having them, the
+// most used first; the soft deleted records are counted when includeDeleted is set
+func (t TagTable) CountsQuery(driver, ownerID string, includeDeleted bool) (string, []any, error) {
+	// the records are read from the table or the records query
+	records := func(b *sql.Builder) {
+		if t.Records == nil {
+			b.Ident(t.Table)
+			return
+		}
+
+		b.Wrap(func(b *sql.Builder) {
+			b.Join(t.Records)
+		}).WriteString(" AS ").Ident(t.Table)
+	}
+
+	// the tags of the records are expanded to one row each, aliased t.tag
+	var tags func(b *sql.Builder)
+
+	switch driver {
+	case dialect.Postgres:
+		tags = func(b *sql.Builder) {
+			records(b)
+			b.WriteString(", jsonb_array_elements_text(").Ident(t.Table).WriteByte('.').Ident(t.Column).
+				WriteString("::jsonb) AS ").Ident("t").WriteByte('(').Ident("tag").WriteByte(')')
+		}
+	case dialect.SQLite:
+		tags = func(b *sql.Builder) {
+			b.WriteString("(SELECT ").Ident("j").WriteString(".value AS ").Ident("tag").WriteString(", ").
+				Ident(t.Table).WriteString(".* FROM ")
+			records(b)
+			b.WriteString(", json_each(").Ident(t.Table).WriteByte('.').Ident(t.Column).WriteString(") AS ").
+				Ident("j").WriteString(") AS ").Ident("t")
+		}
+	case dialect.MySQL:
+		tags = func(b *sql.Builder) {
+			records(b)
+			b.WriteString(", JSON_TABLE(").Ident(t.Table).WriteByte('.').Ident(t.Column).
+				WriteString(", '$[*]' COLUMNS(").Ident("tag").WriteString(" VARCHAR(255) PATH '$')) AS ").Ident("t")
+		}
+	default:
+		return "", nil, fmt.Errorf("%w: %s", ErrUnsupportedTagDialect, driver)
+	}
+
+	b := &sql.Builder{}
+	b.SetDialect(driver)
+
+	b.WriteString("SELECT ").Ident("t").WriteByte('.').Ident("tag").WriteString(", COUNT(*) AS ").Ident("count").
+		WriteString(" FROM ")
+
+	tags(b)
+
+	// the sqlite rows are selected from the expanded table, which has the columns of the table
+	table := t.Table
+	if driver == dialect.SQLite {
+		table = "t"
+	}
+
+	var where []func()
+
+	if t.OwnerColumn != "" {
+		where = append(where, func() {
+			b.Ident(table).WriteByte('.').Ident(t.OwnerColumn).WriteString(" = ").Arg(ownerID)
+		})
+	}
+
+	if t.DeletedAtColumn != "" && !includeDeleted {
+		where = append(where, func() {
+			b.Ident(table).WriteByte('.').Ident(t.DeletedAtColumn).WriteString(" IS NULL")
+		})
+	}
+
+	for i, w := range where {
+		if i == 0 {
+			b.WriteString(" WHERE ")
+		} else {
+			b.WriteString(" AND ")
+		}
+
+		w()
+	}
+
+	b.WriteString(" GROUP BY ").Ident("t").WriteByte('.').Ident("tag").
+		WriteString(" ORDER BY ").Ident("count").WriteString(" DESC, ").Ident("t").WriteByte('.').Ident("tag")
+
+	if err := b.Err(); err != nil {
+		return "", nil, err
+	}
+
+	query, args := b.Query()
+
+	return query, args, nil
+}
+
+// tagNode is a tagged schema
+type tagNode struct {
+	*gen.Type
+
+	// Field holding the tags
+	Field *gen.Field
+	// OwnerField is the owner_id string field the tags are counted for, nil when the schema has none
+	OwnerField *gen.Field
+}
+
+// tagNodes returns the schemas with the tags annotation
+func tagNodes(nodes []*gen.Type) ([]tagNode, error) {
+	var out []tagNode
+
+	for _, n := range nodes {
+		ant, ok, err := LookupAnnotation[*TagsAnnotation](n)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidTags, n.Name, err)
+		}
+
+		if !ok {
+			continue
+		}
+
+		tn, err := newTagNode(n, ant)
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, tn)
+	}
+
+	return out, nil
+}
+
+// newTagNode returns the tagged schema, or an error when the annotation does not match its fields
+func newTagNode(n *gen.Type, ant *TagsAnnotation) (tagNode, error) {
+	tn := tagNode{Type: n}
+
+	for _, f := range n.Fields {
+		switch f.Name {
+		case ant.Field:
+			tn.Field = f
+		case "owner_id":
+			if f.Type.Type == field.TypeString {
+				tn.OwnerField = f
+			}
+		}
+	}
+
+	switch {
+	case tn.Field == nil:
+		return tn, fmt.Errorf("%w: %s.%s does not exist", ErrInvalidTags, n.Name, ant.Field)
+	case tn.Field.Type.Type != field.TypeJSON || tn.Field.Type.String() != "[]string":
+		return tn, fmt.Errorf("%w: %s.%s is not a []string field", ErrInvalidTags, n.Name, ant.Field)
+	}
+
+	if n.ID == nil {
+		return tn, fmt.Errorf("%w: %s has no id", ErrInvalidTags, n.Name)
+	}
+
+	return tn, nil
+}
+
+// TagsTemplate generates the tag helpers of the schemas with the tags annotation
+var TagsTemplate = parseEntxTemplate("tags", "templates/tags.tmpl")
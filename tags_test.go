@@ -0,0 +1,146 @@
+package entx_test
+
+import (
+	"testing"
+
+	"entgo.io/ent"
+	"entgo.io/ent/dialect"
+	"entgo.io/ent/dialect/sql"
+	"entgo.io/ent/schema"
+	"entgo.io/ent/schema/field"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theopenlane/entx"
+	"github.com/theopenlane/entx/mixin"
+)
+
+// Note is tagged per owner and soft deletable
+type Note struct{ ent.Schema }
+
+func (Note) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("owner_id").Optional(),
+	}
+}
+
+func (Note) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		mixin.SoftDeleteMixin{},
+		mixin.NewTagMixin(mixin.WithTagVocabulary("Prod", "staging")),
+	}
+}
+
+// Label is tagged without an owner
+type Label struct{ ent.Schema }
+
+func (Label) Mixin() []ent.Mixin {
+	return []ent.Mixin{mixin.TagMixin{}}
+}
+
+type invalidTags struct{ ent.Schema }
+
+func (invalidTags) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("tags"),
+	}
+}
+
+func (invalidTags) Annotations() []schema.Annotation {
+	return []schema.Annotation{entx.TagsAnnotation{Field: "tags"}}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	assert.Equal(t, "high priority", entx.NormalizeTag("  High\t Priority "))
+	assert.Equal(t, []string{"prod", "high priority"}, entx.NormalizeTags([]string{"Prod", " ", "high  priority", "prod"}))
+	assert.Nil(t, entx.NormalizeTags(nil))
+}
+
+func TestMergeTags(t *testing.T) {
+	tags, changed := entx.MergeTags([]string{"a", "prod", "b", "production"}, "Prod", "production", "PROD")
+	assert.True(t, changed)
+	assert.Equal(t, []string{"a", "prod", "b"}, tags)
+
+	tags, changed = entx.MergeTags([]string{"a", "b"}, "c", "d")
+	assert.False(t, changed)
+	assert.Equal(t, []string{"a", "b"}, tags)
+
+	tags, changed = entx.MergeTags([]string{"old", "a", "new"}, "new", "old")
+	assert.True(t, changed)
+	assert.Equal(t, []string{"new", "a"}, tags)
+}
+
+func TestTagTableCountsQuery(t *testing.T) {
+	table := entx.TagTable{Table: "notes", Column: "tags", OwnerColumn: "owner_id", DeletedAtColumn: "deleted_at"}
+
+	query, args, err := table.CountsQuery(dialect.Postgres, "org", false)
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT "t"."tag", COUNT(*) AS "count" FROM "notes", jsonb_array_elements_text("notes"."tags"::jsonb) AS "t"("tag") WHERE "notes"."owner_id" = $1 AND "notes"."deleted_at" IS NULL GROUP BY "t"."tag" ORDER BY "count" DESC, "t"."tag"`, query)
+	assert.Equal(t, []any{"org"}, args)
+
+	query, _, err = table.CountsQuery(dialect.SQLite, "org", true)
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT `t`.`tag`, COUNT(*) AS `count` FROM (SELECT `j`.value AS `tag`, `notes`.* FROM `notes`, json_each(`notes`.`tags`) AS `j`) AS `t` WHERE `t`.`owner_id` = ? GROUP BY `t`.`tag` ORDER BY `count` DESC, `t`.`tag`", query)
+
+	query, args, err = entx.TagTable{Table: "labels", Column: "tags"}.CountsQuery(dialect.MySQL, "", false)
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT `t`.`tag`, COUNT(*) AS `count` FROM `labels`, JSON_TABLE(`labels`.`tags`, '$[*]' COLUMNS(`tag` VARCHAR(255) PATH '$')) AS `t` GROUP BY `t`.`tag` ORDER BY `count` DESC, `t`.`tag`", query)
+	assert.Empty(t, args)
+
+	// the records are selected by a query aliased as the table
+	records := sql.Dialect(dialect.Postgres).Select("*").From(sql.Table("notes")).Where(sql.EQ("owner_id", "org"))
+
+	query, args, err = entx.TagTable{Table: "notes", Column: "tags", Records: records}.CountsQuery(dialect.Postgres, "", false)
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT "t"."tag", COUNT(*) AS "count" FROM (SELECT * FROM "notes" WHERE "owner_id" = $1) AS "notes", jsonb_array_elements_text("notes"."tags"::jsonb) AS "t"("tag") GROUP BY "t"."tag" ORDER BY "count" DESC, "t"."tag"`, query)
+	assert.Equal(t, []any{"org"}, args)
+
+	records = sql.Dialect(dialect.SQLite).Select("*").From(sql.Table("notes")).Where(sql.EQ("owner_id", "org"))
+
+	query, args, err = entx.TagTable{Table: "notes", Column: "tags", Records: records}.CountsQuery(dialect.SQLite, "", false)
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT `t`.`tag`, COUNT(*) AS `count` FROM (SELECT `j`.value AS `tag`, `notes`.* FROM (SELECT * FROM `notes` WHERE `owner_id` = ?) AS `notes`, json_each(`notes`.`tags`) AS `j`) AS `t` GROUP BY `t`.`tag` ORDER BY `count` DESC, `t`.`tag`", query)
+	assert.Equal(t, []any{"org"}, args)
+
+	_, _, err = table.CountsQuery(dialect.Gremlin, "org", false)
+	assert.ErrorIs(t, err, entx.ErrUnsupportedTagDialect)
+}
+
+func TestTagsTemplate(t *testing.T) {
+	out, err := generateTemplate(t, "tags.go", entx.WithTagHelpers(), Note{}, Label{})
+	require.NoError(t, err)
+
+	assert.Contains(t, out, `func NoteTagsAnyOf(tags ...string) predicate.Note {
+	return predicate.Note(entx.TagsAnyOf(note.FieldTags, tags...))
+}`)
+	assert.Contains(t, out, `func LabelTagsAllOf(tags ...string) predicate.Label {`)
+
+	// the tags are counted from the records of the client query, scoped by its interceptors
+	assert.Contains(t, out, `func (c *NoteClient) TagCounts(ctx context.Context, ownerID string) ([]entx.TagCount, error) {
+	query := c.Query().Where(note.OwnerID(ownerID))
+	if err := query.prepareQuery(ctx); err != nil {
+		return nil, err
+	}`)
+	assert.Contains(t, out, `func (c *LabelClient) TagCounts(ctx context.Context) ([]entx.TagCount, error) {
+	query := c.Query()
+`)
+	assert.Contains(t, out, `Records: query.sqlQuery(ctx),`)
+	assert.Contains(t, out, `table.CountsQuery(c.driver.Dialect(), "", false)`)
+
+	assert.Contains(t, out, `func (c *NoteClient) RenameTag(ctx context.Context, ownerID string, from, to string) (int, error) {
+	return c.MergeTags(ctx, ownerID, to, from)
+}`)
+	assert.Contains(t, out, `Where(NoteTagsAnyOf(merged...), note.OwnerID(ownerID)).`)
+	assert.Contains(t, out, `Where(LabelTagsAnyOf(merged...)).`)
+	assert.Contains(t, out, `updateCtx := entx.SkipVersionCheck(ctx)`)
+	assert.Contains(t, out, `c.UpdateOneID(rec.ID).SetTags(tags).Exec(updateCtx)`)
+
+	_, err = generateTemplate(t, "tags.go", entx.WithTagHelpers(), invalidTags{})
+	assert.ErrorIs(t, err, entx.ErrInvalidTags)
+}
+
+func TestLintGraphTags(t *testing.T) {
+	issues := entx.LintGraph(lintGraph(t, invalidTags{}, Note{}))
+	require.Len(t, issues, 1)
+	assert.Equal(t, "invalidTags.tags: OPENLANE_TAGS: is not a []string field", issues[0].String())
+}
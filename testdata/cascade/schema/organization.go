@@ -0,0 +1,81 @@
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema"
+	"entgo.io/ent/schema/edge"
+	"entgo.io/ent/schema/field"
+
+	"github.com/theopenlane/entx"
+	"github.com/theopenlane/entx/mixin"
+)
+
+// Organization soft deletes its groups and hard deletes its invites, which are not soft deletable
+type Organization struct {
+	ent.Schema
+}
+
+func (Organization) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("name"),
+	}
+}
+
+func (Organization) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.To("groups", Group.Type).Annotations(entx.CascadeAnnotationField("Owner")),
+		edge.To("invites", Invite.Type).Annotations(entx.CascadeAnnotationField("Owner")),
+	}
+}
+
+func (Organization) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		mixin.SoftDeleteMixin{},
+	}
+}
+
+// Group cleans up its memberships
+type Group struct {
+	ent.Schema
+}
+
+func (Group) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.From("owner", Organization.Type).Ref("groups").Unique(),
+		edge.To("memberships", Membership.Type),
+	}
+}
+
+func (Group) Annotations() []schema.Annotation {
+	return []schema.Annotation{
+		entx.CascadeThroughAnnotationField([]entx.ThroughCleanup{{Field: "Group", Through: "Membership"}}),
+	}
+}
+
+func (Group) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		mixin.SoftDeleteMixin{},
+	}
+}
+
+// Invite is not soft deletable
+type Invite struct {
+	ent.Schema
+}
+
+func (Invite) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.From("owner", Organization.Type).Ref("invites").Unique(),
+	}
+}
+
+// Membership is not soft deletable
+type Membership struct {
+	ent.Schema
+}
+
+func (Membership) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.From("group", Group.Type).Ref("memberships").Unique(),
+	}
+}
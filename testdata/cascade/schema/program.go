@@ -0,0 +1,50 @@
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/edge"
+	"entgo.io/ent/schema/field"
+
+	"github.com/theopenlane/entx"
+	"github.com/theopenlane/entx/mixin"
+)
+
+// Program only cascades to soft deletable children
+type Program struct {
+	ent.Schema
+}
+
+func (Program) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("name"),
+	}
+}
+
+func (Program) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.To("controls", Control.Type).Annotations(entx.CascadeAnnotationField("Program")),
+	}
+}
+
+func (Program) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		mixin.SoftDeleteMixin{},
+	}
+}
+
+// Control is soft deleted with its program
+type Control struct {
+	ent.Schema
+}
+
+func (Control) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.From("program", Program.Type).Ref("controls").Unique(),
+	}
+}
+
+func (Control) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		mixin.SoftDeleteMixin{},
+	}
+}
@@ -0,0 +1,113 @@
+package multiwrite_test
+
+import (
+	"context"
+	stdsql "database/sql"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"entgo.io/ent/dialect"
+	entsql "entgo.io/ent/dialect/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+
+	"github.com/theopenlane/entx"
+	"github.com/theopenlane/entx/testdata/multiwrite/ent"
+	"github.com/theopenlane/entx/testdata/multiwrite/ent/task"
+)
+
+// openDriver returns a driver of a new sqlite database with the schema created
+func openDriver(t *testing.T, name string) dialect.Driver {
+	t.Helper()
+
+	db, err := stdsql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), name+".db")+"?_pragma=foreign_keys(1)")
+	require.NoError(t, err)
+
+	drv := entsql.OpenDB(dialect.SQLite, db)
+	t.Cleanup(func() { drv.Close() })
+
+	require.NoError(t, ent.NewClient(ent.Driver(drv)).Schema.Create(context.Background()))
+
+	return drv
+}
+
+// tasks returns the name and count of the tasks of the database by id
+func tasks(t *testing.T, drv dialect.Driver) map[int]string {
+	t.Helper()
+
+	list, err := ent.NewClient(ent.Driver(drv)).Task.Query().All(context.Background())
+	require.NoError(t, err)
+
+	out := map[int]string{}
+	for _, tk := range list {
+		out[tk.ID] = fmt.Sprintf("%s:%d", tk.Name, tk.Count)
+	}
+
+	return out
+}
+
+// writeTasks creates the tasks with the generated client, the ids are read back with INSERT ... RETURNING
+func writeTasks(t *testing.T, client *ent.Client) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	created := client.Task.Create().SetName("a").SaveX(ctx)
+	assert.Positive(t, created.ID)
+
+	// the upsert returns the id of the existing task
+	id := client.Task.Create().SetName("a").SetCount(2).OnConflictColumns(task.FieldName).UpdateCount().IDX(ctx)
+	assert.Equal(t, created.ID, id)
+
+	bulk := client.Task.CreateBulk(client.Task.Create().SetName("b"), client.Task.Create().SetName("c")).SaveX(ctx)
+	assert.Len(t, bulk, 2)
+
+	tx, err := client.Tx(ctx)
+	require.NoError(t, err)
+
+	tx.Task.Create().SetName("d").SetCount(1).SaveX(ctx)
+	require.NoError(t, tx.Commit())
+}
+
+func TestMultiWriteDriver(t *testing.T) {
+	primary, secondary := openDriver(t, "primary"), openDriver(t, "secondary")
+
+	drv := &entx.MultiWriteDriver{Wp: primary, Ws: secondary}
+
+	writeTasks(t, ent.NewClient(ent.Driver(drv)))
+
+	want := tasks(t, primary)
+	assert.ElementsMatch(t, []string{"a:2", "b:0", "c:0", "d:1"}, slices.Collect(maps.Values(want)))
+	assert.Equal(t, want, tasks(t, secondary))
+	assert.Zero(t, drv.Divergences())
+}
+
+func TestMultiWriteDriverAsync(t *testing.T) {
+	ctx := context.Background()
+	primary, secondary := openDriver(t, "primary"), openDriver(t, "secondary")
+
+	db, err := stdsql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "outbox.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	outbox, err := entx.NewSQLiteOutbox(ctx, db)
+	require.NoError(t, err)
+
+	drv := &entx.MultiWriteDriver{Wp: primary, Ws: secondary, Async: entx.NewAsyncReplicator(outbox, secondary)}
+
+	writeTasks(t, ent.NewClient(ent.Driver(drv)))
+
+	// the writes reach the secondary once the outbox is replayed
+	assert.Empty(t, tasks(t, secondary))
+
+	require.NoError(t, drv.Async.Drain(ctx))
+
+	want := tasks(t, primary)
+	assert.Len(t, want, 4)
+	assert.Equal(t, want, tasks(t, secondary))
+	assert.Zero(t, drv.Divergences())
+}
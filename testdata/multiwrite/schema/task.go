@@ -0,0 +1,18 @@
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+)
+
+// Task is created through the multi write driver, its id is read back with INSERT ... RETURNING
+type Task struct {
+	ent.Schema
+}
+
+func (Task) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("name").Unique(),
+		field.Int("count").Default(0),
+	}
+}
@@ -0,0 +1,127 @@
+package orgscope_test
+
+import (
+	"context"
+	stdsql "database/sql"
+	"testing"
+
+	"entgo.io/ent/dialect"
+	entsql "entgo.io/ent/dialect/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+
+	"github.com/theopenlane/entx"
+	"github.com/theopenlane/entx/testdata/orgscope/ent"
+	"github.com/theopenlane/entx/testdata/orgscope/ent/program"
+	_ "github.com/theopenlane/entx/testdata/orgscope/ent/runtime"
+)
+
+// orgContextKey holds the organization read by the test resolver
+type orgContextKey struct{}
+
+func newClient(t *testing.T) *ent.Client {
+	t.Helper()
+
+	db, err := stdsql.Open("sqlite", "file:"+t.Name()+"?mode=memory&_pragma=foreign_keys(1)")
+	require.NoError(t, err)
+
+	client := ent.NewClient(ent.Driver(entsql.OpenDB(dialect.SQLite, db)))
+	t.Cleanup(func() { client.Close() })
+
+	require.NoError(t, client.Schema.Create(context.Background()))
+
+	client.UseOrgScoping(entx.NewOrgScope(entx.WithOrgResolver(func(ctx context.Context) (string, error) {
+		orgID, _ := ctx.Value(orgContextKey{}).(string)
+		return orgID, nil
+	})))
+
+	return client
+}
+
+func TestOrgScope(t *testing.T) {
+	client := newClient(t)
+
+	org1 := context.WithValue(context.Background(), orgContextKey{}, "o1")
+	org2 := context.WithValue(context.Background(), orgContextKey{}, "o2")
+
+	// the owner is set from the organization of the caller
+	p1 := client.Program.Create().SetName("p1").SetTags([]string{"prod", "soc2"}).SaveX(org1)
+	assert.Equal(t, "o1", p1.OwnerID)
+
+	p2 := client.Program.Create().SetName("p2").SetTags([]string{"prod"}).SaveX(org2)
+	s1 := client.Standard.Create().SetName("s1").SaveX(org1)
+	s2 := client.Standard.Create().SetName("s2").SaveX(org2)
+	system := client.Standard.Create().SetName("system").SetSystemOwned(true).SaveX(org2)
+
+	_, err := client.Program.Create().SetName("p3").SetOwnerID("o2").Save(org1)
+	assert.ErrorIs(t, err, entx.ErrCrossOrgAccess)
+
+	_, err = client.Program.Query().All(context.Background())
+	assert.ErrorIs(t, err, entx.ErrMissingOrganization)
+
+	t.Run("reads", func(t *testing.T) {
+		programs, err := client.Program.Query().All(org1)
+		require.NoError(t, err)
+		require.Len(t, programs, 1)
+		assert.Equal(t, p1.ID, programs[0].ID)
+
+		_, err = client.Program.Get(org1, p2.ID)
+		assert.True(t, ent.IsNotFound(err))
+
+		// the system owned records are read by every organization
+		names := client.Standard.Query().Order(ent.Asc("name")).Select("name").StringsX(org1)
+		assert.Equal(t, []string{"s1", "system"}, names)
+
+		all, err := client.Program.Query().Count(entx.BypassOrgScope(org1, "test"))
+		require.NoError(t, err)
+		assert.Equal(t, 2, all)
+	})
+
+	t.Run("updates", func(t *testing.T) {
+		err := client.Program.UpdateOneID(p2.ID).SetName("changed").Exec(org1)
+		assert.True(t, ent.IsNotFound(err))
+
+		n, err := client.Program.Update().SetName("changed").Save(org1)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		// the system owned records are only changed by the system jobs
+		err = client.Standard.UpdateOneID(system.ID).SetName("changed").Exec(org1)
+		assert.True(t, ent.IsNotFound(err))
+
+		n, err = client.Program.Delete().Where(program.ID(p2.ID)).Exec(org1)
+		require.NoError(t, err)
+		assert.Zero(t, n)
+
+		assert.Equal(t, "p2", client.Program.GetX(org2, p2.ID).Name)
+	})
+
+	t.Run("edges", func(t *testing.T) {
+		err := client.Program.UpdateOneID(p1.ID).AddStandardIDs(s2.ID).Exec(org1)
+		assert.ErrorIs(t, err, entx.ErrCrossOrgAccess)
+
+		_, err = client.Program.Create().SetName("p4").AddStandardIDs(s1.ID, s2.ID).Save(org1)
+		assert.ErrorIs(t, err, entx.ErrCrossOrgAccess)
+
+		err = client.Program.UpdateOneID(p1.ID).AddStandardIDs(s1.ID, system.ID).Exec(org1)
+		require.NoError(t, err)
+
+		names := client.Program.QueryStandards(p1).Order(ent.Asc("name")).Select("name").StringsX(org1)
+		assert.Equal(t, []string{"s1", "system"}, names)
+	})
+
+	t.Run("tag counts", func(t *testing.T) {
+		// the owner given does not widen the scope of the caller
+		counts, err := client.Program.TagCounts(org1, "o2")
+		require.NoError(t, err)
+		assert.Empty(t, counts)
+
+		counts, err = client.Program.TagCounts(org1, "o1")
+		require.NoError(t, err)
+		assert.Equal(t, []entx.TagCount{{Tag: "prod", Count: 1}, {Tag: "soc2", Count: 1}}, counts)
+
+		_, err = client.Program.TagCounts(context.Background(), "o1")
+		assert.ErrorIs(t, err, entx.ErrMissingOrganization)
+	})
+}
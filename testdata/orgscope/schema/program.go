@@ -0,0 +1,33 @@
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/edge"
+	"entgo.io/ent/schema/field"
+
+	"github.com/theopenlane/entx/mixin"
+)
+
+// Program is org owned, tagged and attaches org owned standards
+type Program struct {
+	ent.Schema
+}
+
+func (Program) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("name"),
+	}
+}
+
+func (Program) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		mixin.OrgOwnedMixin{},
+		mixin.TagMixin{},
+	}
+}
+
+func (Program) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.To("standards", Standard.Type),
+	}
+}
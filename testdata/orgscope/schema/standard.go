@@ -0,0 +1,34 @@
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema"
+	"entgo.io/ent/schema/field"
+
+	"github.com/theopenlane/entx"
+	"github.com/theopenlane/entx/mixin"
+)
+
+// Standard is org owned with system owned records
+type Standard struct {
+	ent.Schema
+}
+
+func (Standard) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("name"),
+		field.Bool("system_owned").Default(false),
+	}
+}
+
+func (Standard) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		mixin.OrgOwnedMixin{},
+	}
+}
+
+func (Standard) Annotations() []schema.Annotation {
+	return []schema.Annotation{
+		entx.SystemOwnedSchema{},
+	}
+}
@@ -0,0 +1,21 @@
+package entx
+
+import (
+	"context"
+
+	"github.com/theopenlane/utils/contextx"
+)
+
+var skipVersionCheckKey = contextx.NewKey[bool]()
+
+// SkipVersionCheck returns a new context whose single record updates are made without the expected version of the
+// VersionMixin, e.g. by internal jobs updating the records they just read; the version is still incremented
+func SkipVersionCheck(parent context.Context) context.Context {
+	return skipVersionCheckKey.Set(parent, true)
+}
+
+// CheckSkipVersionCheck checks whether updating without the expected version was requested
+func CheckSkipVersionCheck(ctx context.Context) bool {
+	skip, _ := skipVersionCheckKey.Get(ctx)
+	return skip
+}